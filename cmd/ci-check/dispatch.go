@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/Manzanit0/go-github/v52/github"
+)
+
+// maxActionIdentifier is how long the Checks API lets action identifiers be.
+const maxActionIdentifier = 20
+
+// Names of the check runs, by which they are re-run. Applications released
+// individually are told apart by the external ID of their check run.
+const (
+	lintCheckRunName       = "Lint"
+	buildCheckRunName      = "Build application"
+	releaseAllCheckRunName = "Release application"
+)
+
+// Suite is the commit jobs run for, whether they were triggered by the check
+// suite or by one of its check runs.
+type Suite struct {
+	InstallationID int64
+	Repo           *github.Repository
+
+	HeadBranch string
+	HeadSHA    string
+	BeforeSHA  string
+	AfterSHA   string
+}
+
+func suiteFromCheckSuite(event *github.CheckSuiteEvent) Suite {
+	return Suite{
+		InstallationID: event.GetInstallation().GetID(),
+		Repo:           event.GetRepo(),
+		HeadBranch:     event.GetCheckSuite().GetHeadBranch(),
+		HeadSHA:        event.GetCheckSuite().GetHeadSHA(),
+		BeforeSHA:      event.GetCheckSuite().GetBeforeSHA(),
+		AfterSHA:       event.GetCheckSuite().GetAfterSHA(),
+	}
+}
+
+func suiteFromCheckRun(event *github.CheckRunEvent) Suite {
+	return Suite{
+		InstallationID: event.GetInstallation().GetID(),
+		Repo:           event.GetRepo(),
+		HeadBranch:     event.GetCheckRun().GetCheckSuite().GetHeadBranch(),
+		HeadSHA:        event.GetCheckRun().GetHeadSHA(),
+		BeforeSHA:      event.GetCheckRun().GetCheckSuite().GetBeforeSHA(),
+		AfterSHA:       event.GetCheckRun().GetCheckSuite().GetAfterSHA(),
+	}
+}
+
+// Owner is the login of the owner of the repository.
+func (s Suite) Owner() string {
+	return s.Repo.GetOwner().GetLogin()
+}
+
+// Name is the name of the repository.
+func (s Suite) Name() string {
+	return s.Repo.GetName()
+}
+
+// ActionHandler handles an action requested from a check run.
+type ActionHandler func(ctx context.Context, event *github.CheckRunEvent)
+
+// Job is a job of a suite, concluding a check run of its own.
+type Job func(ctx context.Context, suite Suite)
+
+// Dispatcher starts the jobs for check suite and check run events.
+type Dispatcher struct {
+	svc     *Services
+	jobs    *Jobs
+	actions map[string]ActionHandler
+	running sync.WaitGroup
+
+	// checks are the jobs by the name of their check run, by which they are
+	// re-run.
+	checks map[string]Job
+
+	// releaseApp releases an application again under a new check run.
+	releaseApp func(ctx context.Context, suite Suite, appName string)
+}
+
+// NewDispatcher returns a dispatcher with the jobs and release actions
+// registered.
+func NewDispatcher(svc *Services) *Dispatcher {
+	d := &Dispatcher{
+		svc:     svc,
+		jobs:    NewJobs(),
+		actions: map[string]ActionHandler{},
+	}
+
+	d.checks = map[string]Job{
+		lintCheckRunName: func(ctx context.Context, suite Suite) {
+			LintApplication(ctx, d.svc, suite)
+		},
+		buildCheckRunName: func(ctx context.Context, suite Suite) {
+			BuildApplication(ctx, d.svc, suite)
+		},
+		releaseAllCheckRunName: func(ctx context.Context, suite Suite) {
+			ReleaseApplication(ctx, d.svc, suite)
+		},
+	}
+	d.releaseApp = d.rerunApplicationRelease
+
+	d.RegisterAction(releaseAction, func(ctx context.Context, event *github.CheckRunEvent) {
+		ReleaseApplication(ctx, d.svc, suiteFromCheckRun(event))
+	})
+
+	d.RegisterAction(retryReleaseAction, func(ctx context.Context, event *github.CheckRunEvent) {
+		RetryApplicationRelease(ctx, d.svc, suiteFromCheckRun(event), event.GetCheckRun().GetID(), event.GetCheckRun().GetExternalID())
+	})
+
+	return d
+}
+
+// RegisterAction handles the action with the identifier, replacing any
+// handler registered before. It panics on identifiers the Checks API would
+// reject.
+func (d *Dispatcher) RegisterAction(identifier string, handler ActionHandler) {
+	if identifier == "" || len(identifier) > maxActionIdentifier {
+		panic(fmt.Sprintf("invalid action identifier %q", identifier))
+	}
+
+	d.actions[identifier] = handler
+}
+
+// Wait waits for the jobs started so far to finish.
+func (d *Dispatcher) Wait() {
+	d.running.Wait()
+}
+
+// CheckSuite starts the jobs of a check suite in the background, both when
+// it's requested for a push and when all its checks are re-run. A new check
+// suite cancels the jobs of the commits it supersedes on the branch. It
+// reports whether any job was started.
+func (d *Dispatcher) CheckSuite(event *github.CheckSuiteEvent) bool {
+	switch event.GetAction() {
+	case "requested", "rerequested":
+		suite := suiteFromCheckSuite(event)
+		supersede := event.GetAction() == "requested"
+		d.run(suite, supersede, d.checks[lintCheckRunName])
+		if d.svc.ReleaseConfig.BuildOnPullRequest {
+			d.run(suite, supersede, d.checks[buildCheckRunName])
+		}
+		return true
+
+	default:
+		log.Println("Ignoring check_suite event:", event.GetAction())
+		return false
+	}
+}
+
+// CheckRun starts the job for a requested action, or re-runs the job of the
+// check run, in the background. It reports whether a job was started.
+func (d *Dispatcher) CheckRun(event *github.CheckRunEvent) bool {
+	switch event.GetAction() {
+	case "requested_action":
+		identifier := event.GetRequestedAction().Identifier
+		handler, ok := d.actions[identifier]
+		if !ok {
+			log.Println("Ignoring requested action:", identifier)
+			return false
+		}
+
+		d.run(suiteFromCheckRun(event), false, func(ctx context.Context, _ Suite) {
+			handler(ctx, event)
+		})
+		return true
+
+	case "rerequested":
+		return d.rerun(event)
+
+	default:
+		log.Println("Ignoring check_run event:", event.GetAction())
+		return false
+	}
+}
+
+// rerun runs the job of the check run again for the same commit. Jobs create
+// new check runs of the same name, which replace the old one. It reports
+// whether the check run was known.
+func (d *Dispatcher) rerun(event *github.CheckRunEvent) bool {
+	suite := suiteFromCheckRun(event)
+	name := event.GetCheckRun().GetName()
+	appName := event.GetCheckRun().GetExternalID()
+
+	if job, ok := d.checks[name]; ok {
+		d.run(suite, false, job)
+		return true
+	}
+
+	if appName != "" && name == releaseCheckRunName(appName) {
+		d.run(suite, false, func(ctx context.Context, suite Suite) {
+			d.releaseApp(ctx, suite, appName)
+		})
+		return true
+	}
+
+	log.Println("Ignoring re-run of check run:", name)
+	return false
+}
+
+// run runs the job in the background, either superseding the jobs of other
+// commits of the branch or alongside those of its commit.
+func (d *Dispatcher) run(suite Suite, supersede bool, job Job) {
+	var ctx context.Context
+	var done func()
+	if supersede {
+		ctx, done = d.jobs.Supersede(suite)
+	} else {
+		ctx, done = d.jobs.Join(suite)
+	}
+
+	d.running.Add(1)
+	go func() {
+		defer d.running.Done()
+		defer done()
+		job(ctx, suite)
+	}()
+}
+
+// rerunApplicationRelease releases the application again under a new check
+// run.
+func (d *Dispatcher) rerunApplicationRelease(ctx context.Context, suite Suite, appName string) {
+	gh := d.svc.Client(suite.InstallationID)
+	checkRunID, err := createReleaseCheckRun(ctx, gh, suite, appName)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	RetryApplicationRelease(ctx, d.svc, suite, checkRunID, appName)
+}
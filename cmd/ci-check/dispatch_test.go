@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Manzanit0/go-github/v52/github"
+
+	"github.com/manzanit0/monocrat/events"
+)
+
+// fixture decodes the payload of the event from the bundled fixtures.
+func fixture[T any](t *testing.T, name string) *T {
+	t.Helper()
+
+	b, err := events.Fixtures.ReadFile(name)
+	if err != nil {
+		t.Fatalf("read fixture: %s", err)
+	}
+
+	var event T
+	if err := json.Unmarshal(b, &event); err != nil {
+		t.Fatalf("decode fixture: %s", err)
+	}
+
+	return &event
+}
+
+// started records the jobs the dispatcher starts instead of running them.
+type started struct {
+	mu   sync.Mutex
+	jobs []string
+}
+
+func (s *started) add(job string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, job)
+}
+
+// newRecordingDispatcher returns a dispatcher whose jobs and actions only get
+// recorded.
+func newRecordingDispatcher(buildOnPullRequest bool) (*Dispatcher, *started) {
+	s := &started{}
+	d := NewDispatcher(&Services{ReleaseConfig: &ReleaseConfig{BuildOnPullRequest: buildOnPullRequest}})
+
+	for name := range d.checks {
+		d.checks[name] = func(ctx context.Context, suite Suite) {
+			s.add(name)
+		}
+	}
+
+	d.releaseApp = func(ctx context.Context, suite Suite, appName string) {
+		s.add(releaseCheckRunName(appName))
+	}
+
+	for _, identifier := range []string{releaseAction, retryReleaseAction} {
+		d.RegisterAction(identifier, func(ctx context.Context, event *github.CheckRunEvent) {
+			s.add("action " + event.GetRequestedAction().Identifier)
+		})
+	}
+
+	return d, s
+}
+
+func TestDispatchCheckSuite(t *testing.T) {
+	tests := []struct {
+		name               string
+		action             string
+		buildOnPullRequest bool
+		jobs               []string
+	}{
+		{
+			name:   "requested",
+			action: "requested",
+			jobs:   []string{lintCheckRunName},
+		},
+		{
+			name:               "requested with builds on pull requests",
+			action:             "requested",
+			buildOnPullRequest: true,
+			jobs:               []string{buildCheckRunName, lintCheckRunName},
+		},
+		{
+			name:   "rerequested",
+			action: "rerequested",
+			jobs:   []string{lintCheckRunName},
+		},
+		{
+			name:   "completed",
+			action: "completed",
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			d, s := newRecordingDispatcher(tests[idx].buildOnPullRequest)
+
+			event := fixture[github.CheckSuiteEvent](t, "check_suite.requested.json")
+			event.Action = github.String(tests[idx].action)
+
+			handled := d.CheckSuite(event)
+			d.Wait()
+
+			if handled != (len(tests[idx].jobs) > 0) {
+				t.Fatalf("handled no match: %v", handled)
+			}
+
+			sort.Strings(s.jobs)
+			if !reflect.DeepEqual(s.jobs, tests[idx].jobs) {
+				t.Fatalf("jobs no match: %v", s.jobs)
+			}
+		})
+	}
+}
+
+func TestDispatchCheckRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     string
+		checkRun   string
+		externalID string
+		identifier string
+		jobs       []string
+	}{
+		{
+			name:     "re-run lint",
+			action:   "rerequested",
+			checkRun: lintCheckRunName,
+			jobs:     []string{lintCheckRunName},
+		},
+		{
+			name:     "re-run build",
+			action:   "rerequested",
+			checkRun: buildCheckRunName,
+			jobs:     []string{buildCheckRunName},
+		},
+		{
+			name:     "re-run release of every application",
+			action:   "rerequested",
+			checkRun: releaseAllCheckRunName,
+			jobs:     []string{releaseAllCheckRunName},
+		},
+		{
+			name:       "re-run release of an application",
+			action:     "rerequested",
+			checkRun:   "Release api",
+			externalID: "api",
+			jobs:       []string{"Release api"},
+		},
+		{
+			name:       "re-run release of another application",
+			action:     "rerequested",
+			checkRun:   "Release api",
+			externalID: "worker",
+		},
+		{
+			name:     "re-run unknown check run",
+			action:   "rerequested",
+			checkRun: "Vet",
+		},
+		{
+			name:       "release action",
+			action:     "requested_action",
+			checkRun:   buildCheckRunName,
+			identifier: releaseAction,
+			jobs:       []string{"action " + releaseAction},
+		},
+		{
+			name:       "retry release action",
+			action:     "requested_action",
+			checkRun:   "Release api",
+			externalID: "api",
+			identifier: retryReleaseAction,
+			jobs:       []string{"action " + retryReleaseAction},
+		},
+		{
+			name:       "unknown action",
+			action:     "requested_action",
+			checkRun:   buildCheckRunName,
+			identifier: "deploy",
+		},
+		{
+			name:     "created",
+			action:   "created",
+			checkRun: lintCheckRunName,
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			d, s := newRecordingDispatcher(false)
+
+			event := fixture[github.CheckRunEvent](t, "check_run.rerequested.json")
+			event.Action = github.String(tests[idx].action)
+			event.CheckRun.Name = github.String(tests[idx].checkRun)
+			event.CheckRun.ExternalID = github.String(tests[idx].externalID)
+			if tests[idx].identifier != "" {
+				event.RequestedAction = &github.RequestedAction{Identifier: tests[idx].identifier}
+			}
+
+			handled := d.CheckRun(event)
+			d.Wait()
+
+			if handled != (len(tests[idx].jobs) > 0) {
+				t.Fatalf("handled no match: %v", handled)
+			}
+
+			if !reflect.DeepEqual(s.jobs, tests[idx].jobs) {
+				t.Fatalf("jobs no match: %v", s.jobs)
+			}
+		})
+	}
+}
+
+func TestRegisterAction(t *testing.T) {
+	tests := []struct {
+		name       string
+		identifier string
+		panics     bool
+	}{
+		{
+			name:       "valid",
+			identifier: "deploy",
+		},
+		{
+			name:       "longest",
+			identifier: strings.Repeat("a", maxActionIdentifier),
+		},
+		{
+			name:       "empty",
+			identifier: "",
+			panics:     true,
+		},
+		{
+			name:       "too long",
+			identifier: strings.Repeat("a", maxActionIdentifier+1),
+			panics:     true,
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			d, _ := newRecordingDispatcher(false)
+
+			defer func() {
+				if r := recover(); (r != nil) != tests[idx].panics {
+					t.Fatalf("panic no match: %v", r)
+				}
+			}()
+
+			d.RegisterAction(tests[idx].identifier, func(ctx context.Context, event *github.CheckRunEvent) {})
+
+			if _, ok := d.actions[tests[idx].identifier]; !ok {
+				t.Fatalf("action not registered")
+			}
+		})
+	}
+}
+
+func TestRegisterActionReplaces(t *testing.T) {
+	d, s := newRecordingDispatcher(false)
+	d.RegisterAction(releaseAction, func(ctx context.Context, event *github.CheckRunEvent) {
+		s.add("replaced")
+	})
+
+	d.CheckRun(fixture[github.CheckRunEvent](t, "check_run.requested_action.json"))
+	d.Wait()
+
+	if !reflect.DeepEqual(s.jobs, []string{"replaced"}) {
+		t.Fatalf("jobs no match: %v", s.jobs)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/Manzanit0/go-github/v52/github"
+
+	ghapp "github.com/manzanit0/monocrat/pkg/github"
+)
+
+// SupersededError is the cause of the cancellation of jobs for a commit once
+// a newer one is pushed to the same branch.
+type SupersededError struct {
+	SHA string
+}
+
+func (e *SupersededError) Error() string {
+	return fmt.Sprintf("superseded by %s", e.SHA)
+}
+
+type jobKey struct {
+	repository string
+	branch     string
+}
+
+// jobGroup is all the jobs in flight for a commit of a branch.
+type jobGroup struct {
+	sha    string
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	jobs   int
+}
+
+// Jobs tracks the jobs in flight for every branch, so that a push cancels the
+// jobs of the commits it supersedes. It is safe for concurrent use.
+type Jobs struct {
+	mu     sync.Mutex
+	groups map[jobKey]*jobGroup
+}
+
+// NewJobs returns an empty tracker.
+func NewJobs() *Jobs {
+	return &Jobs{groups: map[jobKey]*jobGroup{}}
+}
+
+// Supersede starts a job for the head of the branch, cancelling the jobs of
+// any other commit of the branch. Call done once the job is over.
+func (j *Jobs) Supersede(suite Suite) (ctx context.Context, done func()) {
+	return j.start(suite, true)
+}
+
+// Join starts a job for a commit of the branch, along with the other jobs of
+// the commit. Jobs for commits superseded already run on their own, as they
+// were asked for explicitly. Call done once the job is over.
+func (j *Jobs) Join(suite Suite) (ctx context.Context, done func()) {
+	return j.start(suite, false)
+}
+
+func (j *Jobs) start(suite Suite, supersede bool) (context.Context, func()) {
+	// Without a branch, e.g. for tags, there is nothing to supersede.
+	if suite.HeadBranch == "" {
+		return context.Background(), func() {}
+	}
+
+	key := jobKey{repository: suite.Repo.GetFullName(), branch: suite.HeadBranch}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	group, ok := j.groups[key]
+	if ok && group.sha != suite.HeadSHA {
+		if !supersede {
+			return context.Background(), func() {}
+		}
+
+		log.Printf("[info] cancelling jobs for %s@%s, superseded by %s", key.repository, group.sha, suite.HeadSHA)
+		group.cancel(&SupersededError{SHA: suite.HeadSHA})
+		ok = false
+	}
+
+	if !ok {
+		ctx, cancel := context.WithCancelCause(context.Background())
+		group = &jobGroup{sha: suite.HeadSHA, ctx: ctx, cancel: cancel}
+		j.groups[key] = group
+	}
+
+	group.jobs++
+
+	var once sync.Once
+	return group.ctx, func() {
+		once.Do(func() {
+			j.mu.Lock()
+			defer j.mu.Unlock()
+
+			group.jobs--
+			if group.jobs == 0 && j.groups[key] == group {
+				delete(j.groups, key)
+				group.cancel(nil)
+			}
+		})
+	}
+}
+
+// superseded tells the commit superseding that of the job, if any.
+func superseded(ctx context.Context) (*SupersededError, bool) {
+	var err *SupersededError
+	if errors.As(context.Cause(ctx), &err) {
+		return err, true
+	}
+
+	return nil, false
+}
+
+// cancelIfSuperseded concludes the check run as cancelled if the job was
+// superseded, telling whether it was.
+func cancelIfSuperseded(ctx context.Context, gh ghapp.Client, suite Suite, checkRunID int64, name string, runLog *CheckRunLog) bool {
+	err, ok := superseded(ctx)
+	if !ok {
+		return false
+	}
+
+	summary := fmt.Sprintf("Cancelled, [%s](%s/commit/%s) was pushed since.", err.SHA, suite.Repo.GetHTMLURL(), err.SHA)
+	runLog.Complete("cancelled", summary, nil)
+
+	// The context of the job is done by now.
+	_, updateErr := gh.UpdateCheckRun(context.WithoutCancel(ctx),
+		suite.Owner(),
+		suite.Name(),
+		checkRunID,
+		github.UpdateCheckRunOptions{
+			Name:       name,
+			DetailsURL: runLog.DetailsURL(),
+			Status:     github.String("completed"),
+			Conclusion: github.String("cancelled"),
+			Output: &github.CheckRunOutput{
+				Title:   github.String(fmt.Sprintf("Superseded by %s", err.SHA)),
+				Summary: github.String(summary),
+				Text:    runLog.Text(),
+			},
+		})
+	if updateErr != nil {
+		log.Println("[error]", updateErr)
+	}
+
+	return true
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Manzanit0/go-github/v52/github"
+
+	ghapp "github.com/manzanit0/monocrat/pkg/github"
+	"github.com/manzanit0/monocrat/pkg/joblog"
+)
+
+const (
+	// logUpdateInterval is how often, at most, a check run gets the latest
+	// logs of its job.
+	logUpdateInterval = 10 * time.Second
+
+	// maxLogTail is how much of the end of the log makes it to the check run.
+	// The Checks API takes up to 65535 characters of output text.
+	maxLogTail = 60000
+
+	// logGCInterval is how often the jobs past their retention are removed.
+	logGCInterval = time.Hour
+)
+
+// LogStore keeps the logs and results of jobs, served behind signed links set
+// as the details of their check runs.
+type LogStore struct {
+	Store  *joblog.Store
+	Signer *joblog.Signer
+
+	// URL is the public URL of the server, which the jobs are linked from.
+	// Jobs are kept but not linked when empty.
+	URL string
+
+	// Retention is how long jobs are kept for.
+	Retention time.Duration
+}
+
+// LoadLogStore configures the log store from the environment. Jobs aren't
+// kept unless a directory is configured.
+func LoadLogStore() (*LogStore, error) {
+	directory := os.Getenv("MONOCRAT_LOG_DIRECTORY")
+	if directory == "" {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return nil, fmt.Errorf("create log directory: %w", err)
+	}
+
+	// Without a key of its own, links don't outlive the server.
+	key := []byte(os.Getenv("MONOCRAT_LOG_SIGNING_KEY"))
+	if len(key) == 0 {
+		log.Println("[info] MONOCRAT_LOG_SIGNING_KEY not set, links to logs expire on restart")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("generate log signing key: %w", err)
+		}
+	}
+
+	ttl := joblog.DefaultTTL
+	if v := os.Getenv("MONOCRAT_LOG_LINK_TTL"); v != "" {
+		var err error
+		ttl, err = time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid MONOCRAT_LOG_LINK_TTL %q", v)
+		}
+	}
+
+	// Jobs are of no use once their links expired.
+	retention := ttl
+	if v := os.Getenv("MONOCRAT_LOG_RETENTION"); v != "" {
+		var err error
+		retention, err = time.ParseDuration(v)
+		if err != nil || retention <= 0 {
+			return nil, fmt.Errorf("invalid MONOCRAT_LOG_RETENTION %q", v)
+		}
+	}
+
+	return &LogStore{
+		Store:     &joblog.Store{Directory: directory},
+		Signer:    &joblog.Signer{Key: key, TTL: ttl},
+		URL:       strings.TrimSuffix(os.Getenv("MONOCRAT_PUBLIC_URL"), "/"),
+		Retention: retention,
+	}, nil
+}
+
+// GC removes the jobs past their retention now and then every hour, until the
+// context is done. The store may be nil.
+func (s *LogStore) GC(ctx context.Context) {
+	if s == nil {
+		return
+	}
+
+	ticker := time.NewTicker(logGCInterval)
+	defer ticker.Stop()
+
+	for {
+		removed, err := s.Store.GC(time.Now().Add(-s.Retention))
+		if err != nil {
+			log.Println("[error]", err)
+		}
+		if removed > 0 {
+			log.Println("[info] removed", removed, "expired jobs")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Handler serves the jobs as HTML and JSON pages.
+func (s *LogStore) Handler() http.Handler {
+	return &joblog.Viewer{Store: s.Store, Signer: s.Signer}
+}
+
+// Start streams the log of a job into its check run until closed. The store
+// may be nil, in which case the log is only streamed.
+func (s *LogStore) Start(ctx context.Context, gh ghapp.Client, suite Suite, checkRunID int64, name, title string) *CheckRunLog {
+	l := &CheckRunLog{
+		gh:         gh,
+		suite:      suite,
+		checkRunID: checkRunID,
+		name:       name,
+		title:      title,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	if s != nil {
+		record, err := s.Store.Create(joblog.Job{
+			Name:       name,
+			Repository: suite.Repo.GetFullName(),
+			HeadSHA:    suite.HeadSHA,
+		})
+		if err != nil {
+			log.Println("[error]", err)
+		} else {
+			l.record = record
+			if s.URL != "" {
+				l.url = s.Signer.URL(s.URL, record.ID(), time.Now())
+			}
+		}
+	}
+
+	go l.stream(ctx)
+
+	return l
+}
+
+// CheckRunLog is the log of a job. It keeps the end of the log in the output
+// of the check run of the job, and the full log and result in the store.
+type CheckRunLog struct {
+	gh         ghapp.Client
+	suite      Suite
+	checkRunID int64
+	name       string
+	title      string
+	url        string
+
+	record *joblog.Record
+
+	mu    sync.Mutex
+	tail  []byte
+	dirty bool
+
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Write never fails, a broken log mustn't break the job.
+func (l *CheckRunLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.record != nil {
+		if _, err := l.record.Write(p); err != nil {
+			log.Println("[error] writing log:", err)
+			l.record = nil
+		}
+	}
+
+	l.tail = append(l.tail, p...)
+	if len(l.tail) > maxLogTail {
+		tail := l.tail[len(l.tail)-maxLogTail:]
+		if i := bytes.IndexByte(tail, '\n'); i >= 0 {
+			tail = tail[i+1:]
+		}
+		l.tail = append([]byte(nil), tail...)
+	}
+	l.dirty = true
+
+	return len(p), nil
+}
+
+// DetailsURL links to the page of the job, if stored and served.
+func (l *CheckRunLog) DetailsURL() *string {
+	if l == nil || l.url == "" {
+		return nil
+	}
+
+	return github.String(l.url)
+}
+
+// Text renders the end of the log for the output of the check run.
+func (l *CheckRunLog) Text() *string {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return logText(l.tail)
+}
+
+// Close stops streaming the log into the check run. The final update of the
+// check run is left to the job.
+func (l *CheckRunLog) Close() {
+	if l == nil {
+		return
+	}
+
+	l.once.Do(func() {
+		close(l.stop)
+		<-l.done
+	})
+}
+
+// Complete stops streaming the log and stores the outcome of the job, i.e. the
+// conclusion and summary of its check run and whatever it produced.
+func (l *CheckRunLog) Complete(conclusion, summary string, result any) {
+	if l == nil {
+		return
+	}
+
+	l.Close()
+
+	l.mu.Lock()
+	record := l.record
+	l.mu.Unlock()
+
+	if record == nil {
+		return
+	}
+
+	if err := record.Complete(conclusion, summary, result); err != nil {
+		log.Println("[error] storing job:", err)
+	}
+}
+
+func (l *CheckRunLog) stream(ctx context.Context) {
+	defer close(l.done)
+
+	ticker := time.NewTicker(logUpdateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.update(ctx)
+		}
+	}
+}
+
+// update puts the end of the log in the check run, if anything was logged
+// since the last update.
+func (l *CheckRunLog) update(ctx context.Context) {
+	l.mu.Lock()
+	if !l.dirty {
+		l.mu.Unlock()
+		return
+	}
+	text := logText(l.tail)
+	l.dirty = false
+	l.mu.Unlock()
+
+	_, err := l.gh.UpdateCheckRun(ctx,
+		l.suite.Owner(),
+		l.suite.Name(),
+		l.checkRunID,
+		github.UpdateCheckRunOptions{
+			Name:       l.name,
+			DetailsURL: l.DetailsURL(),
+			Output: &github.CheckRunOutput{
+				Title:   github.String(l.title),
+				Summary: github.String("In progress, the latest logs are below."),
+				Text:    text,
+			},
+		})
+	if err != nil {
+		log.Println("[error]", err)
+	}
+}
+
+func logText(tail []byte) *string {
+	if len(tail) == 0 {
+		return nil
+	}
+
+	return github.String(fmt.Sprintf("```\n%s\n```", strings.TrimRight(string(tail), "\n")))
+}
@@ -2,28 +2,32 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
-	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/Manzanit0/go-github/v52/github"
-	"github.com/bradleyfalzon/ghinstallation"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
+	"golang.org/x/sync/errgroup"
 
+	"github.com/manzanit0/monocrat/pkg/config"
+	"github.com/manzanit0/monocrat/pkg/gitcache"
+	ghapp "github.com/manzanit0/monocrat/pkg/github"
 	"github.com/manzanit0/monocrat/pkg/httpx"
 	"github.com/manzanit0/monocrat/pkg/image"
 	"github.com/manzanit0/monocrat/pkg/lint"
+	"github.com/manzanit0/monocrat/pkg/monorepo"
+	"github.com/manzanit0/monocrat/pkg/vuln"
+	"github.com/manzanit0/monocrat/pkg/webhook"
 )
 
 func main() {
@@ -37,27 +41,99 @@ func main() {
 		log.Fatal("[error] missing MONOCRAT_PRIVATE_KEY environment variable")
 	}
 
-	dockerHubUsername := os.Getenv("DOCKER_HUB_USERNAME")
-	if dockerHubUsername == "" {
-		log.Fatal("[error] missing DOCKER_HUB_USERNAME environment variable")
+	releaseConfig, err := LoadReleaseConfig()
+	if err != nil {
+		log.Fatal("[error] loading release configuration:", err)
 	}
 
-	dockerHubPassword := os.Getenv("DOCKER_HUB_PASSWORD")
-	if dockerHubUsername == "" {
-		log.Fatal("[error] missing DOCKER_HUB_PASSWORD environment variable")
-	}
+	// Builds connect to the engine on their own, yet share its caches.
+	builder := image.NewBuilder()
+	defer builder.Close()
 
-	tr := httpx.NewLoggingRoundTripper()
-	itr, err := ghinstallation.NewAppsTransport(tr, appID, privateKey)
+	// Installations are shared across webhooks, along with their tokens.
+	installations, err := ghapp.NewEnterpriseInstallations(os.Getenv("MONOCRAT_GITHUB_API_URL"), appID, privateKey)
 	if err != nil {
 		log.Fatalf("[error] create transport from private key: %s", err.Error())
 	}
+	installations.Publish("github_rate_limits")
+
+	logs, err := LoadLogStore()
+	if err != nil {
+		log.Fatalf("[error] loading log store: %s", err.Error())
+	}
+	go logs.GC(context.Background())
+
+	repositories, err := gitcache.FromEnv()
+	if err != nil {
+		log.Fatalf("[error] loading repository cache: %s", err.Error())
+	}
+
+	workspaces, err := LoadWorkspaces()
+	if err != nil {
+		log.Fatal("[error] loading workspaces:", err)
+	}
+	workspaces.Publish("workspaces")
 
+	// The worktrees of the workspaces removed are stale now.
+	if err := repositories.Prune(context.Background()); err != nil {
+		log.Println("[error]", err)
+	}
+
+	dispatcher := NewDispatcher(&Services{
+		Installations: installations,
+		ReleaseConfig: releaseConfig,
+		Builder:       builder,
+		Logs:          logs,
+		Repositories:  repositories,
+		Workspaces:    workspaces,
+	})
+
+	secret := os.Getenv("MONOCRAT_WEBHOOK_SECRET")
+	if secret == "" {
+		log.Println("[info] MONOCRAT_WEBHOOK_SECRET is empty: webhook signatures aren't verified")
+	}
+
+	r := NewRouter(dispatcher, secret, os.Getenv("MONOCRAT_WEBHOOK_CAPTURE_DIRECTORY"))
+
+	// Metrics stay off the public listener.
+	httpx.ServeAdmin(os.Getenv("MONOCRAT_ADMIN_ADDRESS"))
+
+	var port string
+	if port = os.Getenv("PORT"); port == "" {
+		port = "8080"
+	}
+
+	log.Println("[info] starting server on port", port)
+	if err := http.ListenAndServe(":"+port, r); err != nil {
+		log.Println("[error] ListenAndServe", err)
+	}
+}
+
+// webhookEvents are the events the webhook acts on.
+var webhookEvents = map[string]bool{
+	"check_suite":               true,
+	"check_run":                 true,
+	"installation":              true,
+	"installation_repositories": true,
+}
+
+// NewRouter returns the routes of the service, with the webhook dispatching
+// deliveries to the dispatcher. Deliveries must be signed with the secret
+// unless empty, and are captured to the directory unless empty. Those starting
+// jobs are accepted, and those ignored answered with no content.
+func NewRouter(dispatcher *Dispatcher, secret, captureDirectory string) http.Handler {
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 
-	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
-		payload, err := github.ValidatePayload(r, []byte{})
+	r.With(webhook.Verify(secret), webhook.Capture(captureDirectory)).Post("/", func(w http.ResponseWriter, r *http.Request) {
+		// Not every event parses, e.g. deployment_protection_rule.
+		if !webhookEvents[github.WebHookType(r)] {
+			log.Println("Ignoring event: not handled:", github.WebHookType(r))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		payload, err := github.ValidatePayload(r, []byte(secret))
 		if err != nil {
 			log.Println("[error] validate payload", err.Error())
 			w.WriteHeader(http.StatusInternalServerError)
@@ -81,28 +157,32 @@ func main() {
 			return
 		}
 
-	outer:
+		var handled bool
 		switch event := event.(type) {
 		case *github.CheckSuiteEvent:
-			if event.GetAction() == "created" {
-				go LintApplication(context.Background(), itr, event)
-				break outer
-			}
-
-			log.Println("Ignoring check_suite event:", event.GetAction())
+			handled = dispatcher.CheckSuite(event)
 
 		case *github.CheckRunEvent:
-			if event.GetAction() == "requested_action" {
-				go ReleaseApplication(context.Background(), itr, event, dockerHubUsername, dockerHubPassword)
-				break outer
-			}
+			handled = dispatcher.CheckRun(event)
 
-			log.Println("Ignoring check_run event:", event.GetAction())
+		// Tokens don't reflect the permissions nor the repositories granted
+		// since they were minted.
+		case *github.InstallationEvent:
+			dispatcher.svc.Evict(event.GetInstallation().GetID())
+			handled = true
+
+		case *github.InstallationRepositoriesEvent:
+			dispatcher.svc.Evict(event.GetInstallation().GetID())
+			handled = true
 
-		default:
-			log.Println("Ignoring event: not a check_run or check_suite")
 		}
 
+		if !handled {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
 		_, err = w.Write([]byte(""))
 		if err != nil {
 			log.Println("[error] writing reponse:", err.Error())
@@ -110,74 +190,67 @@ func main() {
 		}
 	})
 
-	var port string
-	if port = os.Getenv("PORT"); port == "" {
-		port = "8080"
+	if logs := dispatcher.svc.Logs; logs != nil {
+		r.Get("/jobs/{id}", logs.Handler().ServeHTTP)
 	}
 
-	log.Println("[info] starting server on port", port)
-	if err := http.ListenAndServe(":"+port, r); err != nil {
-		log.Println("[error] ListenAndServe", err)
-	}
+	return r
 }
 
-func LintApplication(ctx context.Context, itr *ghinstallation.AppsTransport, event *github.CheckSuiteEvent) {
-	gh := github.NewClient(&http.Client{Transport: ghinstallation.NewFromAppsTransport(itr, event.GetInstallation().GetID())})
-	lintCheckRun, res, err := gh.Checks.CreateCheckRun(ctx, event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName(), github.CreateCheckRunOptions{
-		Name:    "Lint",
-		HeadSHA: event.GetCheckSuite().GetHeadSHA(),
+func LintApplication(ctx context.Context, svc *Services, suite Suite) {
+	gh := svc.Client(suite.InstallationID)
+	tokens := ghapp.ClientTokens(gh)
+	lintCheckRun, err := gh.CreateCheckRun(ctx, suite.Owner(), suite.Name(), github.CreateCheckRunOptions{
+		Name:    lintCheckRunName,
+		HeadSHA: suite.HeadSHA,
 	})
 	if err != nil {
-		err = toErr(res)
 		log.Println("[error]", err)
 		return
 	}
 
-	repositoryDirectory, err := CloneAndCheckout(event.GetRepo().GetCloneURL(), event.CheckSuite.GetHeadCommit().GetSHA())
-	defer func() {
-		log.Println("Deleting temp dir")
-		err = os.RemoveAll(repositoryDirectory)
-		if err != nil {
-			panic(err)
-		}
-	}()
+	runLog := svc.Logs.Start(ctx, gh, suite, lintCheckRun.GetID(), lintCheckRunName, "Running linters")
+	defer runLog.Close()
+
+	checkout, err := svc.Checkout(ctx, tokens, suite, suite.HeadSHA)
+	if err != nil {
+		log.Println("[error]", err)
+		failLint(ctx, gh, suite, lintCheckRun.GetID(), runLog, err)
+		return
+	}
+	defer checkout.Close()
 
-	modules, _, err := FindGoModules(repositoryDirectory)
+	modules, _, err := monorepo.FindGoModules(checkout.Path)
 	if err != nil {
 		log.Println("[error]", err)
+		failLint(ctx, gh, suite, lintCheckRun.GetID(), runLog, err)
 		return
 	}
 
 	var issues []lint.Issue
 	for _, modulePath := range modules {
 		modulePath := filepath.Dir(modulePath)
-		report, err := lint.Lint(ctx, modulePath)
+		report, err := svc.lint(ctx, modulePath, runLog)
 		if err != nil {
-			log.Println("[error]", err)
-			_, res, err := gh.Checks.UpdateCheckRun(ctx,
-				event.GetRepo().GetOwner().GetLogin(),
-				event.GetRepo().GetName(),
-				lintCheckRun.GetID(),
-				github.UpdateCheckRunOptions{
-					Name:       "Lint",
-					Status:     github.String("completed"),
-					Conclusion: github.String("failure"),
-					Output: &github.CheckRunOutput{
-						Title:   github.String("Failed to run linters"),
-						Summary: github.String(fmt.Sprintf("failed to run linters: %s", err.Error())),
-					},
-				})
-			if err != nil {
-				err = toErr(res)
-				log.Println("[error]", err)
+			if cancelIfSuperseded(ctx, gh, suite, lintCheckRun.GetID(), lintCheckRunName, runLog) {
+				return
 			}
+
+			log.Println("[error]", err)
+			failLint(ctx, gh, suite, lintCheckRun.GetID(), runLog, err)
 			return
 		}
 
 		issues = append(issues, report.Issues...)
 	}
 
+	if cancelIfSuperseded(ctx, gh, suite, lintCheckRun.GetID(), lintCheckRunName, runLog) {
+		return
+	}
+
 	if len(issues) > 0 {
+		runLog.Complete("failure", "Linter failed", issues)
+
 		var annotations []*github.CheckRunAnnotation
 		for _, issue := range issues {
 			if issue.Text == "" {
@@ -196,286 +269,347 @@ func LintApplication(ctx context.Context, itr *ghinstallation.AppsTransport, eve
 			})
 		}
 
-		_, res, err := gh.Checks.UpdateCheckRun(ctx,
-			event.GetRepo().GetOwner().GetLogin(),
-			event.GetRepo().GetName(),
+		_, err := gh.UpdateCheckRun(ctx,
+			suite.Owner(),
+			suite.Name(),
 			lintCheckRun.GetID(),
 			github.UpdateCheckRunOptions{
-				Name:       "Lint",
+				Name:       lintCheckRunName,
+				DetailsURL: runLog.DetailsURL(),
 				Status:     github.String("completed"),
 				Conclusion: github.String("failure"),
 				Output: &github.CheckRunOutput{
 					Title:       github.String("Linter failed"),
 					Summary:     github.String("Linter failed"),
+					Text:        runLog.Text(),
 					Annotations: annotations,
 				},
 			})
 		if err != nil {
-			err = toErr(res)
 			log.Println("[error]", err)
 		}
 		return
 	}
 
-	_, res, err = gh.Checks.UpdateCheckRun(ctx,
-		event.GetRepo().GetOwner().GetLogin(),
-		event.GetRepo().GetName(),
+	runLog.Complete("success", "No issues found.", nil)
+
+	_, err = gh.UpdateCheckRun(ctx,
+		suite.Owner(),
+		suite.Name(),
 		lintCheckRun.GetID(),
 		github.UpdateCheckRunOptions{
-			Name:       "Lint",
+			Name:       lintCheckRunName,
+			DetailsURL: runLog.DetailsURL(),
 			Status:     github.String("completed"),
 			Conclusion: github.String("success"),
+			Output: &github.CheckRunOutput{
+				Title:   github.String("Linter passed"),
+				Summary: github.String("No issues found."),
+				Text:    runLog.Text(),
+			},
 			Actions: []*github.CheckRunAction{
 				{
 					Label:       "Release application",
 					Description: "Build and push",
-					Identifier:  "release_image",
+					Identifier:  releaseAction,
 				},
 			},
 		})
 	if err != nil {
-		err = toErr(res)
 		log.Println("[error]", err)
 	}
 }
 
-func ReleaseApplication(ctx context.Context, itr *ghinstallation.AppsTransport, event *github.CheckRunEvent, dockerHubUsername, dockerHubPassword string) {
-	gh := github.NewClient(&http.Client{Transport: ghinstallation.NewFromAppsTransport(itr, event.GetInstallation().GetID())})
-	releaseCheckRun, res, err := gh.Checks.CreateCheckRun(ctx,
-		event.GetRepo().GetOwner().GetLogin(),
-		event.GetRepo().GetName(),
+// failLint concludes the lint check run as failed to run the linters at all.
+func failLint(ctx context.Context, gh ghapp.Client, suite Suite, checkRunID int64, runLog *CheckRunLog, lintErr error) {
+	summary := fmt.Sprintf("failed to run linters: %s", lintErr.Error())
+	runLog.Complete("failure", summary, nil)
+
+	_, err := gh.UpdateCheckRun(ctx,
+		suite.Owner(),
+		suite.Name(),
+		checkRunID,
+		github.UpdateCheckRunOptions{
+			Name:       lintCheckRunName,
+			DetailsURL: runLog.DetailsURL(),
+			Status:     github.String("completed"),
+			Conclusion: github.String("failure"),
+			Output: &github.CheckRunOutput{
+				Title:   github.String("Failed to run linters"),
+				Summary: github.String(summary),
+				Text:    runLog.Text(),
+			},
+		})
+	if err != nil {
+		log.Println("[error]", err)
+	}
+}
+
+// BuildApplication builds the images of the changed applications without
+// pushing them, to prove they build before anyone releases them.
+func BuildApplication(ctx context.Context, svc *Services, suite Suite) {
+	releaseConfig := svc.ReleaseConfig
+	gh := svc.Client(suite.InstallationID)
+	tokens := ghapp.ClientTokens(gh)
+	buildCheckRun, err := gh.CreateCheckRun(ctx,
+		suite.Owner(),
+		suite.Name(),
 		github.CreateCheckRunOptions{
-			Name:    "Release application",
-			HeadSHA: event.GetCheckRun().GetHeadSHA(),
+			Name:    buildCheckRunName,
+			HeadSHA: suite.HeadSHA,
 			Status:  github.String("in_progress"),
 		})
 	if err != nil {
-		err = toErr(res)
 		log.Println("[error]", err)
 		return
 	}
-	err = BuildAndPushChangedApplications(
-		ctx,
-		event.GetRepo().GetCloneURL(),
-		event.GetCheckRun().GetCheckSuite().GetBeforeSHA(),
-		event.GetCheckRun().GetCheckSuite().GetAfterSHA(),
-		dockerHubUsername,
-		dockerHubPassword,
-	)
+
+	runLog := svc.Logs.Start(ctx, gh, suite, buildCheckRun.GetID(), buildCheckRunName, "Building applications")
+	defer runLog.Close()
+
+	build := &Build{}
+	privateModules, err := releaseConfig.PrivateModules(ctx, tokens, suite.Owner())
+	if err == nil {
+		var checkout *Checkout
+		checkout, err = svc.Checkout(ctx, tokens, suite, suite.AfterSHA, suite.BeforeSHA)
+		if err == nil {
+			defer checkout.Close()
+			build, err = BuildChangedApplications(
+				ctx,
+				svc.Builder,
+				checkout,
+				suite.Repo.GetCloneURL(),
+				suite.BeforeSHA,
+				suite.AfterSHA,
+				privateModules,
+				releaseConfig,
+				runLog,
+			)
+		}
+	}
+	runLog.Close()
+
+	if cancelIfSuperseded(ctx, gh, suite, buildCheckRun.GetID(), buildCheckRunName, runLog) {
+		return
+	}
+
+	opts := github.UpdateCheckRunOptions{
+		Name:       buildCheckRunName,
+		DetailsURL: runLog.DetailsURL(),
+		Status:     github.String("completed"),
+		Conclusion: github.String("success"),
+		Output: &github.CheckRunOutput{
+			Title:       github.String(fmt.Sprintf("Built %d applications", len(build.Exports))),
+			Summary:     github.String(BuildSummary(build.Exports, releaseConfig.ExportDirectory != "")),
+			Text:        runLog.Text(),
+			Annotations: build.Annotations,
+		},
+	}
 	if err != nil {
 		log.Println("[error]", err)
-		_, res, err := gh.Checks.UpdateCheckRun(context.Background(),
-			event.GetRepo().GetOwner().GetLogin(),
-			event.GetRepo().GetName(),
-			releaseCheckRun.GetID(),
-			github.UpdateCheckRunOptions{
-				Name:       "Release application",
-				Status:     github.String("completed"),
-				Conclusion: github.String("failure"),
-				Actions: []*github.CheckRunAction{
-					{
-						Label:       "Retry release",
-						Description: "Retry build and push",
-						Identifier:  "release_image_retry",
-					},
-				},
-			})
-		if err != nil {
-			err = toErr(res)
-			log.Println("[error]", err)
-			return
-		}
+		opts.Conclusion = github.String("failure")
+		opts.Output.Title = github.String("Build failed")
+		opts.Output.Summary = github.String(err.Error())
 	}
 
-	_, res, err = gh.Checks.UpdateCheckRun(ctx,
-		event.GetRepo().GetOwner().GetLogin(),
-		event.GetRepo().GetName(),
-		releaseCheckRun.GetID(),
-		github.UpdateCheckRunOptions{
-			Name:       "Release application",
-			Status:     github.String("completed"),
-			Conclusion: github.String("success"),
-		})
+	runLog.Complete(*opts.Conclusion, *opts.Output.Summary, build.Exports)
+
+	_, err = gh.UpdateCheckRun(ctx,
+		suite.Owner(),
+		suite.Name(),
+		buildCheckRun.GetID(),
+		opts)
 	if err != nil {
-		err = toErr(res)
 		log.Println("[error]", err)
 	}
 }
 
-func toErr(res *github.Response) error {
-	var errResp github.ErrorResponse
-	dec := json.NewDecoder(res.Body)
-	if err := dec.Decode(&errResp); err != nil && err != io.EOF {
-		return fmt.Errorf("unmarshal body: %w", err)
-	}
+// Build is the outcome of building the changed applications without pushing
+// them.
+type Build struct {
+	// Exports are the images exported as tarballs, keyed by application name.
+	Exports map[string]*image.Export
 
-	return fmt.Errorf("%s: %s", errResp.Message, errResp.Errors)
+	// Annotations point at the vulnerable dependencies of the applications.
+	Annotations []*github.CheckRunAnnotation
 }
 
-func BuildAndPushChangedApplications(ctx context.Context, remote, beforeCommitSHA, afterCommitSHA, dockerHubUsername, dockerHubPassword string) error {
-	repositoryPath, err := CloneAndCheckout(remote, beforeCommitSHA)
-	if err != nil {
-		return fmt.Errorf("clone repository: %w", err)
-	}
-
-	defer func() {
-		err = os.RemoveAll(repositoryPath)
+// BuildChangedApplications builds the images of all the applications affected
+// by the changes between both commits, checked out at the latter, without
+// pushing them. The images are exported to the export directory if
+// configured, or to the workspace of the checkout to be discarded otherwise.
+// The logs of the builds go to w.
+func BuildChangedApplications(ctx context.Context, builder *image.Builder, checkout *Checkout, remote, beforeCommitSHA, afterCommitSHA string, privateModules *image.PrivateModules, releaseConfig *ReleaseConfig, w io.Writer) (*Build, error) {
+	build := &Build{Exports: map[string]*image.Export{}}
+	repositoryPath := checkout.Path
+
+	var err error
+	exportDirectory := releaseConfig.ExportDirectory
+	if exportDirectory == "" {
+		exportDirectory, err = checkout.Workspace.Dir("export")
 		if err != nil {
-			panic(err)
+			return build, err
 		}
-	}()
+	}
 
-	changedFiles, err := GetChangedFiles(repositoryPath, beforeCommitSHA, afterCommitSHA)
+	apps, err := ChangedApplications(ctx, checkout.Worktree, beforeCommitSHA, afterCommitSHA, releaseConfig)
 	if err != nil {
-		return fmt.Errorf("get changed files: %w", err)
+		return build, err
 	}
 
-	// Let's find All the Go modules and runnable applications in the
-	// cloned repository.
-	modules, applications, err := FindGoModules(repositoryPath)
+	cfg, err := config.Load(repositoryPath)
 	if err != nil {
-		return fmt.Errorf("find Go modules and runnable apps: %w", err)
+		return build, fmt.Errorf("load repository configuration: %w", err)
+	}
+
+	if err := checkout.WidenForDockerfiles(ctx, cfg, apps); err != nil {
+		return build, err
 	}
 
-	// Now that we have (1) changed files, (2) Go modules and (3) runnable
-	// applications, we can just cross-check the data to find out all the
-	// applications that need rebuilding based on if the changed file happened
-	// in a module with runnable applications.
-	// We'd want to rebuild all the apps in a module with a change.
-	appsToRebuild, modulesToVendor := GetAppsToRebuild(changedFiles, modules, applications)
+	var mu sync.Mutex
+	err = forEachApplication(ctx, apps, releaseConfig.Concurrency, func(ctx context.Context, app monorepo.Application) error {
+		log.Println("build", app.Name, app.Directory)
 
-	// Let's vendor the dependencies because this will just get trickier inside
-	// a container due to the private repositories.
-	for modulePath := range modulesToVendor {
-		err = VendorGoModule(ctx, modulePath)
-		if err != nil {
-			return fmt.Errorf("vendor module %s: %w", modulePath, err)
+		opts := applicationBuildOptions(app, repositoryPath, remote, afterCommitSHA, cfg, privateModules, releaseConfig)
+		opts.Log = w
+		export, err := builder.Build(ctx, opts, exportDirectory)
+
+		var findings []vuln.Finding
+		if export != nil {
+			findings = export.Vulnerabilities
 		}
-	}
+		annotations := scanAnnotations(repositoryPath, app, releaseConfig.Scan, findings, err)
 
-	// Now let's build images for all those nice apps and push them to Docker Hub.
-	for app := range appsToRebuild {
-		appName, appRelativeDirectory := GetAppNameAndDirectory(repositoryPath, app)
-		log.Println("build and push", appName, appRelativeDirectory)
+		mu.Lock()
+		defer mu.Unlock()
 
-		err := image.BuildAndPush(ctx, &image.BuildAndPushOptions{
-			DockerHubUsername:   dockerHubUsername,
-			DockerHubPassword:   dockerHubPassword,
-			DockerHubRepository: fmt.Sprintf("monocrat-%s", appName),
-			RepositoryDirectory: repositoryPath,
-			AppVersion:          "1.2.3",
-			AppDirectory:        appRelativeDirectory,
-		})
+		build.Annotations = append(build.Annotations, annotations...)
 		if err != nil {
-			return fmt.Errorf("build and push all things: %w", err)
+			return fmt.Errorf("build %s: %w", app.Name, err)
 		}
-	}
 
-	return nil
+		log.Println("[info] built", export.Path)
+		build.Exports[app.Name] = export
+		return nil
+	})
+
+	return build, err
 }
 
-func CloneAndCheckout(remote, commit string) (string, error) {
-	local, err := os.MkdirTemp("", "temp-repository")
+// ChangedApplications returns the applications affected by the changes
+// between both commits, sorted by name.
+func ChangedApplications(ctx context.Context, worktree *gitcache.Worktree, beforeCommitSHA, afterCommitSHA string, releaseConfig *ReleaseConfig) ([]monorepo.Application, error) {
+	changedFiles, err := GetChangedFiles(ctx, worktree, beforeCommitSHA, afterCommitSHA)
 	if err != nil {
-		return "", fmt.Errorf("create temp directory: %w", err)
+		return nil, fmt.Errorf("get changed files: %w", err)
 	}
 
-	r, err := git.PlainClone(local, false, &git.CloneOptions{
-		URL: remote,
-	})
+	apps, modulesToVendor, err := monorepo.ChangedApplications(worktree.Path, changedFiles)
 	if err != nil {
-		return "", fmt.Errorf("git clone: %w", err)
+		return nil, err
 	}
 
-	w, err := r.Worktree()
-	if err != nil {
-		return "", fmt.Errorf("worktree: %w", err)
+	// Builds fetch the private modules themselves, but vendoring on the host
+	// is still around for those who prefer it.
+	if releaseConfig.Vendor {
+		for _, modulePath := range modulesToVendor {
+			err = VendorGoModule(ctx, modulePath)
+			if err != nil {
+				return nil, fmt.Errorf("vendor module %s: %w", modulePath, err)
+			}
+		}
 	}
 
-	err = w.Checkout(&git.CheckoutOptions{
-		Hash: plumbing.NewHash(commit),
-	})
-	if err != nil {
-		return "", fmt.Errorf("checkout: %w", err)
+	return apps, nil
+}
+
+// forEachApplication runs fn for every application, at most concurrency of
+// them at the same time. It stops at the first error.
+func forEachApplication(ctx context.Context, apps []monorepo.Application, concurrency int, fn func(context.Context, monorepo.Application) error) error {
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for _, app := range apps {
+		g.Go(func() error {
+			return fn(ctx, app)
+		})
 	}
 
-	return local, nil
+	return g.Wait()
 }
 
-func GetChangedFiles(repositoryPath, beforeCommitSHA, afterCommitSHA string) ([]string, error) {
-	r, err := git.PlainOpen(repositoryPath)
-	if err != nil {
-		return nil, fmt.Errorf("open repository: %w", err)
+// applicationBuildOptions returns how to build the image of the application
+// at the commit. Registries are left for the caller.
+func applicationBuildOptions(app monorepo.Application, repositoryPath, remote, commitSHA string, cfg *config.Config, privateModules *image.PrivateModules, releaseConfig *ReleaseConfig) *image.BuildAndPushOptions {
+	return &image.BuildAndPushOptions{
+		Repository:          app.ImageRepository(),
+		RepositoryDirectory: repositoryPath,
+		AppVersion:          commitSHA,
+		AppDirectory:        app.Directory,
+		Platforms:           releaseConfig.Platforms,
+		Profile:             cfg.BuildProfile(app.Name),
+		Dockerfile:          cfg.Dockerfile(app.Name),
+		PrivateModules:      privateModules,
+		Attest: &image.AttestOptions{
+			SBOMFormat: releaseConfig.SBOMFormat,
+			Repository: remote,
+			SHA:        commitSHA,
+		},
+		Scan:       releaseConfig.Scan,
+		SigningKey: releaseConfig.SigningKey,
 	}
+}
 
-	beforeCommit, err := r.CommitObject(plumbing.NewHash(beforeCommitSHA))
-	if err != nil {
-		return nil, fmt.Errorf("get head commit: %w", err)
+// BuildSummary renders the images built for every application as markdown
+// for the check run output, and where they were exported to if kept.
+func BuildSummary(exports map[string]*image.Export, kept bool) string {
+	if len(exports) == 0 {
+		return "No applications changed."
 	}
 
-	afterCommit, err := r.CommitObject(plumbing.NewHash(afterCommitSHA))
-	if err != nil {
-		return nil, fmt.Errorf("get merged commit: %w", err)
+	appNames := make([]string, 0, len(exports))
+	for appName := range exports {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+
+	var b strings.Builder
+	for _, appName := range appNames {
+		export := exports[appName]
+		fmt.Fprintf(&b, "### %s\n\n", appName)
+		fmt.Fprintf(&b, "Built for %s.\n\n", strings.Join(export.Platforms, ", "))
+		if kept {
+			fmt.Fprintf(&b, "Exported to `%s`.\n\n", export.Path)
+		}
+		if len(export.Vulnerabilities) > 0 {
+			fmt.Fprintf(&b, "%d known vulnerabilities below the failure threshold, see the annotations on go.mod.\n\n", len(export.Vulnerabilities))
+		}
 	}
 
-	if beforeCommit.Hash.String() == afterCommit.Hash.String() {
+	return b.String()
+}
+
+// GetChangedFiles returns the absolute paths of the files changed between
+// both commits, which must have been fetched into the worktree's repository.
+func GetChangedFiles(ctx context.Context, worktree *gitcache.Worktree, beforeCommitSHA, afterCommitSHA string) ([]string, error) {
+	if beforeCommitSHA == afterCommitSHA {
 		log.Println("same commit has HEAD; nothing to do")
 		return []string{}, nil
 	}
 
-	patch, err := beforeCommit.Patch(afterCommit)
+	files, err := worktree.ChangedFiles(ctx, beforeCommitSHA, afterCommitSHA)
 	if err != nil {
-		return nil, fmt.Errorf("get git patch: %w", err)
+		return nil, fmt.Errorf("get changed files: %w", err)
 	}
 
-	var changedFiles []string
-	for _, filePatch := range patch.FilePatches() {
-		from, to := filePatch.Files()
-
-		switch {
-		case to != nil:
-			abs := filepath.Join(repositoryPath, to.Path())
-			changedFiles = append(changedFiles, abs)
-			log.Println("created/updated:", to.Path())
-
-		case from != nil:
-			abs := filepath.Join(repositoryPath, from.Path())
-			changedFiles = append(changedFiles, abs)
-			log.Println("deleted:", from.Path())
-
-		default:
-			return nil, fmt.Errorf("awkward change: %w", err)
-		}
+	changedFiles := make([]string, 0, len(files))
+	for _, file := range files {
+		log.Println("changed:", file)
+		changedFiles = append(changedFiles, filepath.Join(worktree.Path, file))
 	}
 
 	return changedFiles, nil
 }
 
-func FindGoModules(repositoryPath string) (modules []string, applications []string, err error) {
-	err = filepath.WalkDir(repositoryPath, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return fmt.Errorf("checking directory entry: %w", err)
-		}
-
-		if d.Name() == ".git" || d.Name() == ".github" {
-			return filepath.SkipDir
-		}
-
-		if !d.IsDir() && d.Name() == "go.mod" {
-			modules = append(modules, path)
-			return nil
-		}
-
-		if !d.IsDir() && d.Name() == "main.go" {
-			applications = append(applications, path)
-			return nil
-		}
-
-		return nil
-	})
-	return
-}
-
 // VendorGoModule mod vendor for the module.
 // modulePath should be of form "/foo/bar/baz", it being a directory, not the
 // reference to the go.mod file.
@@ -489,47 +623,3 @@ func VendorGoModule(ctx context.Context, modulePath string) error {
 
 	return nil
 }
-
-// GetAppsToRebuild cross-checks the files changed, the available Go modules and
-// applications and computes which modules to vendor and which applications to
-// compile based on the changes.
-//
-// Modules and applications should be of the form "/foo/bar/go.mod" and
-// "/foo/bar/main.go", thus being references to the actual files, not the
-// directories.
-func GetAppsToRebuild(changedFiles []string, modules []string, applications []string) (map[string]interface{}, map[string]interface{}) {
-	appsToRebuild := map[string]interface{}{}
-	modulesToVendor := map[string]interface{}{}
-
-	for _, module := range modules {
-		moduleDir := filepath.Dir(module)
-		for _, app := range applications {
-			if strings.Contains(app, moduleDir) {
-				for _, change := range changedFiles {
-					if strings.Contains(change, moduleDir) {
-						modulesToVendor[moduleDir] = nil
-						appsToRebuild[app] = nil
-					}
-				}
-			}
-		}
-	}
-
-	return appsToRebuild, modulesToVendor
-}
-
-// GetAppNameAndDirectory extracts the application's directory relative to the
-// repository and the application's name. It assumes that the application's name
-// is the directory just above the main.go file.
-//
-// Both repositoryPath and appPath are expected to be absolute paths, appPath
-// being the path to the main.go file.
-func GetAppNameAndDirectory(repositoryPath, appPath string) (string, string) {
-	separator := fmt.Sprintf("%c", filepath.Separator)
-	split := strings.Split(appPath, separator)
-	appName := split[len(split)-2 : len(split)-1][0]
-	appName = strings.ReplaceAll(appName, "_", "-")
-	appRelativeDirectory := strings.Split(appPath, repositoryPath)[1]
-	appRelativeDirectory = strings.TrimPrefix(appRelativeDirectory, separator)
-	return appName, appRelativeDirectory
-}
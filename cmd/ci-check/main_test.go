@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Manzanit0/go-github/v52/github"
+
+	"github.com/manzanit0/monocrat/events"
+	"github.com/manzanit0/monocrat/pkg/gitcache"
+	ghapp "github.com/manzanit0/monocrat/pkg/github"
+	"github.com/manzanit0/monocrat/pkg/github/fake"
+	"github.com/manzanit0/monocrat/pkg/image"
+	"github.com/manzanit0/monocrat/pkg/lint"
+	"github.com/manzanit0/monocrat/pkg/webhook"
+	"github.com/manzanit0/monocrat/pkg/workspace"
+)
+
+// newRemote creates a repository with a module holding the api application,
+// returning its URL and the SHAs of the commit adding it and of the one
+// changing it.
+func newRemote(t *testing.T) (string, string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	run := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Jane", "GIT_AUTHOR_EMAIL=jane@example.com",
+			"GIT_COMMITTER_NAME=Jane", "GIT_COMMITTER_EMAIL=jane@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s: %s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	write := func(name, content string) {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatalf("create remote: %s", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("create remote: %s", err)
+		}
+	}
+
+	run("init", "--quiet")
+	run("config", "uploadpack.allowFilter", "true")
+	run("config", "uploadpack.allowAnySHA1InWant", "true")
+
+	write("api/go.mod", "module example.com/api\n\ngo 1.22\n")
+	write("api/main.go", "package main\n")
+	write("docs/index.md", "# Docs\n")
+	run("add", ".")
+	run("commit", "--quiet", "-m", "Add api")
+	before := run("rev-parse", "HEAD")
+
+	write("api/main.go", "package main\n\nfunc main() {}\n")
+	run("commit", "--quiet", "-am", "Fix api")
+	after := run("rev-parse", "HEAD")
+
+	return "file://" + dir, before, after
+}
+
+// newSuite returns the suite of the check_suite fixture, for the commits of
+// the remote.
+func newSuite(t *testing.T, remote, before, after string) Suite {
+	t.Helper()
+
+	event := fixture[github.CheckSuiteEvent](t, "check_suite.requested.json")
+	event.Repo.CloneURL = github.String(remote)
+	event.CheckSuite.HeadSHA = github.String(after)
+	event.CheckSuite.BeforeSHA = github.String(before)
+	event.CheckSuite.AfterSHA = github.String(after)
+
+	return suiteFromCheckSuite(event)
+}
+
+// newServices returns the services of jobs acting against the fake, with the
+// linter reporting the issues.
+func newServices(t *testing.T, s *fake.Server, issues ...lint.Issue) *Services {
+	t.Helper()
+
+	installations, err := s.Installations()
+	if err != nil {
+		t.Fatalf("new installations: %s", err)
+	}
+
+	builder := image.NewBuilder()
+	t.Cleanup(func() { builder.Close() })
+
+	return &Services{
+		Clients: func(installationID int64) ghapp.Client {
+			return installations.Get(installationID).Client()
+		},
+		Lint: func(ctx context.Context, directory string, w io.Writer) (*lint.Result, error) {
+			return &lint.Result{Issues: issues}, nil
+		},
+		ReleaseConfig: &ReleaseConfig{Concurrency: 1},
+		Builder:       builder,
+		Repositories:  &gitcache.Cache{Directory: t.TempDir()},
+		Workspaces:    &workspace.Manager{Root: t.TempDir()},
+	}
+}
+
+// checkRun returns the only check run of the repository of the fixtures.
+func checkRun(t *testing.T, s *fake.Server) fake.CheckRun {
+	t.Helper()
+
+	checkRuns := s.CheckRuns("Manzanit0/gitops-env-per-folder-poc")
+	if len(checkRuns) != 1 {
+		t.Fatalf("check runs no match: %+v", checkRuns)
+	}
+
+	return checkRuns[0]
+}
+
+func TestLintApplication(t *testing.T) {
+	remote, before, after := newRemote(t)
+
+	issue := lint.Issue{FromLinter: "unused", Text: "func unused is unused"}
+	issue.Pos.Filename = "api/main.go"
+	issue.Pos.Line = 3
+
+	tests := []struct {
+		name        string
+		issues      []lint.Issue
+		conclusion  string
+		title       string
+		annotations int
+		actions     int
+	}{
+		{
+			name:       "no issues",
+			conclusion: "success",
+			title:      "Linter passed",
+			actions:    1,
+		},
+		{
+			name:        "issues",
+			issues:      []lint.Issue{issue},
+			conclusion:  "failure",
+			title:       "Linter failed",
+			annotations: 1,
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			s := fake.NewServer(t)
+			svc := newServices(t, s, tests[idx].issues...)
+
+			var linted []string
+			lintModule := svc.Lint
+			svc.Lint = func(ctx context.Context, directory string, w io.Writer) (*lint.Result, error) {
+				linted = append(linted, filepath.Base(directory))
+
+				// Only the modules are checked out.
+				if _, err := os.Stat(filepath.Join(directory, "..", "docs")); !os.IsNotExist(err) {
+					t.Errorf("expected docs not to be checked out: %v", err)
+				}
+
+				return lintModule(ctx, directory, w)
+			}
+
+			LintApplication(context.Background(), svc, newSuite(t, remote, before, after))
+
+			got := checkRun(t, s)
+			if got.Name != lintCheckRunName || got.HeadSHA != after || got.Status != "completed" || got.Conclusion != tests[idx].conclusion || got.Title != tests[idx].title {
+				t.Fatalf("check run no match: %+v", got)
+			}
+
+			if len(got.Annotations) != tests[idx].annotations || len(got.Actions) != tests[idx].actions {
+				t.Fatalf("annotations or actions no match: %+v", got)
+			}
+
+			if len(got.Actions) > 0 && got.Actions[0].Identifier != releaseAction {
+				t.Fatalf("action no match: %+v", got.Actions[0])
+			}
+
+			if len(linted) != 1 || linted[0] != "api" {
+				t.Fatalf("linted modules no match: %v", linted)
+			}
+		})
+	}
+}
+
+func TestFailLint(t *testing.T) {
+	remote, before, after := newRemote(t)
+	s := fake.NewServer(t)
+	svc := newServices(t, s)
+	svc.Lint = func(ctx context.Context, directory string, w io.Writer) (*lint.Result, error) {
+		return nil, errors.New("golangci-lint: executable file not found")
+	}
+
+	LintApplication(context.Background(), svc, newSuite(t, remote, before, after))
+
+	got := checkRun(t, s)
+	if got.Status != "completed" || got.Conclusion != "failure" || got.Title != "Failed to run linters" {
+		t.Fatalf("check run no match: %+v", got)
+	}
+
+	if got.Summary != "failed to run linters: golangci-lint: executable file not found" {
+		t.Fatalf("summary no match: %s", got.Summary)
+	}
+}
+
+func TestFailLintOnCheckout(t *testing.T) {
+	_, before, after := newRemote(t)
+	s := fake.NewServer(t)
+	svc := newServices(t, s)
+
+	LintApplication(context.Background(), svc, newSuite(t, "file://"+t.TempDir(), before, after))
+
+	got := checkRun(t, s)
+	if got.Conclusion != "failure" || !strings.HasPrefix(got.Summary, "failed to run linters: list files") {
+		t.Fatalf("check run no match: %+v", got)
+	}
+}
+
+func TestWebhookCheckSuite(t *testing.T) {
+	remote, before, after := newRemote(t)
+	s := fake.NewServer(t)
+	dispatcher := NewDispatcher(newServices(t, s))
+
+	srv := httptest.NewServer(NewRouter(dispatcher, "", ""))
+	t.Cleanup(srv.Close)
+
+	event := fixture[github.CheckSuiteEvent](t, "check_suite.requested.json")
+	event.Repo.CloneURL = github.String(remote)
+	event.CheckSuite.HeadSHA = github.String(after)
+	event.CheckSuite.BeforeSHA = github.String(before)
+	event.CheckSuite.AfterSHA = github.String(after)
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("encode event: %s", err)
+	}
+
+	if err := webhook.Deliver(context.Background(), srv.Client(), srv.URL, "check_suite", payload, ""); err != nil {
+		t.Fatalf("deliver: %s", err)
+	}
+	dispatcher.Wait()
+
+	got := checkRun(t, s)
+	if got.Name != lintCheckRunName || got.HeadSHA != after || got.Status != "completed" || got.Conclusion != "success" {
+		t.Fatalf("check run no match: %+v", got)
+	}
+}
+
+// TestRouterFixtures replays every fixture, checking those of the events the
+// service acts on start jobs and the others are ignored.
+func TestRouterFixtures(t *testing.T) {
+	ignored := map[string]bool{
+		"deployment_protection_rule.requested.json": true,
+	}
+
+	names, err := fs.Glob(events.Fixtures, "*.json")
+	if err != nil || len(names) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			d, s := newRecordingDispatcher(false)
+			dir := t.TempDir()
+			router := NewRouter(d, "s3cr3t", dir)
+
+			payload, err := fs.ReadFile(events.Fixtures, name)
+			if err != nil {
+				t.Fatalf("read fixture: %s", err)
+			}
+
+			r, err := webhook.NewRequest(context.Background(), "/", webhook.EventFromFilename(name), payload, "s3cr3t")
+			if err != nil {
+				t.Fatalf("new request: %s", err)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			d.Wait()
+
+			status := http.StatusAccepted
+			if ignored[name] {
+				status = http.StatusNoContent
+			}
+
+			if w.Code != status {
+				t.Fatalf("status no match: %d, jobs: %v", w.Code, s.jobs)
+			}
+
+			if captured, _ := os.ReadDir(dir); len(captured) != 1 {
+				t.Fatalf("captured no match: %v", captured)
+			}
+		})
+	}
+}
+
+func TestRouterUnsigned(t *testing.T) {
+	d, s := newRecordingDispatcher(false)
+	dir := t.TempDir()
+	router := NewRouter(d, "s3cr3t", dir)
+
+	payload, err := events.Fixtures.ReadFile("check_suite.requested.json")
+	if err != nil {
+		t.Fatalf("read fixture: %s", err)
+	}
+
+	r, err := webhook.NewRequest(context.Background(), "/", "check_suite", payload, "")
+	if err != nil {
+		t.Fatalf("new request: %s", err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	d.Wait()
+
+	if w.Code != http.StatusUnauthorized || len(s.jobs) != 0 {
+		t.Fatalf("status or jobs no match: %d, %v", w.Code, s.jobs)
+	}
+
+	if captured, _ := os.ReadDir(dir); len(captured) != 0 {
+		t.Fatalf("expected nothing captured, got %v", captured)
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/Manzanit0/go-github/v52/github"
+
+	"github.com/manzanit0/monocrat/pkg/config"
+	ghapp "github.com/manzanit0/monocrat/pkg/github"
+	"github.com/manzanit0/monocrat/pkg/image"
+	"github.com/manzanit0/monocrat/pkg/monorepo"
+)
+
+const (
+	// releaseAction is the identifier of the action releasing the changed
+	// applications, offered once the linter passes.
+	releaseAction = "release_image"
+
+	// retryReleaseAction is the identifier of the action releasing a single
+	// application again, offered on its check run when it fails.
+	retryReleaseAction = "release_app_retry"
+)
+
+// ReleaseApplication releases every application changed in the check suite,
+// each under a check run of its own so that they succeed, fail and get retried
+// independently.
+func ReleaseApplication(ctx context.Context, svc *Services, suite Suite) {
+	gh := svc.Client(suite.InstallationID)
+	tokens := ghapp.ClientTokens(gh)
+
+	target, err := prepareRelease(ctx, svc, tokens, suite, suite.BeforeSHA, suite.AfterSHA)
+	if err == nil {
+		defer target.Close()
+	}
+
+	var apps []monorepo.Application
+	if err == nil {
+		apps, err = ChangedApplications(ctx, target.checkout.Worktree, suite.BeforeSHA, suite.AfterSHA, svc.ReleaseConfig)
+	}
+
+	if err == nil {
+		err = target.checkout.WidenForDockerfiles(ctx, target.cfg, apps)
+	}
+
+	// Without applications there are no check runs to report the failure on,
+	// so it gets one of its own.
+	if err != nil {
+		log.Println("[error]", err)
+		reportRelease(ctx, gh, suite, "failure", "Release failed", err.Error())
+		return
+	}
+
+	if len(apps) == 0 {
+		reportRelease(ctx, gh, suite, "neutral", "No applications changed", "No applications changed, so there is nothing to release.")
+		return
+	}
+
+	// Create all the check runs upfront, so it's visible what's queued.
+	// Applications without one aren't released, and get reported together.
+	checkRunIDs := map[string]int64{}
+	var failedNames, failed []string
+	for _, app := range apps {
+		checkRunID, err := createReleaseCheckRun(ctx, gh, suite, app.Name)
+		if err != nil {
+			log.Println("[error]", err)
+			failedNames = append(failedNames, app.Name)
+			failed = append(failed, fmt.Sprintf("- %s: create check run: %s", app.Name, err.Error()))
+			continue
+		}
+
+		checkRunIDs[app.Name] = checkRunID
+	}
+
+	if len(failed) > 0 {
+		title := fmt.Sprintf("Failed to release %s", strings.Join(failedNames, ", "))
+		reportRelease(ctx, gh, suite, "failure", title, strings.Join(failed, "\n"))
+	}
+
+	// Failed applications are reported on their check runs, so they don't
+	// stop the others.
+	_ = forEachApplication(ctx, apps, svc.ReleaseConfig.Concurrency, func(ctx context.Context, app monorepo.Application) error {
+		if checkRunID, ok := checkRunIDs[app.Name]; ok {
+			target.release(ctx, gh, suite, checkRunID, app)
+		}
+		return nil
+	})
+}
+
+// reportRelease reports on the release of the suite as a whole, under a
+// completed check run of its own, for what no application's check run covers.
+func reportRelease(ctx context.Context, gh ghapp.Client, suite Suite, conclusion, title, summary string) {
+	_, err := gh.CreateCheckRun(ctx,
+		suite.Owner(),
+		suite.Name(),
+		github.CreateCheckRunOptions{
+			Name:       releaseAllCheckRunName,
+			HeadSHA:    suite.HeadSHA,
+			Status:     github.String("completed"),
+			Conclusion: github.String(conclusion),
+			Output: &github.CheckRunOutput{
+				Title:   github.String(title),
+				Summary: github.String(summary),
+			},
+		})
+	if err != nil {
+		log.Println("[error]", err)
+	}
+}
+
+// RetryApplicationRelease releases the single application again, reporting on
+// the check run given.
+func RetryApplicationRelease(ctx context.Context, svc *Services, suite Suite, checkRunID int64, appName string) {
+	gh := svc.Client(suite.InstallationID)
+	tokens := ghapp.ClientTokens(gh)
+
+	target, err := prepareRelease(ctx, svc, tokens, suite)
+	if err == nil {
+		defer target.Close()
+	}
+
+	var app monorepo.Application
+	if err == nil {
+		app, err = monorepo.FindApplication(target.checkout.Path, appName)
+	}
+
+	if err == nil {
+		err = target.checkout.WidenForDockerfiles(ctx, target.cfg, []monorepo.Application{app})
+	}
+
+	if err != nil {
+		log.Println("[error]", err)
+		completeRelease(ctx, gh, suite, checkRunID, appName, nil, nil, err)
+		return
+	}
+
+	target.release(ctx, gh, suite, checkRunID, app)
+}
+
+// releaseTarget is everything needed to release the applications of a commit.
+type releaseTarget struct {
+	builder        *image.Builder
+	logs           *LogStore
+	releaseConfig  *ReleaseConfig
+	registries     []image.Registry
+	privateModules *image.PrivateModules
+
+	remote    string
+	commitSHA string
+	checkout  *Checkout
+	cfg       *config.Config
+}
+
+// prepareRelease checks out the head commit of the suite, along with the other
+// commits to fetch, and gathers what's needed to release its applications.
+func prepareRelease(ctx context.Context, svc *Services, tr ghapp.TokenSource, suite Suite, fetch ...string) (*releaseTarget, error) {
+	releaseConfig := svc.ReleaseConfig
+	owner := suite.Owner()
+	registries, err := releaseConfig.Registries(ctx, tr, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	privateModules, err := releaseConfig.PrivateModules(ctx, tr, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &releaseTarget{
+		builder:        svc.Builder,
+		logs:           svc.Logs,
+		releaseConfig:  releaseConfig,
+		registries:     registries,
+		privateModules: privateModules,
+		remote:         suite.Repo.GetCloneURL(),
+		commitSHA:      suite.HeadSHA,
+	}
+
+	t.checkout, err = svc.Checkout(ctx, tr, suite, t.commitSHA, fetch...)
+	if err != nil {
+		return nil, err
+	}
+
+	t.cfg, err = config.Load(t.checkout.Path)
+	if err != nil {
+		t.Close()
+		return nil, fmt.Errorf("load repository configuration: %w", err)
+	}
+
+	return t, nil
+}
+
+// Close removes the checkout.
+func (t *releaseTarget) Close() {
+	t.checkout.Close()
+}
+
+// AppRelease is the outcome of releasing an application.
+type AppRelease struct {
+	Images []image.Image
+
+	// Annotations point at the vulnerable dependencies of the application.
+	Annotations []*github.CheckRunAnnotation
+}
+
+// BuildAndPush builds and pushes the images of the application, with the logs
+// of the build going to w. The release is returned even on error, for its
+// annotations.
+func (t *releaseTarget) BuildAndPush(ctx context.Context, app monorepo.Application, w io.Writer) (*AppRelease, error) {
+	log.Println("build and push", app.Name, app.Directory)
+
+	opts := applicationBuildOptions(app, t.checkout.Path, t.remote, t.commitSHA, t.cfg, t.privateModules, t.releaseConfig)
+	opts.Registries = t.registries
+	opts.Log = w
+
+	pushed, err := t.builder.BuildAndPush(ctx, opts)
+
+	// Every image of the application had the same findings.
+	release := &AppRelease{Images: pushed}
+	if len(pushed) > 0 {
+		release.Annotations = scanAnnotations(t.checkout.Path, app, t.releaseConfig.Scan, pushed[0].Vulnerabilities, err)
+	} else {
+		release.Annotations = scanAnnotations(t.checkout.Path, app, t.releaseConfig.Scan, nil, err)
+	}
+
+	if err != nil {
+		return release, fmt.Errorf("build and push %s: %w", app.Name, err)
+	}
+
+	for _, img := range pushed {
+		log.Println("[info] pushed", img.Ref)
+	}
+
+	return release, nil
+}
+
+// release releases the application, reporting on its check run.
+func (t *releaseTarget) release(ctx context.Context, gh ghapp.Client, suite Suite, checkRunID int64, app monorepo.Application) {
+	runLog := t.logs.Start(ctx, gh, suite, checkRunID, releaseCheckRunName(app.Name), fmt.Sprintf("Releasing %s", app.Name))
+	defer runLog.Close()
+
+	_, err := gh.UpdateCheckRun(ctx,
+		suite.Owner(),
+		suite.Name(),
+		checkRunID,
+		github.UpdateCheckRunOptions{
+			Name:       releaseCheckRunName(app.Name),
+			DetailsURL: runLog.DetailsURL(),
+			Status:     github.String("in_progress"),
+		})
+	if err != nil {
+		log.Println("[error]", err)
+	}
+
+	release, err := t.BuildAndPush(ctx, app, runLog)
+	if err != nil {
+		log.Println("[error]", err)
+	}
+	runLog.Close()
+
+	completeRelease(ctx, gh, suite, checkRunID, app.Name, release, runLog, err)
+}
+
+// completeRelease concludes the check run of the application, with the end of
+// its log if any, offering to retry it when it failed.
+func completeRelease(ctx context.Context, gh ghapp.Client, suite Suite, checkRunID int64, appName string, release *AppRelease, runLog *CheckRunLog, releaseErr error) {
+	if cancelIfSuperseded(ctx, gh, suite, checkRunID, releaseCheckRunName(appName), runLog) {
+		return
+	}
+
+	if release == nil {
+		release = &AppRelease{}
+	}
+
+	opts := github.UpdateCheckRunOptions{
+		Name:       releaseCheckRunName(appName),
+		DetailsURL: runLog.DetailsURL(),
+		Status:     github.String("completed"),
+		Conclusion: github.String("success"),
+		Output: &github.CheckRunOutput{
+			Title:       github.String(fmt.Sprintf("Released %s", appName)),
+			Summary:     github.String(ReleaseSummary(release.Images)),
+			Text:        runLog.Text(),
+			Annotations: release.Annotations,
+		},
+	}
+
+	if releaseErr != nil {
+		opts.Conclusion = github.String("failure")
+		opts.Output.Title = github.String(fmt.Sprintf("Failed to release %s", appName))
+		opts.Output.Summary = github.String(releaseErr.Error())
+		opts.Actions = []*github.CheckRunAction{
+			{
+				Label:       "Retry",
+				Description: fmt.Sprintf("Retry releasing %s", appName),
+				Identifier:  retryReleaseAction,
+			},
+		}
+	}
+
+	runLog.Complete(*opts.Conclusion, *opts.Output.Summary, release)
+
+	_, err := gh.UpdateCheckRun(ctx,
+		suite.Owner(),
+		suite.Name(),
+		checkRunID,
+		opts)
+	if err != nil {
+		log.Println("[error]", err)
+	}
+}
+
+// createReleaseCheckRun queues the check run of the application, named after
+// it in its external ID.
+func createReleaseCheckRun(ctx context.Context, gh ghapp.Client, suite Suite, appName string) (int64, error) {
+	checkRun, err := gh.CreateCheckRun(ctx,
+		suite.Owner(),
+		suite.Name(),
+		github.CreateCheckRunOptions{
+			Name:       releaseCheckRunName(appName),
+			HeadSHA:    suite.HeadSHA,
+			ExternalID: github.String(appName),
+			Status:     github.String("queued"),
+		})
+	if err != nil {
+		return 0, err
+	}
+
+	return checkRun.GetID(), nil
+}
+
+func releaseCheckRunName(appName string) string {
+	return fmt.Sprintf("Release %s", appName)
+}
+
+// ReleaseSummary renders the published images of an application, with the
+// digest of each platform, as markdown for the check run output.
+func ReleaseSummary(images []image.Image) string {
+	if len(images) == 0 {
+		return "No images published."
+	}
+
+	var b strings.Builder
+	if len(images[0].Vulnerabilities) > 0 {
+		fmt.Fprintf(&b, "%d known vulnerabilities below the failure threshold, see the annotations on go.mod.\n\n", len(images[0].Vulnerabilities))
+	}
+
+	for _, img := range images {
+		fmt.Fprintf(&b, "`%s`\n\n", img.Ref)
+		fmt.Fprintf(&b, "| Platform | Digest |\n| --- | --- |\n")
+		for _, p := range img.Platforms {
+			fmt.Fprintf(&b, "| %s | `%s` |\n", p.Platform, p.Digest)
+		}
+		fmt.Fprintf(&b, "\n")
+
+		for _, a := range img.Attestations {
+			switch a.Kind {
+			case "sbom":
+				fmt.Fprintf(&b, "- SBOM (`%s`, %d packages): `%s`\n", a.ArtifactType, a.Packages, a.Digest)
+			default:
+				fmt.Fprintf(&b, "- Provenance (`%s`): `%s`\n", a.ArtifactType, a.Digest)
+			}
+		}
+		if img.Signature != "" {
+			fmt.Fprintf(&b, "- Signature: `%s`\n", img.Signature)
+		}
+		if len(img.Attestations) > 0 || img.Signature != "" {
+			fmt.Fprintf(&b, "\n")
+		}
+	}
+
+	return b.String()
+}
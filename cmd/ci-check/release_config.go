@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/manzanit0/monocrat/pkg/attest"
+	"github.com/manzanit0/monocrat/pkg/cosign"
+	ghapp "github.com/manzanit0/monocrat/pkg/github"
+	"github.com/manzanit0/monocrat/pkg/image"
+	"github.com/manzanit0/monocrat/pkg/vuln"
+)
+
+// defaultConcurrency is how many applications are built at the same time
+// unless configured otherwise.
+const defaultConcurrency = 4
+
+// ReleaseConfig describes how released images are built and the registries
+// they are pushed to. Every registry is optional, but at least one needs to be
+// configured.
+type ReleaseConfig struct {
+	DockerHubUsername string
+	DockerHubPassword string
+
+	// GHCREnabled pushes to the GitHub Container Registry with the
+	// installation token. Images are pushed under GHCRNamespace, or the owner
+	// of the repository if empty.
+	GHCREnabled   bool
+	GHCRNamespace string
+
+	// OCI is any other OCI registry, authenticated with basic or bearer auth.
+	OCI *image.Registry
+
+	// Platforms are the platforms images are built for, e.g. "linux/amd64"
+	// and "linux/arm64". Empty means the platform of the build engine.
+	Platforms []string
+
+	// SBOMFormat is the format of the SBOM attached to every image, either
+	// spdx or cyclonedx.
+	SBOMFormat string
+
+	// SigningKey signs every image with a cosign-compatible signature, when
+	// configured.
+	SigningKey *ecdsa.PrivateKey
+
+	// GOPrivate are the patterns of private modules, as in GOPRIVATE, which
+	// builds fetch with the installation token. Defaults to every module of
+	// the repository owner on GitHub.
+	GOPrivate []string
+
+	// Vendor runs `go mod vendor` on the checkout before building instead.
+	Vendor bool
+
+	// BuildOnPullRequest builds the changed applications on every push,
+	// without pushing them, so releases are known to build beforehand.
+	BuildOnPullRequest bool
+
+	// ExportDirectory keeps the images built on pushes as OCI tarballs. They
+	// are discarded when empty.
+	ExportDirectory string
+
+	// Concurrency is how many applications are built at the same time.
+	Concurrency int
+
+	// Scan checks applications against a vulnerability database before
+	// pushing them, when configured.
+	Scan *image.ScanOptions
+}
+
+// LoadReleaseConfig reads the release configuration from the environment.
+func LoadReleaseConfig() (*ReleaseConfig, error) {
+	c := &ReleaseConfig{
+		DockerHubUsername:  os.Getenv("DOCKER_HUB_USERNAME"),
+		DockerHubPassword:  os.Getenv("DOCKER_HUB_PASSWORD"),
+		GHCREnabled:        os.Getenv("GHCR_ENABLED") == "true",
+		GHCRNamespace:      os.Getenv("GHCR_NAMESPACE"),
+		SBOMFormat:         os.Getenv("MONOCRAT_SBOM_FORMAT"),
+		Concurrency:        defaultConcurrency,
+		Vendor:             os.Getenv("MONOCRAT_VENDOR") == "true",
+		BuildOnPullRequest: os.Getenv("MONOCRAT_BUILD_ON_PR") == "true",
+		ExportDirectory:    os.Getenv("MONOCRAT_EXPORT_DIRECTORY"),
+	}
+
+	if patterns := os.Getenv("MONOCRAT_GOPRIVATE"); patterns != "" {
+		for _, pattern := range strings.Split(patterns, ",") {
+			c.GOPrivate = append(c.GOPrivate, strings.TrimSpace(pattern))
+		}
+	}
+
+	if concurrency := os.Getenv("MONOCRAT_BUILD_CONCURRENCY"); concurrency != "" {
+		n, err := strconv.Atoi(concurrency)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid MONOCRAT_BUILD_CONCURRENCY %q: expected a positive number", concurrency)
+		}
+		c.Concurrency = n
+	}
+
+	switch c.SBOMFormat {
+	case "":
+		c.SBOMFormat = attest.FormatSPDX
+	case attest.FormatSPDX, attest.FormatCycloneDX:
+	default:
+		return nil, fmt.Errorf("invalid MONOCRAT_SBOM_FORMAT %q: expected spdx or cyclonedx", c.SBOMFormat)
+	}
+
+	if path := os.Getenv("MONOCRAT_SIGNING_KEY"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read MONOCRAT_SIGNING_KEY: %w", err)
+		}
+
+		c.SigningKey, err = cosign.LoadPrivateKey(b, []byte(os.Getenv("COSIGN_PASSWORD")))
+		if err != nil {
+			return nil, fmt.Errorf("load MONOCRAT_SIGNING_KEY: %w", err)
+		}
+	}
+
+	if db := os.Getenv("MONOCRAT_VULN_DB"); db != "" {
+		c.Scan = &image.ScanOptions{DB: &vuln.DB{URL: db}, FailOn: vuln.SeverityHigh}
+
+		switch failOn := os.Getenv("MONOCRAT_VULN_FAIL_ON"); failOn {
+		case "":
+		case "never":
+			c.Scan.FailOn = 0
+		default:
+			severity, err := vuln.ParseSeverity(failOn)
+			if err != nil {
+				return nil, fmt.Errorf("invalid MONOCRAT_VULN_FAIL_ON: %w", err)
+			}
+			c.Scan.FailOn = severity
+		}
+	}
+
+	if platforms := os.Getenv("MONOCRAT_PLATFORMS"); platforms != "" {
+		for _, platform := range strings.Split(platforms, ",") {
+			c.Platforms = append(c.Platforms, strings.TrimSpace(platform))
+		}
+	}
+
+	if (c.DockerHubUsername == "") != (c.DockerHubPassword == "") {
+		return nil, fmt.Errorf("both DOCKER_HUB_USERNAME and DOCKER_HUB_PASSWORD must be set")
+	}
+
+	if address := os.Getenv("OCI_REGISTRY_ADDRESS"); address != "" {
+		var auth image.Auth
+		switch {
+		case os.Getenv("OCI_REGISTRY_TOKEN") != "":
+			auth = image.BearerAuth(os.Getenv("OCI_REGISTRY_TOKEN"))
+		case os.Getenv("OCI_REGISTRY_USERNAME") != "":
+			auth = image.BasicAuth(os.Getenv("OCI_REGISTRY_USERNAME"), os.Getenv("OCI_REGISTRY_PASSWORD"))
+		}
+
+		registry := image.OCI(address, os.Getenv("OCI_REGISTRY_NAMESPACE"), auth)
+		c.OCI = &registry
+	}
+
+	if c.DockerHubUsername == "" && !c.GHCREnabled && c.OCI == nil {
+		return nil, fmt.Errorf("no registry configured: set DOCKER_HUB_USERNAME, GHCR_ENABLED or OCI_REGISTRY_ADDRESS")
+	}
+
+	return c, nil
+}
+
+// Registries returns the registries to push the images of a repository owned
+// by owner to. The installation transport is only used to mint a token when
+// pushing to GHCR.
+func (c *ReleaseConfig) Registries(ctx context.Context, tr ghapp.TokenSource, owner string) ([]image.Registry, error) {
+	var registries []image.Registry
+	if c.DockerHubUsername != "" {
+		registries = append(registries, image.DockerHub(c.DockerHubUsername, c.DockerHubPassword))
+	}
+
+	if c.GHCREnabled {
+		token, err := tr.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get installation token: %w", err)
+		}
+
+		namespace := c.GHCRNamespace
+		if namespace == "" {
+			namespace = owner
+		}
+
+		registries = append(registries, image.GHCR(namespace, token))
+	}
+
+	if c.OCI != nil {
+		registries = append(registries, *c.OCI)
+	}
+
+	return registries, nil
+}
+
+// PrivateModules returns the access to the private modules of a repository
+// owned by owner: the installation token authenticates against GitHub for
+// them.
+func (c *ReleaseConfig) PrivateModules(ctx context.Context, tr ghapp.TokenSource, owner string) (*image.PrivateModules, error) {
+	token, err := tr.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get installation token: %w", err)
+	}
+
+	patterns := c.GOPrivate
+	if len(patterns) == 0 {
+		patterns = []string{fmt.Sprintf("github.com/%s/*", owner)}
+	}
+
+	return &image.PrivateModules{
+		Patterns: patterns,
+		Credentials: []image.Credential{
+			{Host: "github.com", Username: "x-access-token", Password: token},
+		},
+	}, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/manzanit0/monocrat/pkg/github/fake"
+)
+
+func TestReleaseApplication(t *testing.T) {
+	remote, before, after := newRemote(t)
+	s := fake.NewServer(t)
+	svc := newServices(t, s)
+
+	// Without registries the release fails before reaching the engine.
+	ReleaseApplication(context.Background(), svc, newSuite(t, remote, before, after))
+
+	got := checkRun(t, s)
+	if got.Name != "Release api" || got.ExternalID != "api" || got.Status != "completed" || got.Conclusion != "failure" {
+		t.Fatalf("check run no match: %+v", got)
+	}
+
+	if got.Title != "Failed to release api" || got.Summary != "build and push api: no registries to push to" {
+		t.Fatalf("output no match: %+v", got)
+	}
+
+	if len(got.Actions) != 1 || got.Actions[0].Identifier != retryReleaseAction {
+		t.Fatalf("actions no match: %+v", got.Actions)
+	}
+}
+
+func TestReleaseApplicationNothingChanged(t *testing.T) {
+	remote, _, after := newRemote(t)
+	s := fake.NewServer(t)
+	svc := newServices(t, s)
+
+	ReleaseApplication(context.Background(), svc, newSuite(t, remote, after, after))
+
+	got := checkRun(t, s)
+	if got.Name != releaseAllCheckRunName || got.Status != "completed" || got.Conclusion != "neutral" || got.Title != "No applications changed" {
+		t.Fatalf("check run no match: %+v", got)
+	}
+}
+
+func TestReleaseApplicationCheckRunFailure(t *testing.T) {
+	remote, before, after := newRemote(t)
+	s := fake.NewServer(t)
+	s.FailNext("POST", "/repos/Manzanit0/gitops-env-per-folder-poc/check-runs", http.StatusUnprocessableEntity, "Validation Failed")
+	svc := newServices(t, s)
+
+	ReleaseApplication(context.Background(), svc, newSuite(t, remote, before, after))
+
+	// The application isn't released without a check run to report on.
+	got := checkRun(t, s)
+	if got.Name != releaseAllCheckRunName || got.Conclusion != "failure" || got.Title != "Failed to release api" {
+		t.Fatalf("check run no match: %+v", got)
+	}
+
+	if !strings.HasPrefix(got.Summary, "- api: create check run: ") || !strings.Contains(got.Summary, "Validation Failed") {
+		t.Fatalf("summary no match: %s", got.Summary)
+	}
+}
+
+func TestReleaseApplicationFailure(t *testing.T) {
+	_, before, after := newRemote(t)
+	s := fake.NewServer(t)
+	svc := newServices(t, s)
+
+	ReleaseApplication(context.Background(), svc, newSuite(t, "file://"+t.TempDir(), before, after))
+
+	got := checkRun(t, s)
+	if got.Name != releaseAllCheckRunName || got.Conclusion != "failure" || got.Title != "Release failed" {
+		t.Fatalf("check run no match: %+v", got)
+	}
+}
+
+func TestRetryApplicationRelease(t *testing.T) {
+	remote, before, after := newRemote(t)
+	s := fake.NewServer(t)
+	svc := newServices(t, s)
+	suite := newSuite(t, remote, before, after)
+	ctx := context.Background()
+
+	gh := svc.Client(suite.InstallationID)
+	checkRunID, err := createReleaseCheckRun(ctx, gh, suite, "worker")
+	if err != nil {
+		t.Fatalf("create check run: %s", err)
+	}
+
+	RetryApplicationRelease(ctx, svc, suite, checkRunID, "worker")
+
+	got := checkRun(t, s)
+	if got.Name != "Release worker" || got.Conclusion != "failure" || got.Summary != "application worker not found" {
+		t.Fatalf("check run no match: %+v", got)
+	}
+
+	if len(got.Actions) != 1 || got.Actions[0].Identifier != retryReleaseAction {
+		t.Fatalf("actions no match: %+v", got.Actions)
+	}
+}
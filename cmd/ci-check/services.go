@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/manzanit0/monocrat/pkg/config"
+	"github.com/manzanit0/monocrat/pkg/gitcache"
+	ghapp "github.com/manzanit0/monocrat/pkg/github"
+	"github.com/manzanit0/monocrat/pkg/image"
+	"github.com/manzanit0/monocrat/pkg/lint"
+	"github.com/manzanit0/monocrat/pkg/monorepo"
+	"github.com/manzanit0/monocrat/pkg/workspace"
+)
+
+// Services are what jobs share with each other.
+type Services struct {
+	// Installations are the clients of the installations of the GitHub App.
+	Installations *ghapp.Installations
+
+	// Clients returns the client of an installation, defaulting to that of
+	// Installations.
+	Clients func(installationID int64) ghapp.Client
+
+	// Lint lints the module in the directory, defaulting to golangci-lint.
+	Lint func(ctx context.Context, directory string, w io.Writer) (*lint.Result, error)
+
+	ReleaseConfig *ReleaseConfig
+
+	// Builder builds all the images, over an engine connection per build.
+	Builder *image.Builder
+
+	// Logs keeps the logs of jobs. It may be nil.
+	Logs *LogStore
+
+	// Repositories are the mirrors of the repositories jobs check out.
+	Repositories *gitcache.Cache
+
+	// Workspaces are the directories jobs check repositories out and export
+	// images to.
+	Workspaces *workspace.Manager
+}
+
+// Client returns the client of the installation.
+func (s *Services) Client(installationID int64) ghapp.Client {
+	if s.Clients != nil {
+		return s.Clients(installationID)
+	}
+
+	return s.Installations.Get(installationID).Client()
+}
+
+// Evict forgets the client of the installation, along with its token.
+func (s *Services) Evict(installationID int64) {
+	if s.Installations != nil {
+		s.Installations.Evict(installationID)
+	}
+}
+
+// lint lints the module in the directory.
+func (s *Services) lint(ctx context.Context, directory string, w io.Writer) (*lint.Result, error) {
+	if s.Lint != nil {
+		return s.Lint(ctx, directory, w)
+	}
+
+	return lint.Lint(ctx, directory, w)
+}
+
+// LoadWorkspaces configures the workspaces from the environment, defaulting
+// to a directory under the temporary one without a quota. Workspaces left
+// behind by a previous run are removed.
+func LoadWorkspaces() (*workspace.Manager, error) {
+	directory := os.Getenv("MONOCRAT_WORKSPACE_DIRECTORY")
+	if directory == "" {
+		directory = filepath.Join(os.TempDir(), "monocrat-workspaces")
+	}
+
+	var quota int64
+	if s := os.Getenv("MONOCRAT_WORKSPACE_QUOTA"); s != "" {
+		var err error
+		quota, err = workspace.ParseSize(s)
+		if err != nil {
+			return nil, fmt.Errorf("parse MONOCRAT_WORKSPACE_QUOTA: %w", err)
+		}
+	}
+
+	var reserve int64
+	if s := os.Getenv("MONOCRAT_WORKSPACE_RESERVE"); s != "" {
+		var err error
+		reserve, err = workspace.ParseSize(s)
+		if err != nil {
+			return nil, fmt.Errorf("parse MONOCRAT_WORKSPACE_RESERVE: %w", err)
+		}
+	}
+
+	workspaces := &workspace.Manager{Root: directory, Quota: quota, Reserve: reserve}
+	if err := workspaces.GC(); err != nil {
+		return nil, err
+	}
+
+	return workspaces, nil
+}
+
+// Checkout is a commit checked out in a workspace of its own.
+type Checkout struct {
+	*gitcache.Worktree
+
+	Workspace *workspace.Workspace
+}
+
+// Close removes the worktree along with the workspace, logging failures as
+// there is nothing left for jobs to do about them.
+func (c *Checkout) Close() {
+	if err := c.Worktree.Close(); err != nil {
+		log.Println("[error]", err)
+	}
+
+	if err := c.Workspace.Close(); err != nil {
+		log.Println("[error]", err)
+	}
+}
+
+// Checkout checks the Go modules of the commit of the repository of the suite
+// out of the cache into a new workspace, along with the other commits to
+// fetch, authenticating as the installation. Close the checkout once done with
+// it.
+func (s *Services) Checkout(ctx context.Context, tr ghapp.TokenSource, suite Suite, commit string, fetch ...string) (*Checkout, error) {
+	token, err := tr.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get installation token: %w", err)
+	}
+
+	remote := suite.Repo.GetCloneURL()
+	auth := &gitcache.Auth{Username: "x-access-token", Password: token}
+
+	// Jobs only need the Go modules, along with the files at the root.
+	files, err := s.Repositories.Files(ctx, remote, auth, commit)
+	if err != nil {
+		return nil, fmt.Errorf("list files: %w", err)
+	}
+
+	ws, err := s.Workspaces.Create(suite.Repo.GetFullName() + "-" + commit[:min(len(commit), 7)])
+	if err != nil {
+		return nil, err
+	}
+
+	worktree, err := s.Repositories.Checkout(ctx, gitcache.CheckoutOptions{
+		Remote: remote,
+		Commit: commit,
+		Fetch:  fetch,
+		Auth:   auth,
+		Paths:  monorepo.ModuleDirectories(files),
+		Path:   filepath.Join(ws.Path, "repository"),
+	})
+	if err != nil {
+		if err := ws.Close(); err != nil {
+			log.Println("[error]", err)
+		}
+		return nil, fmt.Errorf("check out repository: %w", err)
+	}
+
+	return &Checkout{Worktree: worktree, Workspace: ws}, nil
+}
+
+// WidenForDockerfiles checks out the whole commit when any of the applications
+// builds from a Dockerfile, which may copy anything from the repository.
+func (c *Checkout) WidenForDockerfiles(ctx context.Context, cfg *config.Config, apps []monorepo.Application) error {
+	for _, app := range apps {
+		dockerfile := cfg.Dockerfile(app.Name)
+		if dockerfile == nil {
+			var err error
+			dockerfile, err = image.FindDockerfile(c.Path, app.Directory)
+			if err != nil {
+				return err
+			}
+		}
+
+		if dockerfile != nil {
+			return c.Widen(ctx)
+		}
+	}
+
+	return nil
+}
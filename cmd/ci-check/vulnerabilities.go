@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Manzanit0/go-github/v52/github"
+
+	"github.com/manzanit0/monocrat/pkg/image"
+	"github.com/manzanit0/monocrat/pkg/monorepo"
+	"github.com/manzanit0/monocrat/pkg/vuln"
+)
+
+// VulnerabilityAnnotations points every finding at the line of the go.mod of
+// the application which brings in the vulnerable module. Findings at or above
+// the severity to fail on are failures, the rest warnings.
+func VulnerabilityAnnotations(repositoryPath, appDirectory string, findings []vuln.Finding, failOn vuln.Severity) ([]*github.CheckRunAnnotation, error) {
+	if len(findings) == 0 {
+		return nil, nil
+	}
+
+	goModPath, err := findGoMod(repositoryPath, appDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(filepath.Join(repositoryPath, goModPath))
+	if err != nil {
+		return nil, fmt.Errorf("read go.mod: %w", err)
+	}
+
+	lines, err := vuln.GoModLines(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var annotations []*github.CheckRunAnnotation
+	for _, f := range findings {
+		level := "warning"
+		if failOn != 0 && f.Severity >= failOn {
+			level = "failure"
+		}
+
+		// Modules only required indirectly may not be listed at all, the
+		// module directive is the next best thing.
+		line, ok := lines[f.Module]
+		if !ok {
+			line = 1
+		}
+
+		fixed := "No fixed version is available."
+		if f.Fixed != "" {
+			fixed = fmt.Sprintf("Fixed in %s.", f.Fixed)
+		}
+
+		message := fmt.Sprintf("%s %s is affected by %s (%s severity). %s", f.Module, f.Version, f.ID, f.Severity, fixed)
+		if len(f.Aliases) > 0 {
+			message = fmt.Sprintf("%s\nAliases: %s", message, strings.Join(f.Aliases, ", "))
+		}
+		if f.URL != "" {
+			message = fmt.Sprintf("%s\n%s", message, f.URL)
+		}
+
+		annotations = append(annotations, &github.CheckRunAnnotation{
+			AnnotationLevel: github.String(level),
+			Title:           github.String(fmt.Sprintf("%s: %s", f.ID, f.Summary)),
+			Message:         github.String(message),
+			Path:            github.String(goModPath),
+			StartLine:       github.Int(line),
+			EndLine:         github.Int(line),
+		})
+	}
+
+	return annotations, nil
+}
+
+// scanAnnotations annotates the findings of the scan of an application, either
+// those which failed the build or those let through.
+func scanAnnotations(repositoryPath string, app monorepo.Application, scan *image.ScanOptions, findings []vuln.Finding, err error) []*github.CheckRunAnnotation {
+	if scan == nil {
+		return nil
+	}
+
+	var vulnerable *image.VulnerableError
+	if errors.As(err, &vulnerable) {
+		findings = vulnerable.Findings
+	}
+
+	annotations, err := VulnerabilityAnnotations(repositoryPath, app.Directory, findings, scan.FailOn)
+	if err != nil {
+		log.Println("[error] annotating vulnerabilities:", err)
+	}
+
+	return annotations
+}
+
+// findGoMod returns the path of the go.mod of the module the application
+// belongs to, relative to the repository.
+func findGoMod(repositoryPath, appDirectory string) (string, error) {
+	dir := filepath.Clean(appDirectory)
+	for {
+		path := filepath.Join(dir, "go.mod")
+		if _, err := os.Stat(filepath.Join(repositoryPath, path)); err == nil {
+			return filepath.ToSlash(path), nil
+		}
+
+		if dir == "." || dir == string(filepath.Separator) {
+			return "", fmt.Errorf("no go.mod found for %s", appDirectory)
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -1,20 +1,21 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
 
-	"github.com/Masterminds/vcs"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/manzanit0/monocrat/pkg/cosign"
+	"github.com/manzanit0/monocrat/pkg/gitcache"
 	"github.com/manzanit0/monocrat/pkg/github"
+	"github.com/manzanit0/monocrat/pkg/httpx"
+	"github.com/manzanit0/monocrat/pkg/oci"
+	"github.com/manzanit0/monocrat/pkg/webhook"
 )
 
 func main() {
@@ -28,104 +29,138 @@ func main() {
 		log.Fatal("[error] missing MONOCRAT_PRIVATE_KEY environment variable")
 	}
 
-	repositoryOwner := os.Getenv("REPOSITORY_OWNER")
-	if len(repositoryOwner) == 0 {
-		log.Fatal("[error] missing REPOSITORY_OWNER environment variable")
+	filter, err := LoadRepositoryFilter()
+	if err != nil {
+		log.Fatal("[error] loading repository filter:", err)
+	}
+
+	approveFiltered, err := LoadFilteredDeployments()
+	if err != nil {
+		log.Fatalf("[error] loading filtered deployments policy: %s", err.Error())
+	}
+
+	signaturePolicy, err := LoadSignaturePolicy()
+	if err != nil {
+		log.Fatal("[error] loading signature policy:", err)
+	}
+
+	repositories, err := gitcache.FromEnv()
+	if err != nil {
+		log.Fatalf("[error] loading repository cache: %s", err.Error())
+	}
+
+	// Installations are shared across webhooks, along with their tokens.
+	installations, err := github.NewEnterpriseInstallations(os.Getenv("MONOCRAT_GITHUB_API_URL"), appID, privateKey)
+	if err != nil {
+		log.Fatal("[error] initialising GitHub client:", err)
+	}
+	installations.Publish("github_rate_limits")
+
+	reviewer := &Reviewer{
+		Installations:   installations,
+		Filter:          filter,
+		ApproveFiltered: approveFiltered,
+		SignaturePolicy: signaturePolicy,
+		Repositories:    repositories,
 	}
 
-	repositoryName := os.Getenv("REPOSITORY_NAME")
-	if len(repositoryName) == 0 {
-		log.Fatal("[error] missing REPOSITORY_NAME environment variable")
+	secret := os.Getenv("MONOCRAT_WEBHOOK_SECRET")
+	if secret == "" {
+		log.Println("[info] MONOCRAT_WEBHOOK_SECRET is empty: webhook signatures aren't verified")
 	}
 
+	r := NewRouter(reviewer, secret, os.Getenv("MONOCRAT_WEBHOOK_CAPTURE_DIRECTORY"))
+
+	// Metrics stay off the public listener.
+	httpx.ServeAdmin(os.Getenv("MONOCRAT_ADMIN_ADDRESS"))
+
+	var port string
+	if port = os.Getenv("PORT"); port == "" {
+		port = "8080"
+	}
+
+	log.Println("[info] starting server on port", port)
+	if err := http.ListenAndServe(":"+port, r); err != nil {
+		log.Println("[error] ListenAndServe", err)
+	}
+}
+
+// NewRouter returns the routes of the service, with the webhook reviewing
+// deployments with the reviewer. Deliveries must be signed with the secret
+// unless empty, and are captured to the directory unless empty.
+func NewRouter(reviewer *Reviewer, secret, captureDirectory string) http.Handler {
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 
 	// This is the endpoint registered under the GitHub App where we will get our
 	// "deployment_protection_rule" payloads.
-	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
-		// TODO: we need to secure the webhook
-		// https://docs.github.com/en/webhooks-and-events/webhooks/securing-your-webhooks#validating-payloads-from-github
-		// payload, err := github.ValidatePayload(r, []byte(os.Getenv("MONOCRAT_WEBHOOK_SECRET")))
-
-		var event github.DeploymentProtectionRuleEvent
-		dec := json.NewDecoder(r.Body)
-		if err := dec.Decode(&event); err != nil && err != io.EOF {
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Println("[error] unmarshal body:", err.Error())
-		}
+	r.With(webhook.Verify(secret), webhook.Capture(captureDirectory)).Post("/", reviewer.ServeHTTP)
 
-		remarshalled, err := json.Marshal(event)
-		if err == nil {
-			log.Println("[info] event received:", string(remarshalled))
-		}
+	return r
+}
 
-		// FIXME: This client should be reused per installations.
-		gh, err := github.NewClient(repositoryOwner, repositoryName, appID, event.Installation.ID, privateKey)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Println("[error] initialising GitHub client:", err)
-			return
-		}
+// LoadRepositoryFilter reads the repositories to protect the deployments of
+// from the environment. REPOSITORY_OWNER and REPOSITORY_NAME, which pinned the
+// service to a single repository, are honoured as an allowed repository.
+func LoadRepositoryFilter() (*github.RepositoryFilter, error) {
+	allow := os.Getenv("MONOCRAT_ALLOWED_REPOSITORIES")
+	if owner, name := os.Getenv("REPOSITORY_OWNER"), os.Getenv("REPOSITORY_NAME"); owner != "" && name != "" {
+		allow += "," + owner + "/" + name
+	}
 
-		remote := fmt.Sprintf("https://github.com/%s/%s", repositoryOwner, repositoryName)
-		local, _ := ioutil.TempDir("", "go-vcs")
-		repo, err := vcs.NewRepo(remote, local)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Println("[error] checking out repository:", err.Error())
-			return
-		}
+	return github.ParseRepositoryFilter(allow, os.Getenv("MONOCRAT_DENIED_REPOSITORIES"))
+}
 
-		err = repo.Get()
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Println("[error] checking out repository:", err.Error())
-			return
-		}
+// LoadFilteredDeployments reads whether the deployments of repositories
+// filtered out are approved or rejected, which they are by default.
+func LoadFilteredDeployments() (approve bool, err error) {
+	switch v := os.Getenv("MONOCRAT_FILTERED_DEPLOYMENTS"); v {
+	case "", "reject":
+		return false, nil
+	case "approve":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid MONOCRAT_FILTERED_DEPLOYMENTS %q: expected approve or reject", v)
+	}
+}
 
-		commitInfo, err := repo.CommitInfo(event.Deployment.Sha)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Println("[error] checking commit info:", err.Error())
-			return
-		}
+// LoadSignaturePolicy reads the signature policy from the environment. It
+// returns nil when no public key is configured, i.e. signatures aren't
+// required.
+func LoadSignaturePolicy() (*cosign.Policy, error) {
+	path := os.Getenv("MONOCRAT_SIGNING_PUBLIC_KEY")
+	if path == "" {
+		return nil, nil
+	}
 
-		// TODO: ideally what we want to do is check the
-		// deployment_protection_rule against owners to approve or reject. The
-		// below logic is merely to show how approving or rejecting would go in
-		// an automated fashion.
-		log.Println("[debug] commit message:", commitInfo.Message)
-		if strings.Contains(commitInfo.Message, "approve") {
-			err = gh.ApproveDeployment(r.Context(), &event)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				log.Println("[error] approving deployment:", err.Error())
-				return
-			}
-		} else {
-			err = gh.RejectDeployment(r.Context(), &event)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				log.Println("[error] rejecting deployment:", err.Error())
-				return
-			}
-		}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read MONOCRAT_SIGNING_PUBLIC_KEY: %w", err)
+	}
 
-		_, err = w.Write([]byte(""))
-		if err != nil {
-			log.Println("[error] writing reponse:", err.Error())
-			return
-		}
-	})
+	key, err := cosign.LoadPublicKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("load MONOCRAT_SIGNING_PUBLIC_KEY: %w", err)
+	}
 
-	var port string
-	if port = os.Getenv("PORT"); port == "" {
-		port = "8080"
+	var images []string
+	for _, image := range strings.Split(os.Getenv("MONOCRAT_SIGNED_IMAGES"), ",") {
+		if image = strings.TrimSpace(image); image != "" {
+			images = append(images, image)
+		}
 	}
 
-	log.Println("[info] starting server on port", port)
-	if err := http.ListenAndServe(":"+port, r); err != nil {
-		log.Println("[error] ListenAndServe", err)
+	if len(images) == 0 {
+		return nil, fmt.Errorf("missing MONOCRAT_SIGNED_IMAGES environment variable")
 	}
+
+	return &cosign.Policy{
+		Key:    key,
+		Images: images,
+		Client: &oci.Client{
+			Username: os.Getenv("OCI_REGISTRY_USERNAME"),
+			Password: os.Getenv("OCI_REGISTRY_PASSWORD"),
+			Token:    os.Getenv("OCI_REGISTRY_TOKEN"),
+		},
+	}, nil
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/manzanit0/monocrat/events"
+	"github.com/manzanit0/monocrat/pkg/github/fake"
+	"github.com/manzanit0/monocrat/pkg/webhook"
+)
+
+func TestWebhookDeploymentProtectionRule(t *testing.T) {
+	s := fake.NewServer(t)
+
+	srv := httptest.NewServer(NewRouter(newReviewer(t, s), "", ""))
+	t.Cleanup(srv.Close)
+
+	remote, sha := newRemote(t, "Bump api, approve")
+	payload := newPayload(t, remote, sha)
+	if err := webhook.Deliver(context.Background(), srv.Client(), srv.URL, "deployment_protection_rule", payload, ""); err != nil {
+		t.Fatalf("deliver: %s", err)
+	}
+
+	reviews := s.Reviews()
+	if len(reviews) != 1 {
+		t.Fatalf("reviews no match: %+v", reviews)
+	}
+
+	got := reviews[0]
+	if got.State != "approved" || got.Repository != "Manzanit0/gitops-env-per-folder-poc" || got.RunID != 4810948216 {
+		t.Fatalf("review no match: %+v", got)
+	}
+}
+
+// TestRouterFixtures replays every fixture, checking those of the events the
+// service acts on are handled and the others ignored.
+func TestRouterFixtures(t *testing.T) {
+	handled := map[string]bool{
+		"deployment_protection_rule.requested.json": true,
+		"installation.created.json":                 true,
+		"installation.deleted.json":                 true,
+		"installation_repositories.added.json":      true,
+	}
+
+	names, err := fs.Glob(events.Fixtures, "*.json")
+	if err != nil || len(names) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			s := fake.NewServer(t)
+
+			// Deployments get reviewed without reading their commits.
+			rv := newReviewer(t, s)
+			rv.Filter.Deny = []string{"*/*"}
+
+			dir := t.TempDir()
+			router := NewRouter(rv, "s3cr3t", dir)
+
+			payload, err := fs.ReadFile(events.Fixtures, name)
+			if err != nil {
+				t.Fatalf("read fixture: %s", err)
+			}
+
+			r, err := webhook.NewRequest(context.Background(), "/", webhook.EventFromFilename(name), payload, "s3cr3t")
+			if err != nil {
+				t.Fatalf("new request: %s", err)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			status, reviews := http.StatusNoContent, 0
+			if handled[name] {
+				status = http.StatusOK
+			}
+			if name == "deployment_protection_rule.requested.json" {
+				reviews = 1
+			}
+
+			if w.Code != status || len(s.Reviews()) != reviews {
+				t.Fatalf("status or reviews no match: %d, %+v", w.Code, s.Reviews())
+			}
+
+			if captured, _ := os.ReadDir(dir); len(captured) != 1 {
+				t.Fatalf("captured no match: %v", captured)
+			}
+		})
+	}
+}
+
+func TestRouterUnsigned(t *testing.T) {
+	s := fake.NewServer(t)
+	dir := t.TempDir()
+	router := NewRouter(newReviewer(t, s), "s3cr3t", dir)
+
+	remote, sha := newRemote(t, "Bump api, approve")
+	r, err := webhook.NewRequest(context.Background(), "/", "deployment_protection_rule", newPayload(t, remote, sha), "")
+	if err != nil {
+		t.Fatalf("new request: %s", err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnauthorized || len(s.Reviews()) != 0 {
+		t.Fatalf("status or reviews no match: %d, %+v", w.Code, s.Reviews())
+	}
+
+	if captured, _ := os.ReadDir(dir); len(captured) != 0 {
+		t.Fatalf("expected nothing captured, got %v", captured)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/manzanit0/monocrat/pkg/cosign"
+	"github.com/manzanit0/monocrat/pkg/gitcache"
+	"github.com/manzanit0/monocrat/pkg/github"
+)
+
+// Reviewer approves or rejects the deployments of deployment_protection_rule
+// webhooks.
+type Reviewer struct {
+	// Installations are the clients of the installations of the GitHub App.
+	Installations *github.Installations
+
+	// Clients returns the client of an installation, defaulting to that of
+	// Installations.
+	Clients func(installationID int64) github.Client
+
+	// Filter tells the repositories to protect the deployments of. Those of
+	// others are approved if ApproveFiltered, and rejected otherwise.
+	Filter          *github.RepositoryFilter
+	ApproveFiltered bool
+
+	// SignaturePolicy is what the images of deployments must be signed with.
+	// Signatures aren't required when nil.
+	SignaturePolicy *cosign.Policy
+
+	// Repositories are the mirrors the deployed commits are read from.
+	Repositories *gitcache.Cache
+}
+
+// ServeHTTP handles a webhook delivery, answering those of events other than
+// deployment_protection_rule and installations with no content.
+func (rv *Reviewer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch event := r.Header.Get("X-GitHub-Event"); event {
+	case "deployment_protection_rule":
+		// Reviewed below.
+
+	// Tokens don't reflect the permissions nor the repositories granted
+	// since they were minted.
+	case "installation", "installation_repositories":
+		var event struct {
+			Installation struct {
+				ID int64 `json:"id"`
+			} `json:"installation"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			log.Println("[error] unmarshal body:", err.Error())
+			return
+		}
+
+		if rv.Installations != nil {
+			rv.Installations.Evict(event.Installation.ID)
+		}
+		return
+
+	default:
+		log.Println("Ignoring event: not a deployment_protection_rule:", event)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var event github.DeploymentProtectionRuleEvent
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&event); err != nil && err != io.EOF {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Println("[error] unmarshal body:", err.Error())
+		return
+	}
+
+	remarshalled, err := json.Marshal(event)
+	if err == nil {
+		log.Println("[info] event received:", string(remarshalled))
+	}
+
+	gh := rv.client(event.Installation.ID)
+
+	// Deployments of repositories filtered out still need a review, or
+	// they'd wait for one forever.
+	if !rv.Filter.Allows(event.Repository.FullName) {
+		log.Println("[info] reviewing deployment of filtered out", event.Repository.FullName, "as approved:", rv.ApproveFiltered)
+		if err := review(r.Context(), gh, &event, rv.ApproveFiltered); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Println("[error] reviewing deployment:", err.Error())
+		}
+		return
+	}
+
+	token, err := gh.InstallationToken(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Println("[error] authenticating as installation:", err.Error())
+		return
+	}
+
+	// Only the commit is needed, nothing gets checked out.
+	remote := event.Repository.CloneURL
+	auth := &gitcache.Auth{Username: "x-access-token", Password: token}
+	commitInfo, err := rv.Repositories.Commit(r.Context(), remote, auth, event.Deployment.Sha)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Println("[error] checking commit info:", err.Error())
+		return
+	}
+
+	// TODO: ideally what we want to do is check the
+	// deployment_protection_rule against owners to approve or reject. The
+	// below logic is merely to show how approving or rejecting would go in
+	// an automated fashion.
+	log.Println("[debug] commit message:", commitInfo.Message)
+	approve := strings.Contains(commitInfo.Message, "approve")
+
+	// Regardless, only signed images get deployed.
+	if approve && rv.SignaturePolicy != nil {
+		policy := rv.SignaturePolicy.ForRepository(event.Repository.Owner.Login, event.Repository.Name)
+		err = policy.Check(r.Context(), event.Deployment.Sha)
+		if err != nil {
+			log.Println("[info] images failed signature policy:", err.Error())
+			approve = false
+		}
+	}
+
+	if err := review(r.Context(), gh, &event, approve); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Println("[error] reviewing deployment:", err.Error())
+		return
+	}
+
+	_, err = w.Write([]byte(""))
+	if err != nil {
+		log.Println("[error] writing reponse:", err.Error())
+		return
+	}
+}
+
+// client returns the client of the installation.
+func (rv *Reviewer) client(installationID int64) github.Client {
+	if rv.Clients != nil {
+		return rv.Clients(installationID)
+	}
+
+	return rv.Installations.Get(installationID).Client()
+}
+
+// review approves or rejects the deployment of the event.
+func review(ctx context.Context, gh github.Client, event *github.DeploymentProtectionRuleEvent, approve bool) error {
+	if approve {
+		if err := gh.ApproveDeployment(ctx, event); err != nil {
+			return fmt.Errorf("approve deployment: %w", err)
+		}
+		return nil
+	}
+
+	if err := gh.RejectDeployment(ctx, event); err != nil {
+		return fmt.Errorf("reject deployment: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/manzanit0/monocrat/events"
+	"github.com/manzanit0/monocrat/pkg/gitcache"
+	"github.com/manzanit0/monocrat/pkg/github"
+	"github.com/manzanit0/monocrat/pkg/github/fake"
+)
+
+// newRemote creates a repository with a commit of the message, returning its
+// URL and the SHA of the commit.
+func newRemote(t *testing.T, message string) (string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	run := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Jane", "GIT_AUTHOR_EMAIL=jane@example.com",
+			"GIT_COMMITTER_NAME=Jane", "GIT_COMMITTER_EMAIL=jane@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s: %s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	run("init", "--quiet")
+	run("config", "uploadpack.allowFilter", "true")
+	run("config", "uploadpack.allowAnySHA1InWant", "true")
+
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Env\n"), 0o644); err != nil {
+		t.Fatalf("create remote: %s", err)
+	}
+	run("add", ".")
+	run("commit", "--quiet", "-m", message)
+
+	return "file://" + dir, run("rev-parse", "HEAD")
+}
+
+// newPayload returns the deployment_protection_rule fixture deploying the
+// commit of the remote.
+func newPayload(t *testing.T, remote, sha string) []byte {
+	t.Helper()
+
+	b, err := events.Fixtures.ReadFile("deployment_protection_rule.requested.json")
+	if err != nil {
+		t.Fatalf("read fixture: %s", err)
+	}
+
+	var event github.DeploymentProtectionRuleEvent
+	if err := json.Unmarshal(b, &event); err != nil {
+		t.Fatalf("decode fixture: %s", err)
+	}
+	event.Repository.CloneURL = remote
+	event.Deployment.Sha = sha
+
+	if b, err = json.Marshal(event); err != nil {
+		t.Fatalf("encode fixture: %s", err)
+	}
+
+	return b
+}
+
+// newDelivery returns the payload of newPayload as a delivery.
+func newDelivery(t *testing.T, remote, sha string) *http.Request {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(newPayload(t, remote, sha)))
+	r.Header.Set("X-GitHub-Event", "deployment_protection_rule")
+	return r
+}
+
+// newReviewer returns a reviewer acting against the fake.
+func newReviewer(t *testing.T, s *fake.Server) *Reviewer {
+	t.Helper()
+
+	installations, err := s.Installations()
+	if err != nil {
+		t.Fatalf("new installations: %s", err)
+	}
+
+	return &Reviewer{
+		Installations: installations,
+		Filter:        &github.RepositoryFilter{},
+		Repositories:  &gitcache.Cache{Directory: t.TempDir()},
+	}
+}
+
+func TestReviewerServeHTTP(t *testing.T) {
+	tests := []struct {
+		name            string
+		message         string
+		deny            []string
+		approveFiltered bool
+		state           string
+	}{
+		{
+			name:    "approved commit",
+			message: "Bump api, approve",
+			state:   "approved",
+		},
+		{
+			name:    "other commit",
+			message: "Bump api",
+			state:   "rejected",
+		},
+		{
+			name:    "filtered out",
+			message: "Bump api, approve",
+			deny:    []string{"manzanit0/*"},
+			state:   "rejected",
+		},
+		{
+			name:            "filtered out and approved",
+			message:         "Bump api",
+			deny:            []string{"manzanit0/*"},
+			approveFiltered: true,
+			state:           "approved",
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			s := fake.NewServer(t)
+			rv := newReviewer(t, s)
+			rv.Filter.Deny = tests[idx].deny
+			rv.ApproveFiltered = tests[idx].approveFiltered
+
+			remote, sha := newRemote(t, tests[idx].message)
+			w := httptest.NewRecorder()
+			rv.ServeHTTP(w, newDelivery(t, remote, sha))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status no match: %d", w.Code)
+			}
+
+			reviews := s.Reviews()
+			if len(reviews) != 1 {
+				t.Fatalf("reviews no match: %+v", reviews)
+			}
+
+			got := reviews[0]
+			if got.State != tests[idx].state || got.RunID != 4810948216 || got.EnvironmentName != "production" {
+				t.Fatalf("review no match: %+v", got)
+			}
+		})
+	}
+}
+
+func TestReviewerServeHTTPUnknownCommit(t *testing.T) {
+	s := fake.NewServer(t)
+	rv := newReviewer(t, s)
+
+	remote, _ := newRemote(t, "Bump api, approve")
+	w := httptest.NewRecorder()
+	rv.ServeHTTP(w, newDelivery(t, remote, strings.Repeat("a", 40)))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status no match: %d", w.Code)
+	}
+
+	if reviews := s.Reviews(); len(reviews) != 0 {
+		t.Fatalf("expected no reviews, got %+v", reviews)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/manzanit0/monocrat/pkg/gitcache"
+	"github.com/manzanit0/monocrat/pkg/image"
+	"github.com/manzanit0/monocrat/pkg/lint"
+	"github.com/manzanit0/monocrat/pkg/monorepo"
+)
+
+// Plan is what CI makes of the changes between two commits.
+type Plan struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+
+	// Modules and ChangedFiles are relative to the root of the repository.
+	Modules      []string `json:"modules"`
+	ChangedFiles []string `json:"changed_files"`
+
+	Applications []monorepo.Application `json:"applications"`
+	LintIssues   []lint.Issue           `json:"lint_issues"`
+
+	// Images are the references the applications would be pushed as. They
+	// are unqualified, i.e. with no registry, unless registries are given:
+	// ci-check pushes to those it's configured with.
+	Images      []string `json:"images"`
+	Unqualified bool     `json:"unqualified"`
+}
+
+// registries are the registries given as flags, e.g. "ghcr.io/octo".
+type registries []image.Registry
+
+var _ flag.Value = (*registries)(nil)
+
+func (r *registries) String() string {
+	var values []string
+	for _, registry := range *r {
+		values = append(values, strings.TrimSuffix(registry.Address+"/"+registry.Namespace, "/"))
+	}
+
+	return strings.Join(values, ",")
+}
+
+func (r *registries) Set(value string) error {
+	address, namespace, _ := strings.Cut(value, "/")
+	if address == "" {
+		return fmt.Errorf("invalid registry %q: expected an address, e.g. ghcr.io/octo", value)
+	}
+
+	*r = append(*r, image.OCI(address, namespace, image.Auth{}))
+	return nil
+}
+
+// CI runs the linters and the change detection of ci-check on a local
+// repository, for the changes between two commits, without GitHub nor
+// building anything.
+func CI(args []string) error {
+	var targets registries
+	flags := flag.NewFlagSet("ci", flag.ContinueOnError)
+	repository := flags.String("repository", ".", "path to the local repository")
+	format := flags.String("format", "text", "output format: text or json")
+	runLint := flags.Bool("lint", true, "run the linters on the modules, as the lint check does")
+	verbose := flags.Bool("v", false, "print the logs of the linters to stderr")
+	flags.Var(&targets, "registry", "registry images are pushed to, e.g. ghcr.io/octo. Repeatable")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: monocrat ci [flags] <before> [<after>]")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return errUsage
+	}
+
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("invalid format %q: expected text or json", *format)
+	}
+
+	after := "HEAD"
+	if flags.NArg() == 2 {
+		after = flags.Arg(1)
+	}
+
+	var logs io.Writer
+	if *verbose {
+		logs = os.Stderr
+	}
+
+	plan, err := NewPlan(context.Background(), *repository, flags.Arg(0), after, targets, *runLint, logs)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(plan); err != nil {
+			return err
+		}
+	} else {
+		plan.Print(os.Stdout)
+	}
+
+	// As the lint check would fail.
+	if len(plan.LintIssues) > 0 {
+		return fmt.Errorf("%d lint issues", len(plan.LintIssues))
+	}
+
+	return nil
+}
+
+// NewPlan checks out the latter commit of the repository aside, as ci-check
+// does, and works out the plan for the changes since the former. The logs of
+// the linters go to w if not nil.
+func NewPlan(ctx context.Context, repository, before, after string, targets []image.Registry, runLint bool, w io.Writer) (*Plan, error) {
+	var err error
+	plan := &Plan{
+		Modules:      []string{},
+		ChangedFiles: []string{},
+		Applications: []monorepo.Application{},
+		LintIssues:   []lint.Issue{},
+		Images:       []string{},
+	}
+
+	plan.Before, err = gitcache.ResolveCommit(ctx, repository, before)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.After, err = gitcache.ResolveCommit(ctx, repository, after)
+	if err != nil {
+		return nil, err
+	}
+
+	worktree, err := gitcache.CheckoutLocal(ctx, repository, plan.After)
+	if err != nil {
+		return nil, err
+	}
+	defer worktree.Close()
+
+	// Change detection matches absolute paths.
+	repositoryPath, err := filepath.EvalSymlinks(worktree.Path)
+	if err != nil {
+		return nil, fmt.Errorf("resolve worktree path: %w", err)
+	}
+
+	// GetChangedFiles in ci-check skips the diff likewise.
+	if plan.Before != plan.After {
+		files, err := gitcache.ChangedFiles(ctx, repositoryPath, plan.Before, plan.After)
+		if err != nil {
+			return nil, err
+		}
+		plan.ChangedFiles = append(plan.ChangedFiles, files...)
+	}
+
+	var changedFiles []string
+	for _, file := range plan.ChangedFiles {
+		changedFiles = append(changedFiles, filepath.Join(repositoryPath, file))
+	}
+
+	apps, _, err := monorepo.ChangedApplications(repositoryPath, changedFiles)
+	if err != nil {
+		return nil, err
+	}
+	plan.Applications = append(plan.Applications, apps...)
+
+	modules, _, err := monorepo.FindGoModules(repositoryPath)
+	if err != nil {
+		return nil, fmt.Errorf("find Go modules: %w", err)
+	}
+
+	for _, module := range modules {
+		moduleDirectory := filepath.Dir(module)
+		relative, err := filepath.Rel(repositoryPath, moduleDirectory)
+		if err != nil {
+			return nil, err
+		}
+		plan.Modules = append(plan.Modules, relative)
+
+		if !runLint {
+			continue
+		}
+
+		report, err := lint.Lint(ctx, moduleDirectory, w)
+		if err != nil {
+			return nil, fmt.Errorf("lint %s: %w", relative, err)
+		}
+
+		// Unlike the annotations of the lint check, issues point at files
+		// from the root of the repository, to be found locally.
+		for _, issue := range report.Issues {
+			issue.Pos.Filename = filepath.Join(relative, issue.Pos.Filename)
+			plan.LintIssues = append(plan.LintIssues, issue)
+		}
+	}
+
+	plan.Unqualified = len(targets) == 0
+	for _, app := range plan.Applications {
+		if plan.Unqualified {
+			plan.Images = append(plan.Images, fmt.Sprintf("%s:%s", app.ImageRepository(), plan.After))
+		}
+
+		for _, registry := range targets {
+			plan.Images = append(plan.Images, registry.Ref(app.ImageRepository(), plan.After))
+		}
+	}
+
+	return plan, nil
+}
+
+// Print renders the plan as text.
+func (p *Plan) Print(w io.Writer) {
+	fmt.Fprintf(w, "Changes from %s to %s\n", p.Before, p.After)
+
+	section := func(title string, lines []string) {
+		fmt.Fprintf(w, "\n%s:\n", title)
+		if len(lines) == 0 {
+			fmt.Fprintln(w, "  none")
+		}
+		for _, line := range lines {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+
+	section("Modules", p.Modules)
+	section("Changed files", p.ChangedFiles)
+
+	var apps []string
+	for _, app := range p.Applications {
+		apps = append(apps, fmt.Sprintf("%s (%s)", app.Name, app.Directory))
+	}
+	section("Applications to rebuild", apps)
+
+	var issues []string
+	for _, issue := range p.LintIssues {
+		issues = append(issues, fmt.Sprintf("%s:%d:%d: %s (%s)", issue.Pos.Filename, issue.Pos.Line, issue.Pos.Column, issue.Text, issue.FromLinter))
+	}
+	section("Lint issues", issues)
+
+	if p.Unqualified {
+		section("Images (unqualified, see -registry)", p.Images)
+	} else {
+		section("Images", p.Images)
+	}
+}
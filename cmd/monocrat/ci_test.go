@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/manzanit0/monocrat/pkg/image"
+)
+
+// newRepository creates a repository with the api and worker applications and
+// the docs, returning its path and the SHAs of the commit adding them and of
+// the one changing api.
+func newRepository(t *testing.T) (string, string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	run := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Jane", "GIT_AUTHOR_EMAIL=jane@example.com",
+			"GIT_COMMITTER_NAME=Jane", "GIT_COMMITTER_EMAIL=jane@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s: %s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	write := func(name, content string) {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatalf("create repository: %s", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("create repository: %s", err)
+		}
+	}
+
+	run("init", "--quiet")
+	write("api/go.mod", "module example.com/api\n\ngo 1.22\n")
+	write("api/main.go", "package main\n")
+	write("worker/go.mod", "module example.com/worker\n\ngo 1.22\n")
+	write("worker/main.go", "package main\n")
+	write("docs/index.md", "# Docs\n")
+	run("add", ".")
+	run("commit", "--quiet", "-m", "Add api and worker")
+	before := run("rev-parse", "HEAD")
+
+	write("api/main.go", "package main\n\nfunc main() {}\n")
+	run("commit", "--quiet", "-am", "Fix api")
+	after := run("rev-parse", "HEAD")
+
+	// Uncommitted changes don't count.
+	write("worker/main.go", "package main\n\nfunc main() {}\n")
+
+	return dir, before, after
+}
+
+func TestNewPlan(t *testing.T) {
+	repository, before, after := newRepository(t)
+
+	tests := []struct {
+		name        string
+		before      string
+		targets     []image.Registry
+		files       []string
+		apps        []string
+		images      []string
+		unqualified bool
+	}{
+		{
+			name:        "unqualified",
+			before:      before,
+			files:       []string{"api/main.go"},
+			apps:        []string{"api"},
+			images:      []string{"monocrat-api:" + after},
+			unqualified: true,
+		},
+		{
+			name:    "registries",
+			before:  before,
+			targets: []image.Registry{image.OCI("ghcr.io", "octo", image.Auth{}), image.OCI("localhost:5000", "", image.Auth{})},
+			files:   []string{"api/main.go"},
+			apps:    []string{"api"},
+			images:  []string{"ghcr.io/octo/monocrat-api:" + after, "localhost:5000/monocrat-api:" + after},
+		},
+		{
+			name:        "same commit",
+			before:      "HEAD",
+			files:       []string{},
+			apps:        []string{},
+			images:      []string{},
+			unqualified: true,
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			plan, err := NewPlan(context.Background(), repository, tests[idx].before, "HEAD", tests[idx].targets, false, nil)
+			if err != nil {
+				t.Fatalf("new plan: %s", err)
+			}
+
+			if plan.After != after || !reflect.DeepEqual(plan.Modules, []string{"api", "worker"}) {
+				t.Fatalf("plan no match: %+v", plan)
+			}
+
+			apps := []string{}
+			for _, app := range plan.Applications {
+				apps = append(apps, app.Name)
+			}
+
+			if !reflect.DeepEqual(plan.ChangedFiles, tests[idx].files) || !reflect.DeepEqual(apps, tests[idx].apps) {
+				t.Fatalf("changes no match: %v, %v", plan.ChangedFiles, apps)
+			}
+
+			if !reflect.DeepEqual(plan.Images, tests[idx].images) || plan.Unqualified != tests[idx].unqualified {
+				t.Fatalf("images no match: %v, unqualified %v", plan.Images, plan.Unqualified)
+			}
+		})
+	}
+}
+
+func TestPlanPrint(t *testing.T) {
+	repository, before, _ := newRepository(t)
+
+	plan, err := NewPlan(context.Background(), repository, before, "HEAD", nil, false, nil)
+	if err != nil {
+		t.Fatalf("new plan: %s", err)
+	}
+
+	var b bytes.Buffer
+	plan.Print(&b)
+
+	if !strings.Contains(b.String(), "\nImages (unqualified, see -registry):\n  monocrat-api:") {
+		t.Fatalf("output no match: %s", b.String())
+	}
+}
+
+func TestUsage(t *testing.T) {
+	tests := []struct {
+		name    string
+		command func([]string) error
+		args    []string
+	}{
+		{name: "ci without commits", command: CI},
+		{name: "ci with too many commits", command: CI, args: []string{"a", "b", "c"}},
+		{name: "ci with unknown flag", command: CI, args: []string{"-unknown", "HEAD"}},
+		{name: "replay without payloads", command: Replay},
+		{name: "replay with unknown flag", command: Replay, args: []string{"-unknown"}},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			if err := tests[idx].command(tests[idx].args); !errors.Is(err, errUsage) {
+				t.Fatalf("error no match: %v", err)
+			}
+		})
+	}
+}
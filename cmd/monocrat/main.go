@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: monocrat <command> [flags]
+
+Commands:
+  ci      Runs the linters and the change detection of ci-check locally.
+  replay  Posts webhook payloads to a running service.
+`
+
+// errUsage is returned by commands invoked with invalid arguments, once they
+// printed their usage.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch command, args := os.Args[1], os.Args[2:]; command {
+	case "ci":
+		err = CI(args)
+
+	case "replay":
+		err = Replay(args)
+
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+
+	case errors.Is(err, errUsage):
+		os.Exit(2)
+
+	default:
+		fmt.Fprintln(os.Stderr, "[error]", err)
+		os.Exit(1)
+	}
+}
+
+// parseFlags parses the arguments of a command, returning errUsage when they
+// are invalid. flag prints why along with the usage.
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		return errUsage
+	}
+
+	return err
+}
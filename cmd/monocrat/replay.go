@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/manzanit0/monocrat/events"
+	"github.com/manzanit0/monocrat/pkg/webhook"
+)
+
+// Replay posts each payload to a running service, signed and with the headers
+// GitHub sends. Payloads are files, "-" for stdin, or the names of the bundled
+// fixtures, e.g. check_suite.requested.
+func Replay(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	url := flags.String("url", "http://localhost:8080/", "URL of the webhook of the service")
+	secret := flags.String("secret", os.Getenv("MONOCRAT_WEBHOOK_SECRET"), "secret to sign payloads with")
+	event := flags.String("event", "", "event of the payloads. Defaults to the one in their file name")
+	list := flags.Bool("list", false, "list the bundled fixtures")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: monocrat replay [flags] <payload>...")
+		flags.PrintDefaults()
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *list {
+		names, err := fs.Glob(events.Fixtures, "*.json")
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			fmt.Println(name[:len(name)-len(".json")])
+		}
+		return nil
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	for _, name := range flags.Args() {
+		payload, err := readPayload(name)
+		if err != nil {
+			return err
+		}
+
+		e := *event
+		if e == "" {
+			e = webhook.EventFromFilename(name)
+		}
+
+		if name == "-" && e == "-" {
+			return errors.New("-event is required to replay from stdin")
+		}
+
+		if err := webhook.Deliver(context.Background(), client, *url, e, payload, *secret); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		fmt.Println("[info] delivered", name, "as", e)
+	}
+
+	return nil
+}
+
+// readPayload reads the payload from stdin, a file, or the fixture by its
+// name, in that order.
+func readPayload(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+
+	payload, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		if fixture, ferr := fs.ReadFile(events.Fixtures, name+".json"); ferr == nil {
+			return fixture, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read payload: %w", err)
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Manzanit0/go-github/v52/github"
+
+	"github.com/manzanit0/monocrat/events"
+)
+
+func TestReplay(t *testing.T) {
+	var (
+		mu         sync.Mutex
+		deliveries []*http.Request
+		payloads   [][]byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := github.ValidatePayload(r, []byte("s3cr3t"))
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		deliveries = append(deliveries, r)
+		payloads = append(payloads, payload)
+	}))
+	t.Cleanup(srv.Close)
+
+	err := Replay([]string{"-url", srv.URL, "-secret", "s3cr3t", "check_suite.requested", "deployment_protection_rule.requested"})
+	if err != nil {
+		t.Fatalf("replay: %s", err)
+	}
+
+	if len(deliveries) != 2 {
+		t.Fatalf("deliveries no match: %d", len(deliveries))
+	}
+
+	for idx, event := range []string{"check_suite", "deployment_protection_rule"} {
+		if got := github.WebHookType(deliveries[idx]); got != event {
+			t.Fatalf("event no match: %s", got)
+		}
+
+		fixture, err := events.Fixtures.ReadFile(event + ".requested.json")
+		if err != nil {
+			t.Fatalf("read fixture: %s", err)
+		}
+
+		if !bytes.Equal(payloads[idx], fixture) {
+			t.Fatalf("payload of %s no match", event)
+		}
+	}
+}
+
+func TestReplayRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(srv.Close)
+
+	err := Replay([]string{"-url", srv.URL, "check_suite.requested"})
+	if err == nil || err.Error() != "check_suite.requested: deliver check_suite: 401 Unauthorized" {
+		t.Fatalf("error no match: %v", err)
+	}
+}
@@ -0,0 +1,10 @@
+// Package events bundles recorded webhook payloads, one per file named after
+// the event and its action, e.g. check_suite.requested.json.
+package events
+
+import "embed"
+
+// Fixtures are the recorded payloads.
+//
+//go:embed *.json
+var Fixtures embed.FS
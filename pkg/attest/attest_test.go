@@ -0,0 +1,201 @@
+package attest
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const goVersionM = `/tmp/app: go1.22.2
+	path	github.com/manzanit0/monocrat/cmd/ci-check
+	mod	github.com/manzanit0/monocrat	(devel)	
+	dep	github.com/go-chi/chi/v5	v5.0.8	h1:lD+NLqFcAi1ovnVZpsnObHGW4xb4J8lNmoYVfECH1Y0=
+	dep	github.com/google/go-github/v52	v52.0.0
+	=>	github.com/Manzanit0/go-github/v52	v52.0.0-20230504111216-68da982bbf44	h1:mswC+sW/TpIFG+AadATRlmvfYOyHuqA2Plz9W0Tz8mo=
+	build	-ldflags="-X main.version=1.2.3"
+	build	CGO_ENABLED=0
+	build	GOARCH=arm64
+	build	GOOS=linux
+`
+
+func TestParseGoVersionM(t *testing.T) {
+	info, err := ParseGoVersionM(goVersionM)
+	if err != nil {
+		t.Fatalf("parse: %s", err)
+	}
+
+	if info.GoVersion != "go1.22.2" {
+		t.Fatalf("go version no match: %s", info.GoVersion)
+	}
+
+	main, deps := Modules(info)
+	if main.Path != "github.com/manzanit0/monocrat" {
+		t.Fatalf("main module no match: %s", main.Path)
+	}
+
+	want := []Module{
+		{Path: "stdlib", Version: "go1.22.2"},
+		{Path: "github.com/go-chi/chi/v5", Version: "v5.0.8"},
+		{Path: "github.com/Manzanit0/go-github/v52", Version: "v52.0.0-20230504111216-68da982bbf44"},
+	}
+	if len(deps) != len(want) {
+		t.Fatalf("expected %d modules, got %v", len(want), deps)
+	}
+
+	for i := range want {
+		if deps[i] != want[i] {
+			t.Fatalf("module %d no match: %+v", i, deps[i])
+		}
+	}
+
+	settings := BuildSettings(info)
+	if settings["-ldflags"] != "-X main.version=1.2.3" || settings["GOARCH"] != "arm64" {
+		t.Fatalf("build settings no match: %v", settings)
+	}
+}
+
+func TestParseGoVersionMNotGo(t *testing.T) {
+	_, err := ParseGoVersionM("/tmp/app: could not read Go build info from /tmp/app: not a Go executable")
+	if err == nil {
+		t.Fatal("expected error for a non-Go binary")
+	}
+}
+
+func TestModulePURL(t *testing.T) {
+	m := Module{Path: "github.com/Manzanit0/go-github/v52", Version: "v52.0.0+incompatible"}
+	if purl := m.PURL(); purl != "pkg:golang/github.com/Manzanit0/go-github/v52@v52.0.0+incompatible" {
+		t.Fatalf("purl no match: %s", purl)
+	}
+}
+
+func TestGenerateSBOM(t *testing.T) {
+	info, err := ParseGoVersionM(goVersionM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format    string
+		mediaType string
+		contains  []string
+	}{
+		{
+			format:    FormatSPDX,
+			mediaType: MediaTypeSPDX,
+			contains:  []string{`"spdxVersion": "SPDX-2.3"`, `"referenceLocator": "pkg:golang/github.com/go-chi/chi/v5@v5.0.8"`, `"relationshipType": "DEPENDS_ON"`},
+		},
+		{
+			format:    FormatCycloneDX,
+			mediaType: MediaTypeCycloneDX,
+			contains:  []string{`"bomFormat": "CycloneDX"`, `"purl": "pkg:golang/stdlib@go1.22.2"`, `"serialNumber": "urn:uuid:`},
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].format, func(t *testing.T) {
+			sbom, err := GenerateSBOM(info, SBOMOptions{
+				Format:        tests[idx].format,
+				Subject:       "ghcr.io/manzanit0/monocrat-ci-check",
+				SubjectDigest: "sha256:4f2a",
+				Created:       time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			})
+			if err != nil {
+				t.Fatalf("generate: %s", err)
+			}
+
+			if sbom.MediaType != tests[idx].mediaType {
+				t.Fatalf("media type no match: %s", sbom.MediaType)
+			}
+
+			if sbom.Packages != 4 {
+				t.Fatalf("expected 4 packages, got %d", sbom.Packages)
+			}
+
+			for _, s := range tests[idx].contains {
+				if !strings.Contains(string(sbom.Content), s) {
+					t.Fatalf("SBOM doesn't contain %s:\n%s", s, sbom.Content)
+				}
+			}
+		})
+	}
+
+	if _, err := GenerateSBOM(info, SBOMOptions{Format: "swid"}); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func TestGenerateProvenance(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       ProvenanceOptions
+		parameters map[string]any
+	}{
+		{
+			name: "generated",
+			opts: ProvenanceOptions{BuilderImage: "golang:1.22"},
+			parameters: map[string]any{
+				"build":        "generated",
+				"builderImage": "golang:1.22",
+			},
+		},
+		{
+			name: "Dockerfile",
+			opts: ProvenanceOptions{Dockerfile: "cmd/ci-check/Dockerfile", Target: "release"},
+			parameters: map[string]any{
+				"build":      "dockerfile",
+				"dockerfile": "cmd/ci-check/Dockerfile",
+				"target":     "release",
+			},
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			opts := tests[idx].opts
+			opts.Subject = "ghcr.io/manzanit0/monocrat-ci-check"
+			opts.SubjectDigest = "sha256:4f2a"
+			opts.Repository = "https://github.com/manzanit0/monocrat.git"
+			opts.SHA = "28432ff413ca013a6a7c7cd344876c14611256b0"
+			opts.AppDirectory = "cmd/ci-check/main.go"
+			opts.BuildFlags = map[string]string{"CGO_ENABLED": "0"}
+
+			b, err := GenerateProvenance(opts)
+			if err != nil {
+				t.Fatalf("generate: %s", err)
+			}
+
+			var s struct {
+				Subject []struct {
+					Name   string            `json:"name"`
+					Digest map[string]string `json:"digest"`
+				} `json:"subject"`
+				PredicateType string `json:"predicateType"`
+				Predicate     struct {
+					BuildDefinition struct {
+						ExternalParameters map[string]any `json:"externalParameters"`
+						InternalParameters map[string]any `json:"internalParameters"`
+					} `json:"buildDefinition"`
+				} `json:"predicate"`
+			}
+			if err := json.Unmarshal(b, &s); err != nil {
+				t.Fatalf("unmarshal: %s", err)
+			}
+
+			if s.Subject[0].Digest["sha256"] != "4f2a" || s.PredicateType != "https://slsa.dev/provenance/v1" {
+				t.Fatalf("statement no match: %s", b)
+			}
+
+			if s.Predicate.BuildDefinition.ExternalParameters["sha"] != "28432ff413ca013a6a7c7cd344876c14611256b0" {
+				t.Fatalf("sha no match: %v", s.Predicate.BuildDefinition.ExternalParameters)
+			}
+
+			internal := s.Predicate.BuildDefinition.InternalParameters
+			delete(internal, "buildFlags")
+			if !reflect.DeepEqual(internal, tests[idx].parameters) {
+				t.Fatalf("internal parameters no match: %v", internal)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package attest
+
+import (
+	"fmt"
+	"net/url"
+	"runtime/debug"
+	"strings"
+)
+
+// ParseGoVersionM parses the output of `go version -m <binary>`, which is the
+// build information embedded in the binary prefixed with its file name and Go
+// version:
+//
+//	/bin/app: go1.22.2
+//		path	github.com/manzanit0/monocrat/cmd/ci-check
+//		mod	github.com/manzanit0/monocrat	(devel)
+//		dep	github.com/go-chi/chi/v5	v5.0.8	h1:...
+//		build	CGO_ENABLED=0
+func ParseGoVersionM(output string) (*debug.BuildInfo, error) {
+	header, rest, _ := strings.Cut(strings.TrimSpace(output), "\n")
+
+	i := strings.LastIndex(header, ": ")
+	if i < 0 {
+		return nil, fmt.Errorf("not a Go binary: %s", header)
+	}
+	goVersion := strings.TrimSpace(header[i+2:])
+	if !strings.HasPrefix(goVersion, "go") || strings.ContainsAny(goVersion, " \t") {
+		return nil, fmt.Errorf("not a Go binary: %s", header)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(rest, "\n") {
+		if line = strings.TrimPrefix(strings.TrimRight(line, "\r"), "\t"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	info, err := debug.ParseBuildInfo(strings.Join(lines, "\n") + "\n")
+	if err != nil {
+		return nil, fmt.Errorf("parse build info: %w", err)
+	}
+
+	// The parser leaves the Go version out, it's only in the header anyway.
+	info.GoVersion = goVersion
+
+	return info, nil
+}
+
+// Module is a Go module linked into a binary.
+type Module struct {
+	Path    string
+	Version string
+}
+
+// PURL returns the package URL of the module.
+// https://github.com/package-url/purl-spec/blob/master/PURL-TYPES.rst#golang
+func (m Module) PURL() string {
+	segments := strings.Split(m.Path, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+
+	purl := "pkg:golang/" + strings.Join(segments, "/")
+	if m.Version != "" {
+		purl = fmt.Sprintf("%s@%s", purl, url.PathEscape(m.Version))
+	}
+
+	return purl
+}
+
+// Modules returns the main module and the dependencies of the binary, with
+// replacements applied since they are what actually got compiled. The Go
+// standard library is listed as the "stdlib" module.
+func Modules(info *debug.BuildInfo) (Module, []Module) {
+	main := Module{Path: info.Main.Path, Version: info.Main.Version}
+	if main.Path == "" {
+		main.Path = info.Path
+	}
+
+	deps := []Module{{Path: "stdlib", Version: info.GoVersion}}
+	for _, dep := range info.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+
+		deps = append(deps, Module{Path: dep.Path, Version: dep.Version})
+	}
+
+	return main, deps
+}
+
+// BuildSettings returns the build settings recorded in the binary, such as
+// -ldflags, -tags, CGO_ENABLED, GOOS and GOARCH.
+func BuildSettings(info *debug.BuildInfo) map[string]string {
+	settings := map[string]string{}
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+
+	return settings
+}
@@ -0,0 +1,148 @@
+package attest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	MediaTypeInToto = "application/vnd.in-toto+json"
+
+	// ArtifactTypeProvenance identifies provenance referrers, since in-toto
+	// statements may carry all sorts of predicates.
+	ArtifactTypeProvenance = "application/vnd.dev.monocrat.provenance.v1+json"
+
+	// BuildType identifies how monocrat builds images: the build definition
+	// parameters below only make sense for it.
+	BuildType = "https://github.com/manzanit0/monocrat/buildtypes/dagger/v1"
+	BuilderID = "https://github.com/manzanit0/monocrat"
+
+	inTotoStatementType     = "https://in-toto.io/Statement/v1"
+	slsaProvenancePredicate = "https://slsa.dev/provenance/v1"
+)
+
+// ProvenanceOptions describe how an image was built.
+type ProvenanceOptions struct {
+	// Subject is the name of the image, e.g. "ghcr.io/manzanit0/monocrat",
+	// and SubjectDigest its digest.
+	Subject       string
+	SubjectDigest string
+
+	// Repository is the URL of the source repository and SHA the commit
+	// built.
+	Repository string
+	SHA        string
+
+	AppDirectory string
+	Platforms    []string
+
+	// BuilderImage is the image the binary was compiled in, for generated
+	// builds, and Dockerfile and Target the Dockerfile used otherwise. The
+	// build is recorded as Dockerfile-based when Dockerfile is set, and the
+	// builder image left out since the Dockerfile picks its own.
+	BuilderImage string
+	Dockerfile   string
+	Target       string
+
+	// BuildFlags are the build settings recorded in the binary, such as
+	// -ldflags, -tags and CGO_ENABLED.
+	BuildFlags map[string]string
+
+	StartedOn  time.Time
+	FinishedOn time.Time
+}
+
+// https://slsa.dev/spec/v1.0/provenance
+type statement struct {
+	Type          string          `json:"_type"`
+	Subject       []subject       `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+type subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type provenance struct {
+	BuildDefinition struct {
+		BuildType            string               `json:"buildType"`
+		ExternalParameters   map[string]any       `json:"externalParameters"`
+		InternalParameters   map[string]any       `json:"internalParameters"`
+		ResolvedDependencies []resourceDescriptor `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		Metadata struct {
+			StartedOn  string `json:"startedOn"`
+			FinishedOn string `json:"finishedOn"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+type resourceDescriptor struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+// GenerateProvenance generates a SLSA provenance in-toto statement about the
+// image.
+func GenerateProvenance(opts ProvenanceOptions) ([]byte, error) {
+	algorithm, digest, ok := strings.Cut(opts.SubjectDigest, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid subject digest %q", opts.SubjectDigest)
+	}
+
+	var p provenance
+	p.BuildDefinition.BuildType = BuildType
+	p.BuildDefinition.ExternalParameters = map[string]any{
+		"repository":   opts.Repository,
+		"sha":          opts.SHA,
+		"appDirectory": opts.AppDirectory,
+		"platforms":    opts.Platforms,
+	}
+
+	internal := map[string]any{"buildFlags": opts.BuildFlags}
+	if opts.Dockerfile != "" {
+		internal["build"] = "dockerfile"
+		internal["dockerfile"] = opts.Dockerfile
+		internal["target"] = opts.Target
+	} else {
+		internal["build"] = "generated"
+		internal["builderImage"] = opts.BuilderImage
+	}
+	p.BuildDefinition.InternalParameters = internal
+
+	p.BuildDefinition.ResolvedDependencies = []resourceDescriptor{
+		{
+			URI:    fmt.Sprintf("git+%s@%s", opts.Repository, opts.SHA),
+			Digest: map[string]string{"gitCommit": opts.SHA},
+		},
+	}
+
+	p.RunDetails.Builder.ID = BuilderID
+	p.RunDetails.Metadata.StartedOn = opts.StartedOn.UTC().Format(time.RFC3339)
+	p.RunDetails.Metadata.FinishedOn = opts.FinishedOn.UTC().Format(time.RFC3339)
+
+	predicate, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("marshal provenance: %w", err)
+	}
+
+	b, err := json.MarshalIndent(statement{
+		Type:          inTotoStatementType,
+		Subject:       []subject{{Name: opts.Subject, Digest: map[string]string{algorithm: digest}}},
+		PredicateType: slsaProvenancePredicate,
+		Predicate:     predicate,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal statement: %w", err)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,232 @@
+package attest
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+const (
+	FormatSPDX      = "spdx"
+	FormatCycloneDX = "cyclonedx"
+
+	MediaTypeSPDX      = "application/spdx+json"
+	MediaTypeCycloneDX = "application/vnd.cyclonedx+json"
+
+	// toolName is how monocrat identifies itself as the creator of documents.
+	toolName = "monocrat"
+)
+
+// SBOM is a software bill of materials of a Go binary.
+type SBOM struct {
+	Format    string
+	MediaType string
+	Content   []byte
+
+	// Packages is the number of packages listed, for summaries.
+	Packages int
+}
+
+// SBOMOptions describe what the SBOM is about.
+type SBOMOptions struct {
+	// Format is either spdx or cyclonedx. Defaults to spdx.
+	Format string
+
+	// Subject is the name of the image the binary ships in, and SubjectDigest
+	// its digest. They identify the document.
+	Subject       string
+	SubjectDigest string
+
+	// Created is the creation time of the document.
+	Created time.Time
+}
+
+// GenerateSBOM generates an SBOM of the binary's module graph in the requested
+// format.
+func GenerateSBOM(info *debug.BuildInfo, opts SBOMOptions) (*SBOM, error) {
+	main, deps := Modules(info)
+
+	var (
+		content   []byte
+		mediaType string
+		err       error
+	)
+
+	format := opts.Format
+	switch format {
+	case "", FormatSPDX:
+		format = FormatSPDX
+		mediaType = MediaTypeSPDX
+		content, err = json.MarshalIndent(spdxDocument(main, deps, opts), "", "  ")
+	case FormatCycloneDX:
+		mediaType = MediaTypeCycloneDX
+		content, err = json.MarshalIndent(cycloneDXDocument(main, deps, opts), "", "  ")
+	default:
+		return nil, fmt.Errorf("unknown SBOM format %q: expected spdx or cyclonedx", opts.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("marshal %s document: %w", format, err)
+	}
+
+	return &SBOM{Format: format, MediaType: mediaType, Content: content, Packages: len(deps) + 1}, nil
+}
+
+// https://spdx.github.io/spdx-spec/v2.3/
+type spdxDoc struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+func spdxDocument(main Module, deps []Module, opts SBOMOptions) spdxDoc {
+	pkg := func(id string, m Module) spdxPackage {
+		return spdxPackage{
+			Name:             m.Path,
+			SPDXID:           id,
+			VersionInfo:      m.Version,
+			DownloadLocation: "NOASSERTION",
+			ExternalRefs: []spdxExternalRef{
+				{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: m.PURL()},
+			},
+		}
+	}
+
+	doc := spdxDoc{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              opts.Subject,
+		DocumentNamespace: fmt.Sprintf("https://github.com/manzanit0/monocrat/spdx/%s", strings.TrimPrefix(opts.SubjectDigest, "sha256:")),
+		CreationInfo: spdxCreationInfo{
+			Created:  opts.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + toolName},
+		},
+		Packages: []spdxPackage{pkg("SPDXRef-Package-main", main)},
+		Relationships: []spdxRelationship{
+			{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-Package-main"},
+		},
+	}
+
+	for i, dep := range deps {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i)
+		doc.Packages = append(doc.Packages, pkg(id, dep))
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      "SPDXRef-Package-main",
+			RelationshipType:   "DEPENDS_ON",
+			RelatedSPDXElement: id,
+		})
+	}
+
+	return doc
+}
+
+// https://cyclonedx.org/docs/1.5/json/
+type cycloneDXDoc struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	SerialNumber string                `json:"serialNumber"`
+	Version      int                   `json:"version"`
+	Metadata     cycloneDXMetadata     `json:"metadata"`
+	Components   []cycloneDXComponent  `json:"components"`
+	Dependencies []cycloneDXDependency `json:"dependencies"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string `json:"timestamp"`
+	Tools     struct {
+		Components []cycloneDXComponent `json:"components"`
+	} `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXComponent struct {
+	Type    string `json:"type"`
+	BOMRef  string `json:"bom-ref,omitempty"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	PURL    string `json:"purl,omitempty"`
+}
+
+type cycloneDXDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+func cycloneDXDocument(main Module, deps []Module, opts SBOMOptions) cycloneDXDoc {
+	doc := cycloneDXDoc{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + uuidFrom(opts.SubjectDigest),
+		Version:      1,
+	}
+
+	doc.Metadata.Timestamp = opts.Created.UTC().Format(time.RFC3339)
+	doc.Metadata.Tools.Components = []cycloneDXComponent{{Type: "application", Name: toolName}}
+	doc.Metadata.Component = cycloneDXComponent{
+		Type:    "application",
+		BOMRef:  main.PURL(),
+		Name:    main.Path,
+		Version: main.Version,
+		PURL:    main.PURL(),
+	}
+
+	mainDependency := cycloneDXDependency{Ref: main.PURL(), DependsOn: []string{}}
+	for _, dep := range deps {
+		doc.Components = append(doc.Components, cycloneDXComponent{
+			Type:    "library",
+			BOMRef:  dep.PURL(),
+			Name:    dep.Path,
+			Version: dep.Version,
+			PURL:    dep.PURL(),
+		})
+		mainDependency.DependsOn = append(mainDependency.DependsOn, dep.PURL())
+	}
+	doc.Dependencies = []cycloneDXDependency{mainDependency}
+
+	return doc
+}
+
+// uuidFrom derives a version 4 formatted UUID from a seed, so that documents
+// about the same subject get the same serial number.
+func uuidFrom(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	b := sum[:16]
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/manzanit0/monocrat/pkg/image"
+)
+
+// FileName is the name of the configuration file, at the root of the
+// repository.
+const FileName = ".monocrat.json"
+
+// Config is the configuration of a repository monocrat operates on. An
+// example:
+//
+//	{
+//	  "build": { "runtime": "distroless", "user": "nonroot" },
+//	  "apps": {
+//	    "ci-check": {
+//	      "build": { "ports": [8080], "ldflags": "-s -w" }
+//	    }
+//	  }
+//	}
+type Config struct {
+	// Build is the build profile every application starts from.
+	Build image.BuildProfile `json:"build"`
+
+	// Apps holds the configuration for specific applications, keyed by the
+	// application's name.
+	Apps map[string]App `json:"apps,omitempty"`
+}
+
+type App struct {
+	// Build overrides the repository's build profile for the application.
+	Build image.BuildProfile `json:"build"`
+
+	// Dockerfile builds the application from a Dockerfile instead of the
+	// build profile.
+	Dockerfile *image.Dockerfile `json:"dockerfile,omitempty"`
+}
+
+// Load reads the configuration at the root of the repository. Repositories
+// without configuration get an empty one.
+func Load(repositoryDirectory string) (*Config, error) {
+	b, err := os.ReadFile(filepath.Join(repositoryDirectory, FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read %s: %w", FileName, err)
+	}
+
+	var c Config
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", FileName, err)
+	}
+
+	if err := c.Build.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid build profile: %w", err)
+	}
+
+	for name, app := range c.Apps {
+		if err := c.BuildProfile(name).Validate(); err != nil {
+			return nil, fmt.Errorf("invalid build profile for %s: %w", name, err)
+		}
+
+		if app.Dockerfile != nil && app.Dockerfile.Path == "" {
+			return nil, fmt.Errorf("invalid Dockerfile for %s: missing path", name)
+		}
+	}
+
+	return &c, nil
+}
+
+// BuildProfile returns the build profile of an application: the repository's
+// profile with the application's overrides on top.
+func (c *Config) BuildProfile(appName string) image.BuildProfile {
+	app, ok := c.Apps[appName]
+	if !ok {
+		return c.Build
+	}
+
+	return c.Build.Merge(app.Build)
+}
+
+// Dockerfile returns the Dockerfile declared for an application, or nil if it
+// has none.
+func (c *Config) Dockerfile(appName string) *image.Dockerfile {
+	return c.Apps[appName].Dockerfile
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		app     string
+		runtime string
+		ports   int
+		fail    bool
+	}{
+		{
+			name:    "missing file",
+			app:     "ci-check",
+			runtime: "",
+		},
+		{
+			name:    "app overrides repository profile",
+			content: `{"build": {"runtime": "distroless"}, "apps": {"ci-check": {"build": {"runtime": "scratch", "ports": [8080]}}}}`,
+			app:     "ci-check",
+			runtime: "scratch",
+			ports:   1,
+		},
+		{
+			name:    "app without overrides",
+			content: `{"build": {"runtime": "distroless"}, "apps": {"ci-check": {"build": {"ports": [8080]}}}}`,
+			app:     "deployment-protection-rule",
+			runtime: "distroless",
+		},
+		{
+			name:    "unknown field",
+			content: `{"build": {"runtime_img": "alpine:3.20"}}`,
+			fail:    true,
+		},
+		{
+			name:    "dockerfile without path",
+			content: `{"apps": {"ci-check": {"dockerfile": {"target": "release"}}}}`,
+			fail:    true,
+		},
+		{
+			name:    "invalid app profile",
+			content: `{"apps": {"ci-check": {"build": {"runtime": "ubuntu"}}}}`,
+			fail:    true,
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tests[idx].content != "" {
+				err := os.WriteFile(filepath.Join(dir, FileName), []byte(tests[idx].content), 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			c, err := Load(dir)
+			if err != nil && tests[idx].fail {
+				return
+			} else if err != nil {
+				t.Fatalf(err.Error())
+			} else if tests[idx].fail {
+				t.Fatalf("expected configuration to be invalid")
+			}
+
+			profile := c.BuildProfile(tests[idx].app)
+			if profile.Runtime != tests[idx].runtime {
+				t.Fatalf("runtime no match: %s", profile.Runtime)
+			}
+
+			if len(profile.Ports) != tests[idx].ports {
+				t.Fatalf("ports no match: %v", profile.Ports)
+			}
+		})
+	}
+}
+
+func TestDockerfile(t *testing.T) {
+	dir := t.TempDir()
+	content := `{"apps": {"ci-check": {"dockerfile": {"path": "build/ci-check.Dockerfile", "target": "release", "build_args": {"GO_VERSION": "1.22"}}}}}`
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dockerfile := c.Dockerfile("ci-check")
+	if dockerfile == nil {
+		t.Fatal("expected a Dockerfile for ci-check")
+	}
+
+	if dockerfile.Path != "build/ci-check.Dockerfile" || dockerfile.Target != "release" || dockerfile.BuildArgs["GO_VERSION"] != "1.22" {
+		t.Fatalf("Dockerfile no match: %+v", dockerfile)
+	}
+
+	if c.Dockerfile("deployment-protection-rule") != nil {
+		t.Fatal("expected no Dockerfile for deployment-protection-rule")
+	}
+}
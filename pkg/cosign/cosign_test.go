@@ -0,0 +1,274 @@
+package cosign
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/manzanit0/monocrat/pkg/oci"
+	"github.com/manzanit0/monocrat/pkg/oci/ocitest"
+)
+
+func TestLoadPrivateKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %s", err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %s", err)
+	}
+
+	sec1, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		pem      []byte
+		password string
+		err      error
+	}{
+		{
+			name:     "cosign encrypted key",
+			pem:      encryptKey(t, pemTypeEncryptedKey, pkcs8, "hunter2"),
+			password: "hunter2",
+		},
+		{
+			name:     "legacy cosign encrypted key",
+			pem:      encryptKey(t, pemTypeLegacyEncryptedKey, pkcs8, "hunter2"),
+			password: "hunter2",
+		},
+		{
+			name:     "wrong password",
+			pem:      encryptKey(t, pemTypeEncryptedKey, pkcs8, "hunter2"),
+			password: "hunter3",
+			err:      ErrInvalidPassword,
+		},
+		{
+			name: "PKCS#8 key",
+			pem:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+		},
+		{
+			name: "SEC 1 key",
+			pem:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}),
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			loaded, err := LoadPrivateKey(tests[idx].pem, []byte(tests[idx].password))
+			if tests[idx].err != nil {
+				if !errors.Is(err, tests[idx].err) {
+					t.Fatalf("expected error %q, got %v", tests[idx].err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("load key: %s", err)
+			}
+
+			if !loaded.Equal(key) {
+				t.Fatalf("loaded key doesn't match")
+			}
+		})
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	ctx := context.Background()
+	registry := ocitest.NewRegistry(t)
+	c := &oci.Client{}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %s", err)
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %s", err)
+	}
+
+	signed := oci.Reference{Registry: registry.Address(), Repository: "monocrat", Digest: registry.PutImage("monocrat", "1.2.3", []byte("signed"))}
+	unsigned := oci.Reference{Registry: registry.Address(), Repository: "monocrat", Digest: registry.PutImage("monocrat", "1.2.4", []byte("unsigned"))}
+
+	if _, err := Sign(ctx, c, signed, otherKey); err != nil {
+		t.Fatalf("sign: %s", err)
+	}
+
+	if _, err := Sign(ctx, c, signed, key); err != nil {
+		t.Fatalf("sign: %s", err)
+	}
+
+	if err := Verify(ctx, c, signed, &key.PublicKey); err != nil {
+		t.Fatalf("verify signed image: %s", err)
+	}
+
+	wrongKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %s", err)
+	}
+
+	if err := Verify(ctx, c, signed, &wrongKey.PublicKey); err == nil {
+		t.Fatalf("expected verification with the wrong key to fail")
+	}
+
+	if err := Verify(ctx, c, unsigned, &key.PublicKey); !errors.Is(err, ErrNoSignature) {
+		t.Fatalf("expected ErrNoSignature, got %v", err)
+	}
+
+	// Copying the signatures of an image over to another one must not make it
+	// signed.
+	signatures, ok := registry.Manifest("monocrat", SignatureTag(signed).Tag)
+	if !ok {
+		t.Fatalf("signatures not found")
+	}
+
+	if _, _, err := c.PushManifest(ctx, SignatureTag(unsigned), oci.MediaTypeImageManifest, signatures); err != nil {
+		t.Fatalf("copy signatures: %s", err)
+	}
+
+	if err := Verify(ctx, c, unsigned, &key.PublicKey); err == nil || errors.Is(err, ErrNoSignature) {
+		t.Fatalf("expected copied signatures to be invalid, got %v", err)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	ctx := context.Background()
+	registry := ocitest.NewRegistry(t)
+	c := &oci.Client{}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %s", err)
+	}
+
+	sha := "0c1bd1e5e8bc4ac5ab12d6d56d1b6a1cfc0f2a39"
+	for _, repository := range []string{"monocrat-api", "monocrat-worker"} {
+		digest := registry.PutImage(repository, sha, []byte(repository))
+		if _, err := Sign(ctx, c, oci.Reference{Registry: registry.Address(), Repository: repository, Digest: digest}, key); err != nil {
+			t.Fatalf("sign: %s", err)
+		}
+	}
+	registry.PutImage("monocrat-unsigned", sha, []byte("unsigned"))
+
+	tests := []struct {
+		name   string
+		images []string
+		sha    string
+		valid  bool
+	}{
+		{
+			name:   "all images signed",
+			images: []string{"monocrat-api", "monocrat-worker"},
+			sha:    sha,
+			valid:  true,
+		},
+		{
+			name:   "unsigned image",
+			images: []string{"monocrat-api", "monocrat-unsigned"},
+			sha:    sha,
+			valid:  false,
+		},
+		{
+			name:   "no image for the commit",
+			images: []string{"monocrat-api"},
+			sha:    "5a1e3c33d3e0f4b9b2a0d8a2b5c3e1f0a9b8c7d6",
+			valid:  false,
+		},
+		{
+			name:   "no images",
+			images: nil,
+			sha:    sha,
+			valid:  false,
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			var images []string
+			for _, image := range tests[idx].images {
+				images = append(images, registry.Address()+"/"+image)
+			}
+
+			p := &Policy{Key: &key.PublicKey, Client: c, Images: images}
+			err := p.Check(ctx, tests[idx].sha)
+			if tests[idx].valid && err != nil {
+				t.Fatalf("expected policy to pass, got %s", err)
+			}
+
+			if !tests[idx].valid && err == nil {
+				t.Fatalf("expected policy to fail")
+			}
+		})
+	}
+}
+
+func TestPolicyForRepository(t *testing.T) {
+	p := &Policy{Images: []string{"ghcr.io/{owner}/{repository}-api", "docker.io/acme/worker"}}
+
+	got := p.ForRepository("Octo", "Monorepo").Images
+	want := []string{"ghcr.io/octo/monorepo-api", "docker.io/acme/worker"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("images no match: %v", got)
+	}
+
+	if p.Images[0] != "ghcr.io/{owner}/{repository}-api" {
+		t.Fatalf("policy modified: %v", p.Images)
+	}
+}
+
+// encryptKey encrypts a PKCS#8 key like `cosign generate-key-pair` does, with
+// cheaper scrypt parameters.
+func encryptKey(t *testing.T, pemType string, der []byte, password string) []byte {
+	var k encryptedKey
+	k.KDF.Name = "scrypt"
+	k.KDF.Params.N = 1024
+	k.KDF.Params.R = 8
+	k.KDF.Params.P = 1
+	k.KDF.Salt = make([]byte, 32)
+	k.Cipher.Name = "nacl/secretbox"
+	k.Cipher.Nonce = make([]byte, 24)
+
+	if _, err := rand.Read(k.KDF.Salt); err != nil {
+		t.Fatalf("generate salt: %s", err)
+	}
+
+	if _, err := rand.Read(k.Cipher.Nonce); err != nil {
+		t.Fatalf("generate nonce: %s", err)
+	}
+
+	secret, err := scrypt.Key([]byte(password), k.KDF.Salt, k.KDF.Params.N, k.KDF.Params.R, k.KDF.Params.P, 32)
+	if err != nil {
+		t.Fatalf("derive key: %s", err)
+	}
+
+	var (
+		nonce [24]byte
+		key   [32]byte
+	)
+	copy(nonce[:], k.Cipher.Nonce)
+	copy(key[:], secret)
+	k.Ciphertext = secretbox.Seal(nil, der, &nonce, &key)
+
+	b, err := json.Marshal(k)
+	if err != nil {
+		t.Fatalf("marshal key: %s", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: b})
+}
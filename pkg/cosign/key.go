@@ -0,0 +1,153 @@
+package cosign
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// pemTypeEncryptedKey is the PEM block type of the keys generated by
+	// `cosign generate-key-pair`. Older versions of cosign used the other one.
+	pemTypeEncryptedKey       = "ENCRYPTED SIGSTORE PRIVATE KEY"
+	pemTypeLegacyEncryptedKey = "ENCRYPTED COSIGN PRIVATE KEY"
+)
+
+// ErrInvalidPassword is returned when an encrypted key can't be decrypted
+// with the given password.
+var ErrInvalidPassword = errors.New("invalid password for private key")
+
+// encryptedKey is the content of an encrypted cosign private key: a PKCS#8
+// key sealed with NaCl secretbox under a scrypt-derived key.
+type encryptedKey struct {
+	KDF struct {
+		Name   string `json:"name"`
+		Params struct {
+			N int `json:"N"`
+			R int `json:"r"`
+			P int `json:"p"`
+		} `json:"params"`
+		Salt []byte `json:"salt"`
+	} `json:"kdf"`
+	Cipher struct {
+		Name  string `json:"name"`
+		Nonce []byte `json:"nonce"`
+	} `json:"cipher"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// LoadPrivateKey parses a PEM encoded ECDSA private key, either as generated
+// by `cosign generate-key-pair` and encrypted with the password, or
+// unencrypted in PKCS#8 or SEC 1 form.
+func LoadPrivateKey(b, password []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in private key")
+	}
+
+	switch block.Type {
+	case pemTypeEncryptedKey, pemTypeLegacyEncryptedKey:
+		der, err := decrypt(block.Bytes, password)
+		if err != nil {
+			return nil, err
+		}
+
+		return parsePKCS8(der)
+
+	case "PRIVATE KEY":
+		return parsePKCS8(block.Bytes)
+
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse EC private key: %w", err)
+		}
+
+		return key, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported private key type %q", block.Type)
+	}
+}
+
+// LoadPublicKey parses a PEM encoded ECDSA public key, such as cosign.pub.
+func LoadPublicKey(b []byte) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in public key")
+	}
+
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("unsupported public key type %q", block.Type)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key %T: expected ECDSA", key)
+	}
+
+	return ecdsaKey, nil
+}
+
+func parsePKCS8(der []byte) (*ecdsa.PrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse PKCS#8 private key: %w", err)
+	}
+
+	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key %T: expected ECDSA", key)
+	}
+
+	return ecdsaKey, nil
+}
+
+func decrypt(b, password []byte) ([]byte, error) {
+	var k encryptedKey
+	if err := json.Unmarshal(b, &k); err != nil {
+		return nil, fmt.Errorf("unmarshal encrypted private key: %w", err)
+	}
+
+	if k.KDF.Name != "scrypt" {
+		return nil, fmt.Errorf("unsupported key derivation function %q", k.KDF.Name)
+	}
+
+	if k.Cipher.Name != "nacl/secretbox" {
+		return nil, fmt.Errorf("unsupported cipher %q", k.Cipher.Name)
+	}
+
+	if len(k.Cipher.Nonce) != 24 {
+		return nil, fmt.Errorf("invalid nonce length %d", len(k.Cipher.Nonce))
+	}
+
+	secret, err := scrypt.Key(password, k.KDF.Salt, k.KDF.Params.N, k.KDF.Params.R, k.KDF.Params.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+
+	var (
+		nonce [24]byte
+		key   [32]byte
+	)
+	copy(nonce[:], k.Cipher.Nonce)
+	copy(key[:], secret)
+
+	der, ok := secretbox.Open(nil, k.Ciphertext, &nonce, &key)
+	if !ok {
+		return nil, ErrInvalidPassword
+	}
+
+	return der, nil
+}
@@ -0,0 +1,68 @@
+package cosign
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/manzanit0/monocrat/pkg/oci"
+)
+
+// Policy requires the images of a commit to be signed with a key.
+type Policy struct {
+	Key    *ecdsa.PublicKey
+	Client *oci.Client
+
+	// Images are the image repositories to check, e.g.
+	// "ghcr.io/manzanit0/monocrat-ci-check". The image of a commit is the one
+	// tagged with its SHA. The {owner} and {repository} placeholders stand
+	// for those of the deployed repository, see ForRepository.
+	Images []string
+}
+
+// ForRepository returns the policy for the deployments of a repository, with
+// the placeholders of the images replaced.
+func (p *Policy) ForRepository(owner, repository string) *Policy {
+	r := strings.NewReplacer("{owner}", strings.ToLower(owner), "{repository}", strings.ToLower(repository))
+
+	policy := *p
+	policy.Images = make([]string, len(p.Images))
+	for i, image := range p.Images {
+		policy.Images[i] = r.Replace(image)
+	}
+
+	return &policy
+}
+
+// Check verifies the signature of every image tagged with the commit SHA. An
+// image missing for the commit fails the check too, since there's nothing
+// signed to deploy.
+func (p *Policy) Check(ctx context.Context, sha string) error {
+	if len(p.Images) == 0 {
+		return fmt.Errorf("no images to check")
+	}
+
+	var errs []error
+	for _, image := range p.Images {
+		ref, err := oci.ParseReference(fmt.Sprintf("%s:%s", image, sha))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		desc, err := p.Client.Resolve(ctx, ref)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("no image for commit %s: %w", sha, err))
+			continue
+		}
+
+		ref.Digest = desc.Digest
+		if err := Verify(ctx, p.Client, ref, p.Key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,233 @@
+// Package cosign signs images and verifies their signatures the way cosign
+// does with keys, so that either tool can verify what the other signed.
+// https://github.com/sigstore/cosign/blob/main/specs/SIGNATURE_SPEC.md
+package cosign
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/manzanit0/monocrat/pkg/oci"
+)
+
+const (
+	// MediaTypeSimpleSigning is the media type of signature payloads.
+	MediaTypeSimpleSigning = "application/vnd.dev.cosign.simplesigning.v1+json"
+
+	// SignatureAnnotation holds the base64 encoded signature of the payload on
+	// the layer of the signature manifest.
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	payloadType = "cosign container image signature"
+)
+
+// ErrNoSignature is returned by Verify when the image has no signature at all.
+var ErrNoSignature = errors.New("no signature found")
+
+// Payload is the simple signing payload of a signature, which binds it to the
+// digest of the image.
+// https://github.com/containers/image/blob/main/docs/containers-signature.5.md
+type Payload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]string `json:"optional"`
+}
+
+// SignatureTag returns the reference of the signatures of an image, which
+// live in the same repository under the "sha256-<hex>.sig" tag.
+func SignatureTag(image oci.Reference) oci.Reference {
+	return oci.Reference{
+		Registry:   image.Registry,
+		Repository: image.Repository,
+		Tag:        strings.Replace(image.Digest, ":", "-", 1) + ".sig",
+	}
+}
+
+// Sign signs the image the reference points to, which must carry a digest,
+// and pushes the signature next to it. Signatures of the image pushed earlier
+// are kept, like cosign does.
+func Sign(ctx context.Context, c *oci.Client, image oci.Reference, key *ecdsa.PrivateKey) (oci.Descriptor, error) {
+	if image.Digest == "" {
+		return oci.Descriptor{}, fmt.Errorf("sign %s: reference without digest", image)
+	}
+
+	var p Payload
+	p.Critical.Identity.DockerReference = fmt.Sprintf("%s/%s", image.Registry, image.Repository)
+	p.Critical.Image.DockerManifestDigest = image.Digest
+	p.Critical.Type = payloadType
+
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return oci.Descriptor{}, fmt.Errorf("marshal payload: %w", err)
+	}
+
+	hash := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		return oci.Descriptor{}, fmt.Errorf("sign payload: %w", err)
+	}
+
+	layer, err := c.PushBlob(ctx, image, MediaTypeSimpleSigning, payload)
+	if err != nil {
+		return oci.Descriptor{}, fmt.Errorf("push payload: %w", err)
+	}
+	layer.Annotations = map[string]string{SignatureAnnotation: base64.StdEncoding.EncodeToString(signature)}
+
+	tag := SignatureTag(image)
+	manifest, err := signatureManifest(ctx, c, tag)
+	if err != nil {
+		return oci.Descriptor{}, err
+	}
+
+	layers := []oci.Descriptor{layer}
+	for _, existing := range manifest.Layers {
+		if existing.Digest != layer.Digest || existing.Annotations[SignatureAnnotation] != layer.Annotations[SignatureAnnotation] {
+			layers = append(layers, existing)
+		}
+	}
+
+	// The config is the one of an image with the payloads as its layers,
+	// since that's what cosign pushes.
+	config, err := imageConfig(layers)
+	if err != nil {
+		return oci.Descriptor{}, err
+	}
+
+	configDesc, err := c.PushBlob(ctx, image, "application/vnd.oci.image.config.v1+json", config)
+	if err != nil {
+		return oci.Descriptor{}, fmt.Errorf("push config: %w", err)
+	}
+
+	b, err := json.Marshal(oci.Manifest{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeImageManifest,
+		Config:        configDesc,
+		Layers:        layers,
+	})
+	if err != nil {
+		return oci.Descriptor{}, fmt.Errorf("marshal manifest: %w", err)
+	}
+
+	desc, _, err := c.PushManifest(ctx, tag, oci.MediaTypeImageManifest, b)
+	if err != nil {
+		return oci.Descriptor{}, fmt.Errorf("push signature: %w", err)
+	}
+
+	return desc, nil
+}
+
+// Verify checks that the image the reference points to, which must carry a
+// digest, has at least one signature made with the key.
+func Verify(ctx context.Context, c *oci.Client, image oci.Reference, key *ecdsa.PublicKey) error {
+	if image.Digest == "" {
+		return fmt.Errorf("verify %s: reference without digest", image)
+	}
+
+	manifest, err := signatureManifest(ctx, c, SignatureTag(image))
+	if err != nil {
+		return err
+	}
+
+	if len(manifest.Layers) == 0 {
+		return fmt.Errorf("verify %s: %w", image, ErrNoSignature)
+	}
+
+	var errs []error
+	for _, layer := range manifest.Layers {
+		err := verifyLayer(ctx, c, image, layer, key)
+		if err == nil {
+			return nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	return fmt.Errorf("verify %s: no valid signature: %w", image, errors.Join(errs...))
+}
+
+func verifyLayer(ctx context.Context, c *oci.Client, image oci.Reference, layer oci.Descriptor, key *ecdsa.PublicKey) error {
+	if layer.MediaType != MediaTypeSimpleSigning {
+		return fmt.Errorf("signature %s: unexpected media type %q", layer.Digest, layer.MediaType)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(layer.Annotations[SignatureAnnotation])
+	if err != nil {
+		return fmt.Errorf("signature %s: decode signature: %w", layer.Digest, err)
+	}
+
+	payload, err := c.Blob(ctx, image, layer.Digest)
+	if err != nil {
+		return fmt.Errorf("signature %s: %w", layer.Digest, err)
+	}
+
+	hash := sha256.Sum256(payload)
+	if !ecdsa.VerifyASN1(key, hash[:], signature) {
+		return fmt.Errorf("signature %s: invalid signature", layer.Digest)
+	}
+
+	var p Payload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("signature %s: unmarshal payload: %w", layer.Digest, err)
+	}
+
+	// A valid signature of some other image, copied over, must not count.
+	if p.Critical.Image.DockerManifestDigest != image.Digest {
+		return fmt.Errorf("signature %s: signs %s instead", layer.Digest, p.Critical.Image.DockerManifestDigest)
+	}
+
+	return nil
+}
+
+// signatureManifest fetches the manifest holding the signatures of an image,
+// or an empty one if it hasn't been signed yet.
+func signatureManifest(ctx context.Context, c *oci.Client, tag oci.Reference) (*oci.Manifest, error) {
+	b, _, err := c.Manifest(ctx, tag)
+	if errors.Is(err, oci.ErrNotFound) {
+		return &oci.Manifest{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("get signatures: %w", err)
+	}
+
+	var manifest oci.Manifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, fmt.Errorf("unmarshal signatures: %w", err)
+	}
+
+	return &manifest, nil
+}
+
+func imageConfig(layers []oci.Descriptor) ([]byte, error) {
+	diffIDs := make([]string, 0, len(layers))
+	for _, layer := range layers {
+		// Payloads aren't compressed, so their digest is their diff ID.
+		diffIDs = append(diffIDs, layer.Digest)
+	}
+
+	config := map[string]any{
+		"architecture": "",
+		"os":           "",
+		"config":       map[string]any{},
+		"rootfs":       map[string]any{"type": "layers", "diff_ids": diffIDs},
+	}
+
+	b, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("marshal config: %w", err)
+	}
+
+	return b, nil
+}
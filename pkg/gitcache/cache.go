@@ -0,0 +1,398 @@
+// Package gitcache keeps a bare mirror of every repository jobs check out, so
+// that each job only fetches the commits it needs and checks them out as a
+// worktree of its own, rather than cloning the whole repository every time.
+//
+// Mirrors are partial clones: only commits and trees are fetched upfront, and
+// file contents as they are checked out. It shells out to git, as go-git
+// supports neither.
+package gitcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Auth authenticates against the remote over HTTP, e.g. with an installation
+// token as the password of the "x-access-token" user.
+type Auth struct {
+	Username string
+	Password string
+}
+
+// Cache is a directory of mirrors. It is safe for concurrent use.
+type Cache struct {
+	Directory string
+
+	mu      sync.Mutex
+	mirrors map[string]*sync.Mutex
+}
+
+// FromEnv configures the cache from MONOCRAT_REPOSITORY_CACHE, defaulting to a
+// directory under the temporary one.
+func FromEnv() (*Cache, error) {
+	directory := os.Getenv("MONOCRAT_REPOSITORY_CACHE")
+	if directory == "" {
+		directory = filepath.Join(os.TempDir(), "monocrat-repositories")
+	}
+
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return nil, fmt.Errorf("create repository cache: %w", err)
+	}
+
+	return &Cache{Directory: directory}, nil
+}
+
+// CheckoutOptions are the options to check out a commit.
+type CheckoutOptions struct {
+	// Remote is the URL of the repository, e.g. https://github.com/o/r.git.
+	Remote string
+
+	// Commit is the SHA of the commit to check out.
+	Commit string
+
+	// Fetch are other commits the job needs, e.g. to diff against, which
+	// are fetched but not checked out.
+	Fetch []string
+
+	Auth *Auth
+
+	// Paths restricts the checkout to these directories, along with the files
+	// at the root of the repository. Everything is checked out when empty.
+	Paths []string
+
+	// Path is where to check the commit out, which must not exist or be
+	// empty. It defaults to a new temporary directory.
+	Path string
+}
+
+// Worktree is a commit checked out for a job.
+type Worktree struct {
+	Path string
+
+	cache  *Cache
+	mirror string
+	auth   *Auth
+}
+
+// Commit is the metadata of a commit.
+type Commit struct {
+	SHA     string
+	Author  string
+	Message string
+}
+
+// Checkout fetches the commits into the mirror of the remote and checks out
+// the commit in a new worktree. Close the worktree once done with it.
+func (c *Cache) Checkout(ctx context.Context, opts CheckoutOptions) (*Worktree, error) {
+	mirror, err := c.fetch(ctx, opts.Remote, opts.Auth, append([]string{opts.Commit}, opts.Fetch...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	path := opts.Path
+	if path == "" {
+		path, err = os.MkdirTemp("", "monocrat-worktree")
+		if err != nil {
+			return nil, fmt.Errorf("create worktree directory: %w", err)
+		}
+	}
+
+	wt := &Worktree{Path: path, cache: c, mirror: mirror, auth: opts.Auth}
+
+	// Adding worktrees writes to the mirror.
+	unlock := c.lock(mirror)
+	_, err = git(ctx, mirror, nil, "worktree", "add", "--no-checkout", "--detach", path, opts.Commit)
+	unlock()
+	if err != nil {
+		os.RemoveAll(path)
+		return nil, fmt.Errorf("add worktree: %w", err)
+	}
+
+	if len(opts.Paths) > 0 {
+		args := append([]string{"sparse-checkout", "set", "--cone"}, opts.Paths...)
+		if _, err := git(ctx, path, nil, args...); err != nil {
+			wt.Close()
+			return nil, fmt.Errorf("set sparse checkout: %w", err)
+		}
+	}
+
+	// Checking out fetches the contents of the files, hence the auth.
+	if _, err := git(ctx, path, opts.Auth, "checkout", "--quiet", "--detach", opts.Commit); err != nil {
+		wt.Close()
+		return nil, fmt.Errorf("checkout %s: %w", opts.Commit, err)
+	}
+
+	return wt, nil
+}
+
+// Files fetches the commit into the mirror of the remote and lists its files,
+// relative to the root of the repository, without checking anything out.
+func (c *Cache) Files(ctx context.Context, remote string, auth *Auth, commit string) ([]string, error) {
+	mirror, err := c.fetch(ctx, remote, auth, commit)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := git(ctx, mirror, nil, "ls-tree", "-r", "-z", "--name-only", commit)
+	if err != nil {
+		return nil, fmt.Errorf("list files of %s: %w", commit, err)
+	}
+
+	return splitNames(out), nil
+}
+
+// Commit fetches the commit into the mirror of the remote and returns its
+// metadata, without checking anything out.
+func (c *Cache) Commit(ctx context.Context, remote string, auth *Auth, sha string) (*Commit, error) {
+	mirror, err := c.fetch(ctx, remote, auth, sha)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := git(ctx, mirror, nil, "log", "-1", "--format=%an <%ae>%x00%B", sha)
+	if err != nil {
+		return nil, fmt.Errorf("read commit %s: %w", sha, err)
+	}
+
+	author, message, _ := strings.Cut(string(out), "\x00")
+	return &Commit{SHA: sha, Author: author, Message: strings.TrimRight(message, "\n")}, nil
+}
+
+// CheckoutLocal checks out the commit of a local repository in a new
+// worktree, leaving the working tree of the repository alone. Close the
+// worktree once done with it.
+func CheckoutLocal(ctx context.Context, repository, commit string) (*Worktree, error) {
+	path, err := os.MkdirTemp("", "monocrat-worktree")
+	if err != nil {
+		return nil, fmt.Errorf("create worktree directory: %w", err)
+	}
+
+	_, err = git(ctx, repository, nil, "worktree", "add", "--quiet", "--detach", path, commit)
+	if err != nil {
+		os.RemoveAll(path)
+		return nil, fmt.Errorf("add worktree: %w", err)
+	}
+
+	return &Worktree{Path: path, mirror: repository}, nil
+}
+
+// ResolveCommit returns the SHA of the commit the revision of the local
+// repository points at, e.g. a branch or "HEAD~1".
+func ResolveCommit(ctx context.Context, repository, revision string) (string, error) {
+	out, err := git(ctx, repository, nil, "rev-parse", "--verify", "--end-of-options", revision+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", revision, err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ChangedFiles lists the files changed between both commits, relative to the
+// root of the repository.
+func (w *Worktree) ChangedFiles(ctx context.Context, from, to string) ([]string, error) {
+	return ChangedFiles(ctx, w.Path, from, to)
+}
+
+// ChangedFiles lists the files changed between both commits of the local
+// repository, relative to its root.
+func ChangedFiles(ctx context.Context, repository, from, to string) ([]string, error) {
+	// Renames are detected by content, which may not have been fetched.
+	out, err := git(ctx, repository, nil, "diff", "--name-only", "--no-renames", "-z", from, to)
+	if err != nil {
+		return nil, fmt.Errorf("diff %s..%s: %w", from, to, err)
+	}
+
+	return splitNames(out), nil
+}
+
+// splitNames splits the NUL-separated output of git.
+func splitNames(out []byte) []string {
+	var names []string
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// Widen checks out the rest of the commit of a sparse checkout, for jobs which
+// turn out to need more than the paths they asked for.
+func (w *Worktree) Widen(ctx context.Context) error {
+	// Checking out fetches the contents of the files, hence the auth.
+	if _, err := git(ctx, w.Path, w.auth, "sparse-checkout", "disable"); err != nil {
+		return fmt.Errorf("disable sparse checkout: %w", err)
+	}
+
+	return nil
+}
+
+// Close removes the worktree.
+func (w *Worktree) Close() error {
+	// Only mirrors are shared between jobs.
+	if w.cache != nil {
+		unlock := w.cache.lock(w.mirror)
+		defer unlock()
+	}
+
+	_, err := git(context.Background(), w.mirror, nil, "worktree", "remove", "--force", w.Path)
+	if err != nil {
+		// The worktree may not have been added at all, or be gone already.
+		os.RemoveAll(w.Path)
+		_, _ = git(context.Background(), w.mirror, nil, "worktree", "prune")
+		return fmt.Errorf("remove worktree: %w", err)
+	}
+
+	return nil
+}
+
+// Prune forgets the worktrees of every mirror whose directories are gone, e.g.
+// removed along with the workspaces of jobs interrupted by a restart.
+func (c *Cache) Prune(ctx context.Context) error {
+	mirrors, err := filepath.Glob(filepath.Join(c.Directory, "*.git"))
+	if err != nil {
+		return fmt.Errorf("list mirrors: %w", err)
+	}
+
+	var errs []error
+	for _, mirror := range mirrors {
+		unlock := c.lock(mirror)
+		_, err := git(ctx, mirror, nil, "worktree", "prune")
+		unlock()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("prune worktrees: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// fetch fetches the commits into the mirror of the remote, creating it if
+// need be, and returns its path. Commits are fetched without their history.
+func (c *Cache) fetch(ctx context.Context, remote string, auth *Auth, commits ...string) (string, error) {
+	mirror, err := c.mirrorPath(remote)
+	if err != nil {
+		return "", err
+	}
+
+	unlock := c.lock(mirror)
+	defer unlock()
+
+	if _, err := os.Stat(filepath.Join(mirror, "HEAD")); errors.Is(err, os.ErrNotExist) {
+		if err := initMirror(ctx, mirror, remote); err != nil {
+			os.RemoveAll(mirror)
+			return "", err
+		}
+	}
+
+	// Only fetch what's missing.
+	var missing []string
+	for _, commit := range commits {
+		if _, err := git(ctx, mirror, nil, "cat-file", "-e", commit+"^{commit}"); err != nil {
+			missing = append(missing, commit)
+		}
+	}
+
+	if len(missing) == 0 {
+		return mirror, nil
+	}
+
+	args := append([]string{"fetch", "--quiet", "--depth=1", "--filter=blob:none", "origin"}, missing...)
+	if _, err := git(ctx, mirror, auth, args...); err != nil {
+		return "", fmt.Errorf("fetch %s: %w", strings.Join(missing, ", "), err)
+	}
+
+	return mirror, nil
+}
+
+func initMirror(ctx context.Context, mirror, remote string) error {
+	if _, err := git(ctx, "", nil, "init", "--quiet", "--bare", mirror); err != nil {
+		return fmt.Errorf("create mirror: %w", err)
+	}
+
+	for _, args := range [][]string{
+		{"remote", "add", "origin", remote},
+		{"config", "remote.origin.promisor", "true"},
+		{"config", "remote.origin.partialclonefilter", "blob:none"},
+	} {
+		if _, err := git(ctx, mirror, nil, args...); err != nil {
+			return fmt.Errorf("configure mirror: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// mirrorPath names the mirror after the remote, with a hash of it to tell
+// apart remotes which sanitise the same.
+func (c *Cache) mirrorPath(remote string) (string, error) {
+	u, err := url.Parse(remote)
+	if err != nil {
+		return "", fmt.Errorf("parse remote: %w", err)
+	}
+
+	name := strings.Trim(u.Host+"/"+strings.TrimSuffix(u.Path, ".git"), "/")
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, name)
+
+	sum := sha256.Sum256([]byte(remote))
+	return filepath.Join(c.Directory, fmt.Sprintf("%s-%s.git", name, hex.EncodeToString(sum[:4]))), nil
+}
+
+// lock serialises the operations writing to a mirror.
+func (c *Cache) lock(mirror string) func() {
+	c.mu.Lock()
+	if c.mirrors == nil {
+		c.mirrors = map[string]*sync.Mutex{}
+	}
+	mu, ok := c.mirrors[mirror]
+	if !ok {
+		mu = &sync.Mutex{}
+		c.mirrors[mirror] = mu
+	}
+	c.mu.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
+
+// git runs git in the directory. Credentials go through the environment, so
+// they neither show up in the process list nor end up in the mirror's config.
+func git(ctx context.Context, dir string, auth *Auth, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if auth != nil {
+		credentials := base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+		cmd.Env = append(cmd.Env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+credentials,
+		)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,278 @@
+package gitcache
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newRemote creates a repository with two commits to fetch from, returning its
+// URL and the SHAs of both commits.
+func newRemote(t *testing.T) (string, string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	run := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Jane", "GIT_AUTHOR_EMAIL=jane@example.com",
+			"GIT_COMMITTER_NAME=Jane", "GIT_COMMITTER_EMAIL=jane@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s: %s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	write := func(name, content string) {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatalf("create remote: %s", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("create remote: %s", err)
+		}
+	}
+
+	run("init", "--quiet")
+	run("config", "uploadpack.allowFilter", "true")
+	run("config", "uploadpack.allowAnySHA1InWant", "true")
+
+	write("go.work", "go 1.22\n")
+	write("api/main.go", "package main\n")
+	write("worker/main.go", "package main\n")
+	run("add", ".")
+	run("commit", "--quiet", "-m", "Add applications")
+	before := run("rev-parse", "HEAD")
+
+	write("api/main.go", "package main\n\nfunc main() {}\n")
+	run("commit", "--quiet", "-am", "Fix api\n\napprove")
+	after := run("rev-parse", "HEAD")
+
+	return "file://" + dir, before, after
+}
+
+func TestCheckout(t *testing.T) {
+	ctx := context.Background()
+	remote, before, after := newRemote(t)
+	cache := &Cache{Directory: t.TempDir()}
+
+	tests := []struct {
+		name  string
+		paths []string
+		files []string
+	}{
+		{
+			name:  "whole repository",
+			files: []string{"api/main.go", "go.work", "worker/main.go"},
+		},
+		{
+			name:  "sparse checkout",
+			paths: []string{"api"},
+			files: []string{"api/main.go", "go.work"},
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			wt, err := cache.Checkout(ctx, CheckoutOptions{
+				Remote: remote,
+				Commit: after,
+				Fetch:  []string{before},
+				Paths:  tests[idx].paths,
+			})
+			if err != nil {
+				t.Fatalf("checkout: %s", err)
+			}
+
+			var files []string
+			err = filepath.WalkDir(wt.Path, func(path string, d os.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				// In worktrees, .git is a file pointing at the mirror.
+				if d.Name() == ".git" {
+					return nil
+				}
+				if !d.IsDir() {
+					rel, _ := filepath.Rel(wt.Path, path)
+					files = append(files, filepath.ToSlash(rel))
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("walk worktree: %s", err)
+			}
+
+			if !reflect.DeepEqual(files, tests[idx].files) {
+				t.Fatalf("files no match: %v", files)
+			}
+
+			changed, err := wt.ChangedFiles(ctx, before, after)
+			if err != nil {
+				t.Fatalf("changed files: %s", err)
+			}
+
+			if !reflect.DeepEqual(changed, []string{"api/main.go"}) {
+				t.Fatalf("changed files no match: %v", changed)
+			}
+
+			if err := wt.Close(); err != nil {
+				t.Fatalf("close worktree: %s", err)
+			}
+
+			if _, err := os.Stat(wt.Path); !os.IsNotExist(err) {
+				t.Fatalf("worktree not removed: %v", err)
+			}
+		})
+	}
+
+	mirrors, _ := filepath.Glob(filepath.Join(cache.Directory, "*.git"))
+	if len(mirrors) != 1 {
+		t.Fatalf("expected a single mirror, got %v", mirrors)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	remote, _, after := newRemote(t)
+	cache := &Cache{Directory: t.TempDir()}
+
+	commit, err := cache.Commit(context.Background(), remote, nil, after)
+	if err != nil {
+		t.Fatalf("read commit: %s", err)
+	}
+
+	if commit.Message != "Fix api\n\napprove" || commit.Author != "Jane <jane@example.com>" {
+		t.Fatalf("commit no match: %+v", commit)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	remote, _, after := newRemote(t)
+	cache := &Cache{Directory: t.TempDir()}
+
+	files, err := cache.Files(context.Background(), remote, nil, after)
+	if err != nil {
+		t.Fatalf("list files: %s", err)
+	}
+
+	if !reflect.DeepEqual(files, []string{"api/main.go", "go.work", "worker/main.go"}) {
+		t.Fatalf("files no match: %v", files)
+	}
+}
+
+func TestWiden(t *testing.T) {
+	ctx := context.Background()
+	remote, _, after := newRemote(t)
+	cache := &Cache{Directory: t.TempDir()}
+
+	wt, err := cache.Checkout(ctx, CheckoutOptions{Remote: remote, Commit: after, Paths: []string{"api"}})
+	if err != nil {
+		t.Fatalf("checkout: %s", err)
+	}
+	defer wt.Close()
+
+	if _, err := os.Stat(filepath.Join(wt.Path, "worker/main.go")); !os.IsNotExist(err) {
+		t.Fatalf("expected worker to be left out: %v", err)
+	}
+
+	if err := wt.Widen(ctx); err != nil {
+		t.Fatalf("widen: %s", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(wt.Path, "worker/main.go"))
+	if err != nil || string(content) != "package main\n" {
+		t.Fatalf("content no match: %q, %v", content, err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	directory := filepath.Join(t.TempDir(), "repositories")
+	t.Setenv("MONOCRAT_REPOSITORY_CACHE", directory)
+
+	cache, err := FromEnv()
+	if err != nil {
+		t.Fatalf("from env: %s", err)
+	}
+
+	if cache.Directory != directory {
+		t.Fatalf("directory no match: %s", cache.Directory)
+	}
+
+	if info, err := os.Stat(directory); err != nil || !info.IsDir() {
+		t.Fatalf("directory not created: %v", err)
+	}
+}
+
+func TestCheckoutLocal(t *testing.T) {
+	ctx := context.Background()
+	remote, before, _ := newRemote(t)
+	repository := strings.TrimPrefix(remote, "file://")
+
+	commit, err := ResolveCommit(ctx, repository, "HEAD~1")
+	if err != nil || commit != before {
+		t.Fatalf("commit no match: %s, %v", commit, err)
+	}
+
+	files, err := ChangedFiles(ctx, repository, before, "HEAD")
+	if err != nil || !reflect.DeepEqual(files, []string{"api/main.go"}) {
+		t.Fatalf("changed files no match: %v, %v", files, err)
+	}
+
+	wt, err := CheckoutLocal(ctx, repository, before)
+	if err != nil {
+		t.Fatalf("checkout: %s", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(wt.Path, "api/main.go"))
+	if err != nil || string(content) != "package main\n" {
+		t.Fatalf("content no match: %q, %v", content, err)
+	}
+
+	if err := wt.Close(); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+
+	if _, err := os.Stat(wt.Path); !os.IsNotExist(err) {
+		t.Fatalf("worktree not removed: %v", err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	remote, _, after := newRemote(t)
+	cache := &Cache{Directory: t.TempDir()}
+
+	path := filepath.Join(t.TempDir(), "repository")
+	wt, err := cache.Checkout(ctx, CheckoutOptions{Remote: remote, Commit: after, Path: path})
+	if err != nil {
+		t.Fatalf("checkout: %s", err)
+	}
+
+	if wt.Path != path {
+		t.Fatalf("path no match: %s", wt.Path)
+	}
+
+	// As if removed along with the workspace of the job.
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("remove worktree: %s", err)
+	}
+
+	if err := cache.Prune(ctx); err != nil {
+		t.Fatalf("prune: %s", err)
+	}
+
+	out, err := git(ctx, wt.mirror, nil, "worktree", "list", "--porcelain")
+	if err != nil {
+		t.Fatalf("list worktrees: %s", err)
+	}
+
+	if strings.Contains(string(out), path) {
+		t.Fatalf("worktree not pruned: %s", out)
+	}
+}
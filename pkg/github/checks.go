@@ -0,0 +1,94 @@
+package github
+
+import (
+	"context"
+
+	"github.com/Manzanit0/go-github/v52/github"
+)
+
+// maxAnnotations is how many annotations the Checks API takes per request.
+const maxAnnotations = 50
+
+func (c *client) CreateCheckRun(ctx context.Context, owner, repo string, opts github.CreateCheckRunOptions) (*github.CheckRun, error) {
+	var annotations []*github.CheckRunAnnotation
+	opts.Output, annotations = splitAnnotations(opts.Output)
+
+	checkRun, res, err := c.g.Checks.CreateCheckRun(ctx, owner, repo, opts)
+	if err != nil {
+		return nil, NewError("create check run", err, res)
+	}
+
+	if len(annotations) > 0 {
+		err = c.AnnotateCheckRun(ctx, owner, repo, checkRun.GetID(), opts.Name, *opts.Output, annotations)
+	}
+
+	return checkRun, err
+}
+
+func (c *client) UpdateCheckRun(ctx context.Context, owner, repo string, checkRunID int64, opts github.UpdateCheckRunOptions) (*github.CheckRun, error) {
+	var annotations []*github.CheckRunAnnotation
+	opts.Output, annotations = splitAnnotations(opts.Output)
+
+	checkRun, res, err := c.g.Checks.UpdateCheckRun(ctx, owner, repo, checkRunID, opts)
+	if err != nil {
+		return nil, NewError("update check run", err, res)
+	}
+
+	if len(annotations) > 0 {
+		err = c.AnnotateCheckRun(ctx, owner, repo, checkRunID, opts.Name, *opts.Output, annotations)
+	}
+
+	return checkRun, err
+}
+
+func (c *client) AnnotateCheckRun(ctx context.Context, owner, repo string, checkRunID int64, name string, output github.CheckRunOutput, annotations []*github.CheckRunAnnotation) error {
+	for len(annotations) > 0 {
+		batch := annotations[:min(len(annotations), maxAnnotations)]
+		annotations = annotations[len(batch):]
+
+		output.Annotations = batch
+		_, res, err := c.g.Checks.UpdateCheckRun(ctx, owner, repo, checkRunID, github.UpdateCheckRunOptions{
+			Name:   name,
+			Output: &output,
+		})
+		if err != nil {
+			return NewError("annotate check run", err, res)
+		}
+	}
+
+	return nil
+}
+
+func (c *client) ListCheckRuns(ctx context.Context, owner, repo, ref string, opts *github.ListCheckRunsOptions) ([]*github.CheckRun, error) {
+	if opts == nil {
+		opts = &github.ListCheckRunsOptions{}
+	}
+	listOpts := *opts
+	listOpts.PerPage = 100
+
+	var checkRuns []*github.CheckRun
+	for {
+		result, res, err := c.g.Checks.ListCheckRunsForRef(ctx, owner, repo, ref, &listOpts)
+		if err != nil {
+			return nil, NewError("list check runs", err, res)
+		}
+
+		checkRuns = append(checkRuns, result.CheckRuns...)
+		if res.NextPage == 0 {
+			return checkRuns, nil
+		}
+		listOpts.Page = res.NextPage
+	}
+}
+
+// splitAnnotations keeps the annotations of the output within what a single
+// request takes, returning the rest.
+func splitAnnotations(output *github.CheckRunOutput) (*github.CheckRunOutput, []*github.CheckRunAnnotation) {
+	if output == nil || len(output.Annotations) <= maxAnnotations {
+		return output, nil
+	}
+
+	first := *output
+	first.Annotations = output.Annotations[:maxAnnotations]
+	return &first, output.Annotations[maxAnnotations:]
+}
@@ -0,0 +1,120 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/Manzanit0/go-github/v52/github"
+)
+
+// newTestClient returns a client against the handler, as an installation.
+func newTestClient(t *testing.T, handler http.Handler) Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	g := github.NewClient(nil)
+	g.BaseURL, _ = url.Parse(server.URL + "/")
+
+	return &client{g: g}
+}
+
+func TestUpdateCheckRunAnnotations(t *testing.T) {
+	var mu sync.Mutex
+	var batches []int
+	gh := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var opts github.UpdateCheckRunOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			t.Errorf("decode request: %s", err)
+		}
+
+		if opts.Name != "Build application" || opts.Output.GetTitle() != "Built" {
+			t.Errorf("request no match: %+v", opts)
+		}
+
+		mu.Lock()
+		batches = append(batches, len(opts.Output.Annotations))
+		mu.Unlock()
+
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": 7})
+	}))
+
+	annotations := make([]*github.CheckRunAnnotation, 120)
+	for i := range annotations {
+		annotations[i] = &github.CheckRunAnnotation{Path: github.String(fmt.Sprintf("go%d.mod", i))}
+	}
+
+	_, err := gh.UpdateCheckRun(context.Background(), "octo", "repo", 7, github.UpdateCheckRunOptions{
+		Name:   "Build application",
+		Status: github.String("completed"),
+		Output: &github.CheckRunOutput{
+			Title:       github.String("Built"),
+			Summary:     github.String("Built 3 applications"),
+			Annotations: annotations,
+		},
+	})
+	if err != nil {
+		t.Fatalf("update check run: %s", err)
+	}
+
+	if fmt.Sprint(batches) != "[50 50 20]" {
+		t.Fatalf("batches no match: %v", batches)
+	}
+}
+
+func TestListCheckRuns(t *testing.T) {
+	gh := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/octo/repo/commits/main/check-runs" || r.URL.Query().Get("check_name") != "Lint" {
+			t.Errorf("request no match: %s", r.URL)
+		}
+
+		page := r.URL.Query().Get("page")
+		if page == "" {
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?page=2>; rel="next"`, r.Host, r.URL.Path))
+			page = "1"
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"total_count": 2,
+			"check_runs":  []map[string]any{{"name": "Lint", "external_id": page}},
+		})
+	}))
+
+	checkRuns, err := gh.ListCheckRuns(context.Background(), "octo", "repo", "main", &github.ListCheckRunsOptions{CheckName: github.String("Lint")})
+	if err != nil {
+		t.Fatalf("list check runs: %s", err)
+	}
+
+	if len(checkRuns) != 2 || checkRuns[0].GetExternalID() != "1" || checkRuns[1].GetExternalID() != "2" {
+		t.Fatalf("check runs no match: %v", checkRuns)
+	}
+}
+
+func TestListEnvironments(t *testing.T) {
+	gh := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/octo/repo/environments" {
+			t.Errorf("request no match: %s", r.URL)
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"total_count":  2,
+			"environments": []map[string]any{{"name": "staging"}, {"name": "production"}},
+		})
+	}))
+
+	environments, err := gh.ListEnvironments(context.Background(), "octo", "repo")
+	if err != nil {
+		t.Fatalf("list environments: %s", err)
+	}
+
+	if len(environments) != 2 || environments[1].GetName() != "production" {
+		t.Fatalf("environments no match: %v", environments)
+	}
+}
@@ -0,0 +1,61 @@
+package github
+
+import (
+	"context"
+
+	"github.com/Manzanit0/go-github/v52/github"
+)
+
+func (c *client) CreateDeploymentStatus(ctx context.Context, owner, repo string, deploymentID int64, req *github.DeploymentStatusRequest) (*github.DeploymentStatus, error) {
+	status, res, err := c.g.Repositories.CreateDeploymentStatus(ctx, owner, repo, deploymentID, req)
+	if err != nil {
+		return nil, NewError("create deployment status", err, res)
+	}
+
+	return status, nil
+}
+
+func (c *client) ListDeploymentStatuses(ctx context.Context, owner, repo string, deploymentID int64) ([]*github.DeploymentStatus, error) {
+	opts := &github.ListOptions{PerPage: 100}
+
+	var statuses []*github.DeploymentStatus
+	for {
+		page, res, err := c.g.Repositories.ListDeploymentStatuses(ctx, owner, repo, deploymentID, opts)
+		if err != nil {
+			return nil, NewError("list deployment statuses", err, res)
+		}
+
+		statuses = append(statuses, page...)
+		if res.NextPage == 0 {
+			return statuses, nil
+		}
+		opts.Page = res.NextPage
+	}
+}
+
+func (c *client) GetEnvironment(ctx context.Context, owner, repo, name string) (*github.Environment, error) {
+	environment, res, err := c.g.Repositories.GetEnvironment(ctx, owner, repo, name)
+	if err != nil {
+		return nil, NewError("get environment", err, res)
+	}
+
+	return environment, nil
+}
+
+func (c *client) ListEnvironments(ctx context.Context, owner, repo string) ([]*github.Environment, error) {
+	opts := &github.EnvironmentListOptions{ListOptions: github.ListOptions{PerPage: 100}}
+
+	var environments []*github.Environment
+	for {
+		page, res, err := c.g.Repositories.ListEnvironments(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, NewError("list environments", err, res)
+		}
+
+		environments = append(environments, page.Environments...)
+		if res.NextPage == 0 {
+			return environments, nil
+		}
+		opts.Page = res.NextPage
+	}
+}
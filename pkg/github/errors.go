@@ -0,0 +1,161 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Manzanit0/go-github/v52/github"
+)
+
+// Kind classifies errors by what callers can do about them.
+type Kind int
+
+const (
+	KindUnknown Kind = iota
+
+	// KindRetryable errors may not happen again, e.g. server errors, rate
+	// limits or network errors.
+	KindRetryable
+
+	// KindAuth errors are about the credentials or permissions of the App.
+	KindAuth
+
+	// KindValidation errors are about the request, which GitHub rejected.
+	KindValidation
+
+	// KindNotFound errors are about resources missing, or hidden from the
+	// installation.
+	KindNotFound
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindRetryable:
+		return "retryable"
+	case KindAuth:
+		return "auth"
+	case KindValidation:
+		return "validation"
+	case KindNotFound:
+		return "not found"
+	default:
+		return "unknown"
+	}
+}
+
+// Error is a failed call to the GitHub API. It wraps the error of the client,
+// usually a *github.ErrorResponse with the message and documentation URL of
+// the API.
+type Error struct {
+	// Op is what the call was doing, e.g. "create check run".
+	Op string
+
+	Kind Kind
+
+	// StatusCode is zero when there was no response, e.g. on network errors.
+	StatusCode int
+
+	// RequestID identifies the request to GitHub support.
+	RequestID string
+
+	Err error
+}
+
+// NewError wraps the error of a call, classifying it by its response if there
+// is one. It returns nil when err is nil.
+func NewError(op string, err error, res *github.Response) error {
+	if err == nil {
+		return nil
+	}
+
+	e := &Error{Op: op, Err: err}
+	if res != nil && res.Response != nil {
+		e.StatusCode = res.StatusCode
+		e.RequestID = res.Header.Get("X-GitHub-Request-Id")
+	}
+	e.Kind = classify(err, e.StatusCode)
+
+	return e
+}
+
+func classify(err error, status int) Kind {
+	var rateLimitErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return KindUnknown
+	case errors.As(err, &rateLimitErr) || errors.As(err, &abuseErr):
+		return KindRetryable
+	case status == 0:
+		// No response, the network failed.
+		return KindRetryable
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return KindAuth
+	case status == http.StatusNotFound:
+		return KindNotFound
+	case status == http.StatusBadRequest || status == http.StatusUnprocessableEntity:
+		return KindValidation
+	case status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500:
+		return KindRetryable
+	default:
+		return KindUnknown
+	}
+}
+
+func (e *Error) Error() string {
+	msg := e.Err.Error()
+
+	var errResp *github.ErrorResponse
+	if errors.As(e.Err, &errResp) {
+		// The error of the client repeats the method and URL.
+		msg = fmt.Sprintf("%d %s", e.StatusCode, errResp.Message)
+		for _, detail := range errResp.Errors {
+			msg += "; " + detail.Error()
+		}
+		if errResp.DocumentationURL != "" {
+			msg += " (see " + errResp.DocumentationURL + ")"
+		}
+	}
+
+	if e.RequestID != "" {
+		msg += " [request " + e.RequestID + "]"
+	}
+
+	return e.Op + ": " + msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable tells whether the call may succeed if made again.
+func IsRetryable(err error) bool {
+	return kindOf(err) == KindRetryable
+}
+
+// IsAuth tells whether the call failed on the credentials or permissions of
+// the App.
+func IsAuth(err error) bool {
+	return kindOf(err) == KindAuth
+}
+
+// IsValidation tells whether GitHub rejected the request.
+func IsValidation(err error) bool {
+	return kindOf(err) == KindValidation
+}
+
+// IsNotFound tells whether the call failed on a missing resource.
+func IsNotFound(err error) bool {
+	return kindOf(err) == KindNotFound
+}
+
+func kindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+
+	return KindUnknown
+}
@@ -0,0 +1,103 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Manzanit0/go-github/v52/github"
+)
+
+func TestNewError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		kind    Kind
+		message string
+	}{
+		{
+			name:    "validation",
+			status:  http.StatusUnprocessableEntity,
+			body:    `{"message":"Validation Failed","errors":[{"resource":"CheckRun","field":"name","code":"missing_field"}],"documentation_url":"https://docs.github.com/rest/checks/runs#create-a-check-run"}`,
+			kind:    KindValidation,
+			message: "create check run: 422 Validation Failed; missing_field error caused by name field on CheckRun resource (see https://docs.github.com/rest/checks/runs#create-a-check-run) [request CAFE:0001]",
+		},
+		{
+			name:    "not found",
+			status:  http.StatusNotFound,
+			body:    `{"message":"Not Found"}`,
+			kind:    KindNotFound,
+			message: "create check run: 404 Not Found [request CAFE:0001]",
+		},
+		{
+			name:    "auth",
+			status:  http.StatusForbidden,
+			body:    `{"message":"Resource not accessible by integration"}`,
+			kind:    KindAuth,
+			message: "create check run: 403 Resource not accessible by integration [request CAFE:0001]",
+		},
+		{
+			name:    "server error",
+			status:  http.StatusBadGateway,
+			body:    `{"message":"Server Error"}`,
+			kind:    KindRetryable,
+			message: "create check run: 502 Server Error [request CAFE:0001]",
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-GitHub-Request-Id", "CAFE:0001")
+				w.WriteHeader(tests[idx].status)
+				_, _ = w.Write([]byte(tests[idx].body))
+			}))
+			defer server.Close()
+
+			g := github.NewClient(nil)
+			g.BaseURL, _ = url.Parse(server.URL + "/")
+
+			_, res, err := g.Checks.CreateCheckRun(context.Background(), "octo", "repo", github.CreateCheckRunOptions{})
+			err = NewError("create check run", err, res)
+
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("expected an *Error, got %v", err)
+			}
+
+			if e.Kind != tests[idx].kind || e.StatusCode != tests[idx].status || e.RequestID != "CAFE:0001" {
+				t.Fatalf("error no match: %+v", e)
+			}
+
+			if err.Error() != tests[idx].message {
+				t.Fatalf("message no match: %s", err)
+			}
+
+			var errResp *github.ErrorResponse
+			if !errors.As(err, &errResp) {
+				t.Fatalf("expected the error response to be wrapped")
+			}
+		})
+	}
+}
+
+func TestNewErrorWithoutResponse(t *testing.T) {
+	g := github.NewClient(nil)
+	g.BaseURL, _ = url.Parse("http://127.0.0.1:1/")
+
+	_, res, err := g.Checks.CreateCheckRun(context.Background(), "octo", "repo", github.CreateCheckRunOptions{})
+	err = NewError("create check run", err, res)
+
+	if !IsRetryable(err) || !strings.HasPrefix(err.Error(), "create check run: ") {
+		t.Fatalf("error no match: %v", err)
+	}
+
+	if NewError("create check run", nil, nil) != nil {
+		t.Fatalf("expected no error")
+	}
+}
@@ -0,0 +1,568 @@
+// Package fake provides an in-memory stand-in for the GitHub API, to test the
+// services end to end without GitHub: it serves the Checks API, deployment
+// protection rule reviews, deployment statuses, environments and installation
+// tokens.
+package fake
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Manzanit0/go-github/v52/github"
+
+	ghapp "github.com/manzanit0/monocrat/pkg/github"
+)
+
+// Server serves the subset of the GitHub API the services use. Calls on
+// repositories need a token minted by the server for an installation; the JWT
+// of the App isn't verified.
+type Server struct {
+	Server *httptest.Server
+
+	mu           sync.Mutex
+	nextID       int64
+	tokens       map[string]int64
+	checkRuns    map[int64]*CheckRun
+	reviews      []Review
+	statuses     map[int64][]*github.DeploymentStatus
+	environments map[string][]string
+	failures     []failure
+}
+
+// CheckRun is a check run as it stands after all the requests about it.
+type CheckRun struct {
+	ID             int64
+	InstallationID int64
+
+	// Repository is the full name of the repository, e.g. "octo/repo".
+	Repository string
+
+	Name       string
+	HeadSHA    string
+	ExternalID string
+	DetailsURL string
+	Status     string
+	Conclusion string
+
+	Title   string
+	Summary string
+	Text    string
+
+	// Annotations are all the annotations added, across requests.
+	Annotations []*github.CheckRunAnnotation
+	Actions     []*github.CheckRunAction
+
+	// Updates is how many times the check run was updated.
+	Updates int
+}
+
+// Review is a review of a deployment protection rule.
+type Review struct {
+	InstallationID  int64
+	Repository      string
+	RunID           int64
+	State           string
+	EnvironmentName string
+	Comment         string
+}
+
+type failure struct {
+	method  string
+	path    string
+	status  int
+	message string
+}
+
+// NewServer starts a server. It is closed when the test finishes.
+func NewServer(t interface{ Cleanup(func()) }) *Server {
+	s := &Server{
+		tokens:       map[string]int64{},
+		checkRuns:    map[int64]*CheckRun{},
+		statuses:     map[int64][]*github.DeploymentStatus{},
+		environments: map[string][]string{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /app/installations/{installation}/access_tokens", s.createToken)
+	mux.HandleFunc("POST /repos/{owner}/{repo}/check-runs", s.authenticated(s.createCheckRun))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/check-runs/{id}", s.authenticated(s.getCheckRun))
+	mux.HandleFunc("PATCH /repos/{owner}/{repo}/check-runs/{id}", s.authenticated(s.updateCheckRun))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/commits/{ref}/check-runs", s.authenticated(s.listCheckRuns))
+	mux.HandleFunc("POST /repos/{owner}/{repo}/actions/runs/{run}/deployment_protection_rule", s.authenticated(s.reviewDeployment))
+	mux.HandleFunc("POST /repos/{owner}/{repo}/deployments/{id}/statuses", s.authenticated(s.createDeploymentStatus))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/deployments/{id}/statuses", s.authenticated(s.listDeploymentStatuses))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/environments", s.authenticated(s.listEnvironments))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/environments/{name}", s.authenticated(s.getEnvironment))
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f, ok := s.failure(r); ok {
+			writeError(w, f.status, f.message)
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Server.Close)
+
+	return s
+}
+
+// URL returns the base URL of the API, to configure clients with.
+func (s *Server) URL() string {
+	return s.Server.URL + "/"
+}
+
+// Installations returns the installations of an App against the server, as
+// the services get them with MONOCRAT_GITHUB_API_URL set to its URL.
+func (s *Server) Installations() (*ghapp.Installations, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	return ghapp.NewEnterpriseInstallations(s.URL(), 1, privateKey)
+}
+
+// FailNext makes the next request matching the method and path, e.g. "PATCH"
+// and "/repos/octo/repo/check-runs/1", fail with the status.
+func (s *Server) FailNext(method, path string, status int, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, failure{method: method, path: path, status: status, message: message})
+}
+
+// AddEnvironment creates an environment in the repository, by full name.
+func (s *Server) AddEnvironment(repository, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.environments[repository] = append(s.environments[repository], name)
+}
+
+// TokensMinted returns how many installation tokens were minted.
+func (s *Server) TokensMinted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.tokens)
+}
+
+// CheckRuns returns the check runs of the repository, by full name, in the
+// order they were created.
+func (s *Server) CheckRuns(repository string) []CheckRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var checkRuns []CheckRun
+	for _, checkRun := range s.checkRuns {
+		if checkRun.Repository == repository {
+			checkRuns = append(checkRuns, *checkRun)
+		}
+	}
+
+	sort.Slice(checkRuns, func(i, j int) bool { return checkRuns[i].ID < checkRuns[j].ID })
+	return checkRuns
+}
+
+// Reviews returns the reviews of deployment protection rules, in the order
+// they were made.
+func (s *Server) Reviews() []Review {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Review(nil), s.reviews...)
+}
+
+// DeploymentStatuses returns the statuses of the deployment, the latest
+// first.
+func (s *Server) DeploymentStatuses(deploymentID int64) []*github.DeploymentStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*github.DeploymentStatus(nil), s.statuses[deploymentID]...)
+}
+
+func (s *Server) failure(r *http.Request) (failure, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, f := range s.failures {
+		if f.method == r.Method && f.path == r.URL.Path {
+			s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			return f, true
+		}
+	}
+
+	return failure{}, false
+}
+
+func (s *Server) id() int64 {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *Server) createToken(w http.ResponseWriter, r *http.Request) {
+	installationID, err := strconv.ParseInt(r.PathValue("installation"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	s.mu.Lock()
+	token := fmt.Sprintf("ghs_fake%d", s.id())
+	s.tokens[token] = installationID
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, &github.InstallationToken{
+		Token:     github.String(token),
+		ExpiresAt: &github.Timestamp{Time: time.Now().Add(time.Hour)},
+	})
+}
+
+// authenticated requires a token minted for an installation, handing its ID
+// over to the handler.
+func (s *Server) authenticated(handler func(w http.ResponseWriter, r *http.Request, installationID int64)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "token ")
+
+		s.mu.Lock()
+		installationID, ok := s.tokens[token]
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Bad credentials")
+			return
+		}
+
+		handler(w, r, installationID)
+	}
+}
+
+func (s *Server) createCheckRun(w http.ResponseWriter, r *http.Request, installationID int64) {
+	var opts github.CreateCheckRunOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return
+	}
+
+	if opts.Name == "" || opts.HeadSHA == "" {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkRun := &CheckRun{
+		ID:             s.id(),
+		InstallationID: installationID,
+		Repository:     repository(r),
+		Name:           opts.Name,
+		HeadSHA:        opts.HeadSHA,
+		ExternalID:     opts.GetExternalID(),
+		DetailsURL:     opts.GetDetailsURL(),
+		Status:         "queued",
+		Conclusion:     opts.GetConclusion(),
+		Actions:        opts.Actions,
+	}
+	if opts.Status != nil {
+		checkRun.Status = *opts.Status
+	}
+	checkRun.output(opts.Output)
+	s.checkRuns[checkRun.ID] = checkRun
+
+	writeJSON(w, http.StatusCreated, checkRun.github())
+}
+
+func (s *Server) getCheckRun(w http.ResponseWriter, r *http.Request, _ int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkRun, ok := s.checkRun(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, checkRun.github())
+}
+
+func (s *Server) updateCheckRun(w http.ResponseWriter, r *http.Request, _ int64) {
+	var opts github.UpdateCheckRunOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkRun, ok := s.checkRun(r)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	if opts.Output != nil && len(opts.Output.Annotations) > 50 {
+		writeError(w, http.StatusUnprocessableEntity, "Only 50 annotations are allowed per request")
+		return
+	}
+
+	if opts.Name != "" {
+		checkRun.Name = opts.Name
+	}
+	if opts.DetailsURL != nil {
+		checkRun.DetailsURL = *opts.DetailsURL
+	}
+	if opts.ExternalID != nil {
+		checkRun.ExternalID = *opts.ExternalID
+	}
+	if opts.Status != nil {
+		checkRun.Status = *opts.Status
+	}
+	if opts.Conclusion != nil {
+		checkRun.Conclusion = *opts.Conclusion
+		checkRun.Status = "completed"
+	}
+	if opts.Actions != nil {
+		checkRun.Actions = opts.Actions
+	}
+	checkRun.output(opts.Output)
+	checkRun.Updates++
+
+	writeJSON(w, http.StatusOK, checkRun.github())
+}
+
+func (s *Server) listCheckRuns(w http.ResponseWriter, r *http.Request, _ int64) {
+	query := r.URL.Query()
+
+	s.mu.Lock()
+	var checkRuns []*github.CheckRun
+	for _, checkRun := range s.checkRuns {
+		if checkRun.Repository != repository(r) || checkRun.HeadSHA != r.PathValue("ref") {
+			continue
+		}
+		if name := query.Get("check_name"); name != "" && checkRun.Name != name {
+			continue
+		}
+		if status := query.Get("status"); status != "" && checkRun.Status != status {
+			continue
+		}
+		checkRuns = append(checkRuns, checkRun.github())
+	}
+	s.mu.Unlock()
+
+	sort.Slice(checkRuns, func(i, j int) bool { return checkRuns[i].GetID() < checkRuns[j].GetID() })
+	total := len(checkRuns)
+	checkRuns = paginate(w, r, checkRuns)
+
+	writeJSON(w, http.StatusOK, &github.ListCheckRunsResults{Total: github.Int(total), CheckRuns: checkRuns})
+}
+
+func (s *Server) reviewDeployment(w http.ResponseWriter, r *http.Request, installationID int64) {
+	var req github.ReviewDeploymentProtectionRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return
+	}
+
+	runID, err := strconv.ParseInt(r.PathValue("run"), 10, 64)
+	if err != nil || (req.State != "approved" && req.State != "rejected") {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+		return
+	}
+
+	s.mu.Lock()
+	s.reviews = append(s.reviews, Review{
+		InstallationID:  installationID,
+		Repository:      repository(r),
+		RunID:           runID,
+		State:           req.State,
+		EnvironmentName: req.EnvironmentName,
+		Comment:         req.Comment,
+	})
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) createDeploymentStatus(w http.ResponseWriter, r *http.Request, _ int64) {
+	deploymentID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	var req github.DeploymentStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := &github.Timestamp{Time: time.Now()}
+	status := &github.DeploymentStatus{
+		ID:             github.Int64(s.id()),
+		State:          req.State,
+		Description:    req.Description,
+		Environment:    req.Environment,
+		EnvironmentURL: req.EnvironmentURL,
+		LogURL:         req.LogURL,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	s.statuses[deploymentID] = append([]*github.DeploymentStatus{status}, s.statuses[deploymentID]...)
+
+	writeJSON(w, http.StatusCreated, status)
+}
+
+func (s *Server) listDeploymentStatuses(w http.ResponseWriter, r *http.Request, _ int64) {
+	deploymentID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	s.mu.Lock()
+	statuses := append([]*github.DeploymentStatus(nil), s.statuses[deploymentID]...)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, paginate(w, r, statuses))
+}
+
+func (s *Server) listEnvironments(w http.ResponseWriter, r *http.Request, _ int64) {
+	s.mu.Lock()
+	var environments []*github.Environment
+	for _, name := range s.environments[repository(r)] {
+		environments = append(environments, &github.Environment{Name: github.String(name)})
+	}
+	s.mu.Unlock()
+
+	total := len(environments)
+	environments = paginate(w, r, environments)
+
+	writeJSON(w, http.StatusOK, &github.EnvResponse{TotalCount: github.Int(total), Environments: environments})
+}
+
+func (s *Server) getEnvironment(w http.ResponseWriter, r *http.Request, _ int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range s.environments[repository(r)] {
+		if name == r.PathValue("name") {
+			writeJSON(w, http.StatusOK, &github.Environment{Name: github.String(name)})
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+// checkRun returns the check run the request is about. Callers must hold the
+// lock.
+func (s *Server) checkRun(r *http.Request) (*CheckRun, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	checkRun, ok := s.checkRuns[id]
+	if !ok || checkRun.Repository != repository(r) {
+		return nil, false
+	}
+
+	return checkRun, true
+}
+
+// output applies the output of a request. Annotations add up, as they do on
+// GitHub.
+func (c *CheckRun) output(output *github.CheckRunOutput) {
+	if output == nil {
+		return
+	}
+
+	c.Title = output.GetTitle()
+	c.Summary = output.GetSummary()
+	if output.Text != nil {
+		c.Text = *output.Text
+	}
+	c.Annotations = append(c.Annotations, output.Annotations...)
+}
+
+func (c *CheckRun) github() *github.CheckRun {
+	checkRun := &github.CheckRun{
+		ID:         github.Int64(c.ID),
+		Name:       github.String(c.Name),
+		HeadSHA:    github.String(c.HeadSHA),
+		ExternalID: github.String(c.ExternalID),
+		DetailsURL: github.String(c.DetailsURL),
+		Status:     github.String(c.Status),
+		Output: &github.CheckRunOutput{
+			Title:            github.String(c.Title),
+			Summary:          github.String(c.Summary),
+			Text:             github.String(c.Text),
+			AnnotationsCount: github.Int(len(c.Annotations)),
+		},
+	}
+	if c.Conclusion != "" {
+		checkRun.Conclusion = github.String(c.Conclusion)
+	}
+
+	return checkRun
+}
+
+func repository(r *http.Request) string {
+	return r.PathValue("owner") + "/" + r.PathValue("repo")
+}
+
+// paginate returns the page asked for, linking to the next one if any.
+func paginate[T any](w http.ResponseWriter, r *http.Request, items []T) []T {
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage <= 0 {
+		perPage = 30
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+
+	start := min((page-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+	if end < len(items) {
+		next := *r.URL
+		query := next.Query()
+		query.Set("page", strconv.Itoa(page+1))
+		next.RawQuery = query.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s%s>; rel="next"`, r.Host, next.RequestURI()))
+	}
+
+	return items[start:end]
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{
+		"message":           message,
+		"documentation_url": "https://docs.github.com/rest",
+	})
+}
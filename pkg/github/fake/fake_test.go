@@ -0,0 +1,152 @@
+package fake_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Manzanit0/go-github/v52/github"
+	ghapp "github.com/manzanit0/monocrat/pkg/github"
+	"github.com/manzanit0/monocrat/pkg/github/fake"
+)
+
+// newInstallations returns the installations of an App against the server.
+func newInstallations(t *testing.T, s *fake.Server) *ghapp.Installations {
+	t.Helper()
+
+	installations, err := s.Installations()
+	if err != nil {
+		t.Fatalf("new installations: %s", err)
+	}
+
+	return installations
+}
+
+func TestCheckRuns(t *testing.T) {
+	s := fake.NewServer(t)
+	gh := newInstallations(t, s).Get(42).Client()
+	ctx := context.Background()
+
+	checkRun, err := gh.CreateCheckRun(ctx, "octo", "repo", github.CreateCheckRunOptions{
+		Name:    "Build application",
+		HeadSHA: "cafe",
+		Status:  github.String("in_progress"),
+	})
+	if err != nil {
+		t.Fatalf("create check run: %s", err)
+	}
+
+	annotations := make([]*github.CheckRunAnnotation, 120)
+	for i := range annotations {
+		annotations[i] = &github.CheckRunAnnotation{Path: github.String(fmt.Sprintf("go%d.mod", i))}
+	}
+
+	_, err = gh.UpdateCheckRun(ctx, "octo", "repo", checkRun.GetID(), github.UpdateCheckRunOptions{
+		Name:       "Build application",
+		Conclusion: github.String("success"),
+		Output: &github.CheckRunOutput{
+			Title:       github.String("Built"),
+			Summary:     github.String("Built 3 applications"),
+			Annotations: annotations,
+		},
+	})
+	if err != nil {
+		t.Fatalf("update check run: %s", err)
+	}
+
+	checkRuns := s.CheckRuns("octo/repo")
+	if len(checkRuns) != 1 {
+		t.Fatalf("check runs no match: %+v", checkRuns)
+	}
+
+	got := checkRuns[0]
+	if got.InstallationID != 42 || got.Status != "completed" || got.Conclusion != "success" || got.Title != "Built" || len(got.Annotations) != 120 || got.Updates != 3 {
+		t.Fatalf("check run no match: %+v", got)
+	}
+
+	listed, err := gh.ListCheckRuns(ctx, "octo", "repo", "cafe", &github.ListCheckRunsOptions{CheckName: github.String("Build application")})
+	if err != nil {
+		t.Fatalf("list check runs: %s", err)
+	}
+
+	if len(listed) != 1 || listed[0].GetID() != checkRun.GetID() || listed[0].GetConclusion() != "success" {
+		t.Fatalf("listed check runs no match: %v", listed)
+	}
+
+	if s.TokensMinted() != 1 {
+		t.Fatalf("tokens minted no match: %d", s.TokensMinted())
+	}
+}
+
+func TestReviewDeployment(t *testing.T) {
+	s := fake.NewServer(t)
+	s.AddEnvironment("octo/repo", "production")
+	gh := newInstallations(t, s).Get(42).Client()
+	ctx := context.Background()
+
+	environment, err := gh.GetEnvironment(ctx, "octo", "repo", "production")
+	if err != nil || environment.GetName() != "production" {
+		t.Fatalf("get environment no match: %v, %v", environment, err)
+	}
+
+	_, err = gh.GetEnvironment(ctx, "octo", "repo", "staging")
+	if !ghapp.IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	var event ghapp.DeploymentProtectionRuleEvent
+	err = json.Unmarshal([]byte(`{
+		"deployment_callback_url": "https://api.github.com/repos/octo/repo/actions/runs/7/deployment_protection_rule",
+		"deployment": {"environment": "production"},
+		"repository": {"name": "repo", "full_name": "octo/repo", "owner": {"login": "octo"}}
+	}`), &event)
+	if err != nil {
+		t.Fatalf("decode event: %s", err)
+	}
+
+	err = gh.RejectDeployment(ctx, &event)
+	if err != nil {
+		t.Fatalf("reject deployment: %s", err)
+	}
+
+	reviews := s.Reviews()
+	want := fake.Review{InstallationID: 42, Repository: "octo/repo", RunID: 7, State: "rejected", EnvironmentName: "production", Comment: "signed-off by Monocrat"}
+	if len(reviews) != 1 || reviews[0] != want {
+		t.Fatalf("reviews no match: %+v", reviews)
+	}
+}
+
+func TestUnauthenticated(t *testing.T) {
+	s := fake.NewServer(t)
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL()+"repos/octo/repo/check-runs", nil)
+	req.Header.Set("Authorization", "token ghs_unknown")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %s", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status no match: %d", resp.StatusCode)
+	}
+}
+
+func TestFailNext(t *testing.T) {
+	s := fake.NewServer(t)
+	s.FailNext(http.MethodPost, "/repos/octo/repo/check-runs", http.StatusUnprocessableEntity, "Validation Failed")
+	gh := newInstallations(t, s).Get(42).Client()
+
+	opts := github.CreateCheckRunOptions{Name: "Lint", HeadSHA: "cafe"}
+	_, err := gh.CreateCheckRun(context.Background(), "octo", "repo", opts)
+	if !ghapp.IsValidation(err) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+
+	_, err = gh.CreateCheckRun(context.Background(), "octo", "repo", opts)
+	if err != nil {
+		t.Fatalf("create check run: %s", err)
+	}
+}
@@ -2,18 +2,13 @@ package github
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Manzanit0/go-github/v52/github"
-	"github.com/bradleyfalzon/ghinstallation/v2"
-	"github.com/manzanit0/monocrat/pkg/httpx"
 )
 
 const (
@@ -244,121 +239,81 @@ type DeploymentProtectionRuleEvent struct {
 	} `json:"installation"`
 }
 
+// Client acts as an installation on the repositories it is installed on.
 type Client interface {
-	ApproveDeployment(ctx context.Context, event *DeploymentProtectionRuleEvent) error
-	RejectDeployment(ctx context.Context, event *DeploymentProtectionRuleEvent) error
-	CreateCheckRun(ctx context.Context, event github.CheckSuiteEvent) error
-	FailCheckRun(ctx context.Context, event github.CheckRunEvent) error
-	PassCheckRunWithDeploymentAction(ctx context.Context, event github.CheckRunEvent) error
-}
+	Checks
+	Deployments
 
-type client struct {
-	g          *github.Client
-	owner      string
-	repository string
+	// InstallationToken returns a token to authenticate as the installation,
+	// e.g. to fetch the repository.
+	InstallationToken(ctx context.Context) (string, error)
 }
 
-var _ Client = (*client)(nil)
+// Checks is the Checks API. Errors are *Error.
+type Checks interface {
+	CreateCheckRun(ctx context.Context, owner, repo string, opts github.CreateCheckRunOptions) (*github.CheckRun, error)
 
-type ErrorResponse struct {
-	Message          string `json:"message"`
-	Errors           string `json:"errors"`
-	DocumentationURL string `json:"documentation_url"`
-}
+	// UpdateCheckRun updates the check run. Annotations beyond those a single
+	// request takes are added by further requests.
+	UpdateCheckRun(ctx context.Context, owner, repo string, checkRunID int64, opts github.UpdateCheckRunOptions) (*github.CheckRun, error)
 
-func NewClient(owner, repository string, appID int64, installationID int64, privateKey []byte) (Client, error) {
-	// FIXME: this bit can be reused across installations.
-	tr := httpx.NewLoggingRoundTripper()
-	itr, err := ghinstallation.NewAppsTransport(tr, appID, privateKey)
-	if err != nil {
-		return nil, fmt.Errorf("create transport from private key: %w", err)
-	}
+	// AnnotateCheckRun adds the annotations to the check run, in as many
+	// requests as needed, along with the output, which every request has to
+	// restate.
+	AnnotateCheckRun(ctx context.Context, owner, repo string, checkRunID int64, name string, output github.CheckRunOutput, annotations []*github.CheckRunAnnotation) error
 
-	c := github.NewClient(&http.Client{Transport: ghinstallation.NewFromAppsTransport(itr, installationID)})
-	return &client{repository: repository, owner: owner, g: c}, nil
+	// ListCheckRuns lists every check run of the ref, across pages.
+	ListCheckRuns(ctx context.Context, owner, repo, ref string, opts *github.ListCheckRunsOptions) ([]*github.CheckRun, error)
 }
 
-func (c *client) ApproveDeployment(ctx context.Context, event *DeploymentProtectionRuleEvent) error {
-	return c.reviewDeployment(ctx, event, ApprovedDeploymentState)
-}
+// Deployments is the part of the Deployments API, and of the Actions API,
+// deployment protection rules work with. Errors are *Error.
+type Deployments interface {
+	ApproveDeployment(ctx context.Context, event *DeploymentProtectionRuleEvent) error
+	RejectDeployment(ctx context.Context, event *DeploymentProtectionRuleEvent) error
 
-func (c *client) RejectDeployment(ctx context.Context, event *DeploymentProtectionRuleEvent) error {
-	return c.reviewDeployment(ctx, event, RejectedDeploymentState)
-}
+	CreateDeploymentStatus(ctx context.Context, owner, repo string, deploymentID int64, req *github.DeploymentStatusRequest) (*github.DeploymentStatus, error)
 
-func (c *client) CreateCheckRun(ctx context.Context, event github.CheckSuiteEvent) error {
-	_, res, err := c.g.Checks.CreateCheckRun(ctx, event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName(), github.CreateCheckRunOptions{
-		Name:    "Checking commit message",
-		HeadSHA: event.GetCheckSuite().GetHeadSHA(),
-	})
-	if err != nil {
-		var errResp github.ErrorResponse
-		dec := json.NewDecoder(res.Body)
-		if err := dec.Decode(&errResp); err != nil && err != io.EOF {
-			log.Println("[error] unmarshal body:", err.Error())
-			return fmt.Errorf("fail check run: request failed + failed to parse body")
-		}
+	// ListDeploymentStatuses lists every status of the deployment, across
+	// pages, the latest first.
+	ListDeploymentStatuses(ctx context.Context, owner, repo string, deploymentID int64) ([]*github.DeploymentStatus, error)
 
-		return fmt.Errorf("create check run: %s: %s", errResp.Message, errResp.Errors)
-	}
+	GetEnvironment(ctx context.Context, owner, repo, name string) (*github.Environment, error)
 
-	b, _ := io.ReadAll(res.Body)
-	log.Println(string(b))
+	// ListEnvironments lists every environment of the repository, across
+	// pages.
+	ListEnvironments(ctx context.Context, owner, repo string) ([]*github.Environment, error)
+}
 
-	return nil
+// client acts as an installation on whichever repository events are about.
+type client struct {
+	g  *github.Client
+	tr TokenSource
 }
 
-func (c *client) FailCheckRun(ctx context.Context, event github.CheckRunEvent) error {
-	// Note: this allows adding actions! Deploy to production????
-	_, res, err := c.g.Checks.UpdateCheckRun(ctx, event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName(), event.CheckRun.GetID(), github.UpdateCheckRunOptions{
-		Status:     s("completed"),
-		Conclusion: s("failure"),
-		Output:     &github.CheckRunOutput{Title: s("Invalid changeset"), Summary: s("baribaribari"), Text: s("my textydexty")},
-	})
-	if err != nil {
-		var errResp github.ErrorResponse
-		dec := json.NewDecoder(res.Body)
-		if err := dec.Decode(&errResp); err != nil && err != io.EOF {
-			log.Println("[error] unmarshal body:", err.Error())
-			return fmt.Errorf("fail check run: request failed + failed to parse body")
-		}
+var _ Client = (*client)(nil)
 
-		return fmt.Errorf("fail check run: %s: %s", errResp.Message, errResp.Errors)
+// NewClient authenticates as the installation from scratch. Services handling
+// many webhooks should share Installations instead.
+func NewClient(appID int64, installationID int64, privateKey []byte) (Client, error) {
+	installations, err := NewInstallations(appID, privateKey)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return installations.Get(installationID).Client(), nil
 }
 
-func (c *client) PassCheckRunWithDeploymentAction(ctx context.Context, event github.CheckRunEvent) error {
-	// Note: this allows adding actions! Deploy to production????
-	_, res, err := c.g.Checks.UpdateCheckRun(ctx, event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName(), event.CheckRun.GetID(), github.UpdateCheckRunOptions{
-		Status:     s("completed"),
-		Conclusion: s("success"),
-		Output:     &github.CheckRunOutput{Title: s("Success"), Summary: s("baribaribari"), Text: s("my textydexty")},
-		Actions: []*github.CheckRunAction{
-			{
-				Label:       "Deploy to production",
-				Description: "Deployes the application to production",
-				Identifier:  "badibum",
-			},
-		},
-	})
-	if err != nil {
-		var errResp github.ErrorResponse
-		dec := json.NewDecoder(res.Body)
-		if err := dec.Decode(&errResp); err != nil && err != io.EOF {
-			log.Println("[error] unmarshal body:", err.Error())
-			return fmt.Errorf("fail check run: request failed + failed to parse body")
-		}
-
-		return fmt.Errorf("fail check run: %s: %s", errResp.Message, errResp.Errors)
-	}
+func (c *client) InstallationToken(ctx context.Context) (string, error) {
+	return c.tr.Token(ctx)
+}
 
-	return nil
+func (c *client) ApproveDeployment(ctx context.Context, event *DeploymentProtectionRuleEvent) error {
+	return c.reviewDeployment(ctx, event, ApprovedDeploymentState)
 }
 
-func s(ss string) *string {
-	return &ss
+func (c *client) RejectDeployment(ctx context.Context, event *DeploymentProtectionRuleEvent) error {
+	return c.reviewDeployment(ctx, event, RejectedDeploymentState)
 }
 
 func (c *client) reviewDeployment(ctx context.Context, event *DeploymentProtectionRuleEvent, state string) error {
@@ -367,23 +322,16 @@ func (c *client) reviewDeployment(ctx context.Context, event *DeploymentProtecti
 		return fmt.Errorf("extracting run ID from event: %w", err)
 	}
 
-	log.Println("[info] requesting review for environment", event.Deployment.Environment, "and workflow run", runID)
+	log.Println("[info] requesting review for", event.Repository.FullName, "environment", event.Deployment.Environment, "and workflow run", runID)
 
-	res, err := c.g.Actions.ReviewDeploymentProtectionRule(ctx, c.owner, c.repository, runID, &github.ReviewDeploymentProtectionRuleRequest{
+	res, err := c.g.Actions.ReviewDeploymentProtectionRule(ctx, event.Repository.Owner.Login, event.Repository.Name, runID, &github.ReviewDeploymentProtectionRuleRequest{
 		State:           state,
 		Comment:         "signed-off by Monocrat",
 		EnvironmentName: event.Deployment.Environment,
 	})
 
 	if err != nil {
-		var errResp ErrorResponse
-		dec := json.NewDecoder(res.Body)
-		if err := dec.Decode(&errResp); err != nil && err != io.EOF {
-			log.Println("[error] unmarshal body:", err.Error())
-			return fmt.Errorf("review deployment: request failed + failed to parse body")
-		}
-
-		return fmt.Errorf("review deployment: %s: %s", errResp.Message, errResp.Errors)
+		return NewError("review deployment", err, res)
 	}
 
 	return nil
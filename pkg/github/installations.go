@@ -0,0 +1,260 @@
+package github
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Manzanit0/go-github/v52/github"
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/manzanit0/monocrat/pkg/httpx"
+)
+
+const (
+	// tokenRefreshWindow is how long before they expire tokens get refreshed
+	// in the background, so that webhooks don't wait on GitHub for them.
+	tokenRefreshWindow = 10 * time.Minute
+
+	// tokenExpiryMargin is how long before they expire tokens stop being
+	// handed out, so they don't expire in flight.
+	tokenExpiryMargin = time.Minute
+
+	tokenFetchTimeout = 30 * time.Second
+)
+
+// TokenSource mints installation tokens.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// Installations hands out the clients of the installations of the App, sharing
+// the App's transport and caching a client per installation along with its
+// token. It is safe for concurrent use.
+type Installations struct {
+	// apps authenticates as the App.
+	apps *github.Client
+	base http.RoundTripper
+
+	mu            sync.Mutex
+	installations map[int64]*Installation
+}
+
+// NewInstallations authenticates as the App with its private key.
+func NewInstallations(appID int64, privateKey []byte) (*Installations, error) {
+	return NewEnterpriseInstallations("", appID, privateKey)
+}
+
+// NewEnterpriseInstallations authenticates as the App with its private key
+// against the API at the base URL, e.g. "https://ghe.example.com/api/v3/",
+// rather than github.com's. An empty base URL stands for github.com.
+func NewEnterpriseInstallations(baseURL string, appID int64, privateKey []byte) (*Installations, error) {
+	tr := httpx.NewLoggingRoundTripper()
+	apps, err := ghinstallation.NewAppsTransport(httpx.NewRetryRoundTripper(tr), appID, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("create transport from private key: %w", err)
+	}
+
+	g := github.NewClient(&http.Client{Transport: apps})
+	if baseURL != "" {
+		u, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/")
+		if err != nil {
+			return nil, fmt.Errorf("parse base URL: %w", err)
+		}
+
+		g.BaseURL = u
+		g.UploadURL = u
+	}
+
+	return newInstallations(g, tr), nil
+}
+
+func newInstallations(apps *github.Client, base http.RoundTripper) *Installations {
+	return &Installations{apps: apps, base: base, installations: map[int64]*Installation{}}
+}
+
+// Get returns the installation, creating it on first use.
+func (s *Installations) Get(id int64) *Installation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i, ok := s.installations[id]; ok {
+		return i
+	}
+
+	// Each installation has a rate budget of its own.
+	i := &Installation{ID: id, apps: s.apps, retry: httpx.NewRetryRoundTripper(s.base)}
+	i.GitHub = github.NewClient(&http.Client{Transport: &installationTransport{installation: i, base: i.retry}})
+	i.GitHub.BaseURL = s.apps.BaseURL
+	i.GitHub.UploadURL = s.apps.UploadURL
+	s.installations[id] = i
+
+	return i
+}
+
+// Evict forgets the installation, e.g. once uninstalled or once its
+// permissions or repositories changed, which its token doesn't reflect.
+func (s *Installations) Evict(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.installations, id)
+}
+
+// RateLimits returns the rate budget left of every installation, keyed by ID.
+func (s *Installations) RateLimits() map[string]httpx.RateLimit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rateLimits := make(map[string]httpx.RateLimit, len(s.installations))
+	for id, i := range s.installations {
+		rateLimits[strconv.FormatInt(id, 10)] = i.RateLimit()
+	}
+
+	return rateLimits
+}
+
+// Publish exposes the rate budget left of every installation under the name
+// in expvar, i.e. at /debug/vars.
+func (s *Installations) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any { return s.RateLimits() }))
+}
+
+// Installation is an installation of the App, with the client and tokens to
+// act as it.
+type Installation struct {
+	ID int64
+
+	// GitHub is a client authenticated as the installation.
+	GitHub *github.Client
+
+	apps  *github.Client
+	retry *httpx.RetryRoundTripper
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+	fetch     *tokenFetch
+}
+
+// tokenFetch is a request for a token in flight, which every caller in need
+// of a token waits on rather than requesting another.
+type tokenFetch struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+var _ TokenSource = (*Installation)(nil)
+
+// Client returns the client to act as the installation on the repositories
+// of events.
+func (i *Installation) Client() Client {
+	return &client{g: i.GitHub, tr: i}
+}
+
+// ClientTokens mints tokens as the installation of the client, for whatever
+// takes a token source rather than a client.
+func ClientTokens(gh Client) TokenSource {
+	return clientTokens{gh: gh}
+}
+
+type clientTokens struct {
+	gh Client
+}
+
+func (t clientTokens) Token(ctx context.Context) (string, error) {
+	return t.gh.InstallationToken(ctx)
+}
+
+// RateLimit returns the rate budget left of the installation.
+func (i *Installation) RateLimit() httpx.RateLimit {
+	return i.retry.RateLimit()
+}
+
+// Token returns the token of the installation. Cached tokens are returned as
+// long as they are valid, and refreshed in the background as they get close
+// to expiry.
+func (i *Installation) Token(ctx context.Context) (string, error) {
+	i.mu.Lock()
+	now := time.Now()
+	if i.token != "" && now.Before(i.expiresAt.Add(-tokenExpiryMargin)) {
+		if now.After(i.expiresAt.Add(-tokenRefreshWindow)) {
+			i.refresh()
+		}
+
+		token := i.token
+		i.mu.Unlock()
+		return token, nil
+	}
+
+	fetch := i.refresh()
+	i.mu.Unlock()
+
+	select {
+	case <-fetch.done:
+		return fetch.token, fetch.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// refresh requests a new token unless one is in flight already, returning the
+// request. Callers must hold the lock.
+func (i *Installation) refresh() *tokenFetch {
+	if i.fetch != nil {
+		return i.fetch
+	}
+
+	fetch := &tokenFetch{done: make(chan struct{})}
+	i.fetch = fetch
+
+	go func() {
+		// The request outlives the callers waiting on it.
+		ctx, cancel := context.WithTimeout(context.Background(), tokenFetchTimeout)
+		defer cancel()
+
+		token, res, err := i.apps.Apps.CreateInstallationToken(ctx, i.ID, nil)
+
+		i.mu.Lock()
+		defer i.mu.Unlock()
+
+		if err != nil {
+			fetch.err = NewError("create installation token", err, res)
+		} else {
+			fetch.token = token.GetToken()
+			i.token = token.GetToken()
+			i.expiresAt = token.GetExpiresAt().Time
+		}
+
+		i.fetch = nil
+		close(fetch.done)
+	}()
+
+	return fetch
+}
+
+// installationTransport authenticates requests as the installation.
+type installationTransport struct {
+	installation *Installation
+	base         http.RoundTripper
+}
+
+func (t *installationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.installation.Token(req.Context())
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "token "+token)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,135 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Manzanit0/go-github/v52/github"
+)
+
+// newTestInstallations serves installation tokens expiring after ttl, counting
+// how many were minted.
+func newTestInstallations(t *testing.T, ttl time.Duration) (*Installations, *atomic.Int64) {
+	t.Helper()
+
+	var minted atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app/installations/1/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		// Slow enough for concurrent webhooks to pile up on the request.
+		time.Sleep(50 * time.Millisecond)
+		n := minted.Add(1)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"token":      fmt.Sprintf("token-%d", n),
+			"expires_at": time.Now().Add(ttl),
+		})
+	})
+	mux.HandleFunc("/repos/octo/repo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		_ = json.NewEncoder(w).Encode(map[string]any{"full_name": r.Header.Get("Authorization")})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	apps := github.NewClient(nil)
+	apps.BaseURL, _ = url.Parse(server.URL + "/")
+
+	return newInstallations(apps, http.DefaultTransport), &minted
+}
+
+func TestInstallationToken(t *testing.T) {
+	installations, minted := newTestInstallations(t, time.Hour)
+	installation := installations.Get(1)
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 20)
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := installations.Get(1).Token(context.Background())
+			if err != nil {
+				t.Errorf("get token: %s", err)
+			}
+			tokens[i] = token
+		}()
+	}
+	wg.Wait()
+
+	if minted.Load() != 1 {
+		t.Fatalf("expected a single token to be minted, got %d", minted.Load())
+	}
+
+	for _, token := range tokens {
+		if token != "token-1" {
+			t.Fatalf("tokens no match: %v", tokens)
+		}
+	}
+
+	repo, _, err := installation.GitHub.Repositories.Get(context.Background(), "octo", "repo")
+	if err != nil {
+		t.Fatalf("get repository: %s", err)
+	}
+
+	if repo.GetFullName() != "token token-1" || minted.Load() != 1 {
+		t.Fatalf("authorization no match: %s", repo.GetFullName())
+	}
+
+	if rateLimits := installations.RateLimits(); rateLimits["1"].Remaining != 4999 {
+		t.Fatalf("rate limits no match: %+v", rateLimits)
+	}
+
+	installations.Evict(1)
+	if installations.Get(1) == installation {
+		t.Fatalf("installation not evicted")
+	}
+
+	if token, _ := installations.Get(1).Token(context.Background()); token != "token-2" {
+		t.Fatalf("token no match: %s", token)
+	}
+}
+
+func TestInstallationTokenRefresh(t *testing.T) {
+	// Tokens are due a refresh as soon as they are minted.
+	installations, minted := newTestInstallations(t, tokenRefreshWindow-time.Second)
+	installation := installations.Get(1)
+
+	token, err := installation.Token(context.Background())
+	if err != nil || token != "token-1" {
+		t.Fatalf("token no match: %s, %v", token, err)
+	}
+
+	// The cached token is handed out while the new one is minted.
+	token, err = installation.Token(context.Background())
+	if err != nil || token != "token-1" {
+		t.Fatalf("token no match: %s, %v", token, err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for minted.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Wait for the refresh to land.
+	installation.mu.Lock()
+	fetch := installation.fetch
+	installation.mu.Unlock()
+	if fetch != nil {
+		<-fetch.done
+	}
+
+	token, err = installation.Token(context.Background())
+	if err != nil || token != "token-2" {
+		t.Fatalf("token no match: %s, %v", token, err)
+	}
+}
@@ -0,0 +1,74 @@
+package github
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// RepositoryFilter tells which repositories a service acts on, out of those
+// the App is installed on. Patterns match full names, e.g. "owner/name" or
+// "owner/*", as path.Match does, regardless of case.
+type RepositoryFilter struct {
+	// Allow are the repositories to act on. Every repository is when empty.
+	Allow []string
+
+	// Deny are the repositories never to act on, even if allowed.
+	Deny []string
+}
+
+// ParseRepositoryFilter parses the comma-separated patterns of both lists.
+func ParseRepositoryFilter(allow, deny string) (*RepositoryFilter, error) {
+	f := &RepositoryFilter{}
+
+	var err error
+	f.Allow, err = parseRepositoryPatterns(allow)
+	if err != nil {
+		return nil, err
+	}
+
+	f.Deny, err = parseRepositoryPatterns(deny)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func parseRepositoryPatterns(s string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(s, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil || !strings.Contains(pattern, "/") {
+			return nil, fmt.Errorf("invalid repository pattern %q", pattern)
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+// Allows tells whether to act on the repository, by its full name.
+func (f *RepositoryFilter) Allows(fullName string) bool {
+	fullName = strings.ToLower(fullName)
+	if matchRepository(f.Deny, fullName) {
+		return false
+	}
+
+	return len(f.Allow) == 0 || matchRepository(f.Allow, fullName)
+}
+
+func matchRepository(patterns []string, fullName string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), fullName); ok {
+			return true
+		}
+	}
+
+	return false
+}
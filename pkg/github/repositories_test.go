@@ -0,0 +1,45 @@
+package github
+
+import (
+	"testing"
+)
+
+func TestRepositoryFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		allow      string
+		deny       string
+		repository string
+		allowed    bool
+	}{
+		{name: "no lists", repository: "octo/api", allowed: true},
+		{name: "allowed", allow: "octo/api, octo/worker", repository: "octo/worker", allowed: true},
+		{name: "not allowed", allow: "octo/api", repository: "octo/worker", allowed: false},
+		{name: "allowed owner", allow: "octo/*", repository: "octo/worker", allowed: true},
+		{name: "other owner", allow: "octo/*", repository: "acme/worker", allowed: false},
+		{name: "denied", deny: "octo/secrets", repository: "octo/secrets", allowed: false},
+		{name: "denied over allowed", allow: "octo/*", deny: "octo/secrets", repository: "octo/secrets", allowed: false},
+		{name: "case insensitive", allow: "Octo/API", repository: "octo/Api", allowed: true},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			f, err := ParseRepositoryFilter(tests[idx].allow, tests[idx].deny)
+			if err != nil {
+				t.Fatalf("parse filter: %s", err)
+			}
+
+			if f.Allows(tests[idx].repository) != tests[idx].allowed {
+				t.Fatalf("allowed no match: %t", !tests[idx].allowed)
+			}
+		})
+	}
+}
+
+func TestParseRepositoryFilter(t *testing.T) {
+	for _, pattern := range []string{"octo", "octo/[api"} {
+		if _, err := ParseRepositoryFilter(pattern, ""); err == nil {
+			t.Fatalf("expected %q to be invalid", pattern)
+		}
+	}
+}
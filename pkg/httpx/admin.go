@@ -0,0 +1,35 @@
+package httpx
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+)
+
+// DefaultAdminAddress is where the admin endpoints are served unless told
+// otherwise, only reachable from the host.
+const DefaultAdminAddress = "localhost:9090"
+
+// AdminHandler serves the runtime metrics published in expvar at /debug/vars.
+// They tell about the installations and their jobs, so they're kept off the
+// public listener.
+func AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	return mux
+}
+
+// ServeAdmin serves the admin handler on the address in the background,
+// defaulting to DefaultAdminAddress.
+func ServeAdmin(addr string) {
+	if addr == "" {
+		addr = DefaultAdminAddress
+	}
+
+	go func() {
+		log.Println("[info] serving admin endpoints on", addr)
+		if err := http.ListenAndServe(addr, AdminHandler()); err != nil {
+			log.Println("[error] admin ListenAndServe", err)
+		}
+	}()
+}
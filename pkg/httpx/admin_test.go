@@ -0,0 +1,22 @@
+package httpx
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("decode vars: %s", err)
+	}
+
+	if rec.Code != http.StatusOK || vars["memstats"] == nil {
+		t.Fatalf("vars no match: %d %s", rec.Code, rec.Body.String())
+	}
+}
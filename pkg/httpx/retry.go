@@ -0,0 +1,232 @@
+package httpx
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultBaseDelay  = time.Second
+	defaultMaxWait    = time.Minute
+
+	// secondaryRateLimitWait is how long GitHub asks to wait after hitting a
+	// secondary rate limit without telling for how long.
+	secondaryRateLimitWait = time.Minute
+)
+
+// RateLimit is the rate budget left, as last reported by GitHub.
+type RateLimit struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+
+	// Retries is how many requests were retried.
+	Retries int64 `json:"retries"`
+}
+
+// RetryRoundTripper retries the requests GitHub throttled, once their rate
+// limit resets, and the idempotent ones which failed on the network or with a
+// server error, with jittered exponential backoff. It keeps track of the rate
+// budget left. It is safe for concurrent use.
+type RetryRoundTripper struct {
+	Transport http.RoundTripper
+
+	// MaxRetries is how many times a request is retried at most.
+	MaxRetries int
+
+	// BaseDelay is the backoff before the first retry, doubling on every
+	// other.
+	BaseDelay time.Duration
+
+	// MaxWait is how long to wait at most for a rate limit to reset, beyond
+	// which the throttled response is returned as is.
+	MaxWait time.Duration
+
+	mu        sync.Mutex
+	rateLimit RateLimit
+}
+
+// NewRetryRoundTripper retries the requests made through the transport.
+func NewRetryRoundTripper(transport http.RoundTripper) *RetryRoundTripper {
+	return &RetryRoundTripper{
+		Transport:  transport,
+		MaxRetries: defaultMaxRetries,
+		BaseDelay:  defaultBaseDelay,
+		MaxWait:    defaultMaxWait,
+	}
+}
+
+// RateLimit returns the rate budget left.
+func (t *RetryRoundTripper) RateLimit() RateLimit {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.rateLimit
+}
+
+func (t *RetryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		res, err := t.Transport.RoundTrip(req)
+		if res != nil {
+			t.track(res)
+		}
+
+		if attempt >= t.MaxRetries || (req.Body != nil && req.GetBody == nil) {
+			return res, err
+		}
+
+		wait, retry := t.retryAfter(req, res, err, attempt)
+		if !retry || wait > t.MaxWait {
+			return res, err
+		}
+
+		if deadline, ok := req.Context().Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return res, err
+		}
+
+		if res != nil {
+			log.Printf("[info] %s %s -> %d, retrying in %s", req.Method, req.URL, res.StatusCode, wait.Round(time.Millisecond))
+			res.Body.Close()
+		} else {
+			log.Printf("[info] %s %s -> %s, retrying in %s", req.Method, req.URL, err, wait.Round(time.Millisecond))
+		}
+
+		t.mu.Lock()
+		t.rateLimit.Retries++
+		t.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// retryAfter tells whether to retry the request, and how long to wait before.
+// Throttled requests weren't processed, so they are retried whatever their
+// method.
+func (t *RetryRoundTripper) retryAfter(req *http.Request, res *http.Response, err error, attempt int) (time.Duration, bool) {
+	if err != nil {
+		// The request may have been processed if the response was lost.
+		return t.backoff(attempt), idempotent(req) && req.Context().Err() == nil
+	}
+
+	switch {
+	case res.StatusCode == http.StatusForbidden || res.StatusCode == http.StatusTooManyRequests:
+		if wait, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok {
+			return wait, true
+		}
+
+		if res.Header.Get("X-RateLimit-Remaining") == "0" {
+			reset, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64)
+			if err != nil {
+				return 0, false
+			}
+			return time.Until(time.Unix(reset, 0)) + time.Second, true
+		}
+
+		if secondaryRateLimited(res) {
+			return secondaryRateLimitWait, true
+		}
+
+		return 0, false
+
+	case res.StatusCode >= 500:
+		return t.backoff(attempt), idempotent(req) && res.StatusCode != http.StatusNotImplemented
+
+	default:
+		return 0, false
+	}
+}
+
+// backoff is exponential with jitter, so that the requests which failed at
+// once aren't retried at once too.
+func (t *RetryRoundTripper) backoff(attempt int) time.Duration {
+	d := t.BaseDelay << attempt
+	if d <= 0 {
+		return 0
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (t *RetryRoundTripper) track(res *http.Response) {
+	limit, err := strconv.Atoi(res.Header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return
+	}
+
+	remaining, _ := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
+	reset, _ := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rateLimit.Limit = limit
+	t.rateLimit.Remaining = remaining
+	t.rateLimit.Reset = time.Unix(reset, 0)
+}
+
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseRetryAfter parses the header, in seconds or as a date.
+func parseRetryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return time.Until(date), true
+	}
+
+	return 0, false
+}
+
+// secondaryRateLimited tells whether GitHub throttled the request without
+// saying for how long, going by the message of the response. The body is
+// left for the caller to read.
+func secondaryRateLimited(res *http.Response) bool {
+	b, err := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	res.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), res.Body), res.Body}
+	if err != nil {
+		return false
+	}
+
+	message := strings.ToLower(string(b))
+	return strings.Contains(message, "secondary rate limit") || strings.Contains(message, "abuse detection")
+}
@@ -0,0 +1,151 @@
+package httpx
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// response is what the server answers to an attempt.
+type response struct {
+	status int
+	header map[string]string
+	body   string
+}
+
+func TestRetryRoundTripper(t *testing.T) {
+	inAnHour := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		method    string
+		responses []response
+		status    int
+		attempts  int64
+	}{
+		{
+			name:      "server error",
+			method:    http.MethodGet,
+			responses: []response{{status: http.StatusBadGateway}, {status: http.StatusOK}},
+			status:    http.StatusOK,
+			attempts:  2,
+		},
+		{
+			name:      "server error on a non-idempotent request",
+			method:    http.MethodPost,
+			responses: []response{{status: http.StatusBadGateway}, {status: http.StatusOK}},
+			status:    http.StatusBadGateway,
+			attempts:  1,
+		},
+		{
+			name:      "persistent server error",
+			method:    http.MethodGet,
+			responses: []response{{status: http.StatusServiceUnavailable}},
+			status:    http.StatusServiceUnavailable,
+			attempts:  4,
+		},
+		{
+			name:   "secondary rate limit",
+			method: http.MethodPost,
+			responses: []response{
+				{status: http.StatusForbidden, header: map[string]string{"Retry-After": "0"}},
+				{status: http.StatusCreated},
+			},
+			status:   http.StatusCreated,
+			attempts: 2,
+		},
+		{
+			name:   "rate limit resetting too late",
+			method: http.MethodGet,
+			responses: []response{
+				{status: http.StatusForbidden, header: map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": inAnHour}},
+				{status: http.StatusOK},
+			},
+			status:   http.StatusForbidden,
+			attempts: 1,
+		},
+		{
+			name:      "forbidden",
+			method:    http.MethodGet,
+			responses: []response{{status: http.StatusForbidden, body: "Resource not accessible by integration"}},
+			status:    http.StatusForbidden,
+			attempts:  1,
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			var attempts atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := attempts.Add(1)
+				if b, _ := io.ReadAll(r.Body); r.Method == http.MethodPost && string(b) != "payload" {
+					t.Errorf("body no match: %q", b)
+				}
+
+				responses := tests[idx].responses
+				res := responses[min(int(n), len(responses))-1]
+				for k, v := range res.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(res.status)
+				_, _ = io.WriteString(w, res.body)
+			}))
+			defer server.Close()
+
+			tr := NewRetryRoundTripper(http.DefaultTransport)
+			tr.BaseDelay = time.Millisecond
+
+			req, err := http.NewRequest(tests[idx].method, server.URL, strings.NewReader("payload"))
+			if err != nil {
+				t.Fatalf("create request: %s", err)
+			}
+
+			res, err := tr.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("round trip: %s", err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tests[idx].status || attempts.Load() != tests[idx].attempts {
+				t.Fatalf("response no match: %d after %d attempts", res.StatusCode, attempts.Load())
+			}
+
+			// The body is left untouched for the caller to read.
+			body, _ := io.ReadAll(res.Body)
+			if want := tests[idx].responses[min(int(attempts.Load()), len(tests[idx].responses))-1].body; string(body) != want {
+				t.Fatalf("body no match: %q", body)
+			}
+
+			if retries := tr.RateLimit().Retries; retries != tests[idx].attempts-1 {
+				t.Fatalf("retries no match: %d", retries)
+			}
+		})
+	}
+}
+
+func TestRetryRoundTripperRateLimit(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "4321")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	}))
+	defer server.Close()
+
+	tr := NewRetryRoundTripper(http.DefaultTransport)
+	res, err := (&http.Client{Transport: tr}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("get: %s", err)
+	}
+	res.Body.Close()
+
+	rateLimit := tr.RateLimit()
+	if rateLimit.Limit != 5000 || rateLimit.Remaining != 4321 || !rateLimit.Reset.Equal(reset) {
+		t.Fatalf("rate limit no match: %+v", rateLimit)
+	}
+}
@@ -0,0 +1,144 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+
+	"github.com/manzanit0/monocrat/pkg/attest"
+	"github.com/manzanit0/monocrat/pkg/oci"
+)
+
+// appBinary is where the generated build puts the application's binary.
+const appBinary = "/bin/app"
+
+// AttestOptions enable attaching an SBOM and a provenance document to every
+// published image, as OCI referrers.
+type AttestOptions struct {
+	// SBOMFormat is either spdx or cyclonedx. Defaults to spdx.
+	SBOMFormat string
+
+	// Repository is the URL of the source repository and SHA the commit being
+	// built, for the provenance.
+	Repository string
+	SHA        string
+}
+
+// Attestation is a document attached to a published image.
+type Attestation struct {
+	// Kind is either "sbom" or "provenance".
+	Kind         string
+	ArtifactType string
+	Digest       string
+
+	// Packages is the number of packages listed in an SBOM.
+	Packages int
+}
+
+// buildInfo runs `go version -m` on the application's binary within the
+// image. The binary of Dockerfile builds is the one declared, or else the
+// entrypoint.
+func buildInfo(ctx context.Context, client *dagger.Client, opts *BuildAndPushOptions, dockerfile *Dockerfile, variant *dagger.Container) (*debug.BuildInfo, error) {
+	binary := appBinary
+	builderImage := opts.Profile.builderImage()
+
+	if dockerfile != nil {
+		builderImage = DefaultBuilderImage
+		binary = dockerfile.Binary
+		if binary == "" {
+			entrypoint, err := variant.Entrypoint(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("get entrypoint: %w", err)
+			}
+
+			if len(entrypoint) == 0 || !strings.HasPrefix(entrypoint[0], "/") {
+				return nil, fmt.Errorf("can't find the Go binary from entrypoint %v: set the Dockerfile's binary", entrypoint)
+			}
+			binary = entrypoint[0]
+		}
+	}
+
+	output, err := client.Container().
+		From(builderImage).
+		WithMountedFile("/tmp/app", variant.File(binary)).
+		WithExec([]string{"go", "version", "-m", "/tmp/app"}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("go version -m %s: %w", binary, err)
+	}
+
+	return attest.ParseGoVersionM(output)
+}
+
+// attach generates the SBOM and provenance of a published image and pushes
+// them as referrers of it.
+func attach(ctx context.Context, registry Registry, published string, info *debug.BuildInfo, opts *BuildAndPushOptions, dockerfile *Dockerfile, platforms []string, startedOn time.Time) ([]Attestation, error) {
+	ref, err := oci.ParseReference(published)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := oci.Reference{Registry: ref.Registry, Repository: ref.Repository}.String()
+
+	sbom, err := attest.GenerateSBOM(info, attest.SBOMOptions{
+		Format:        opts.Attest.SBOMFormat,
+		Subject:       subject,
+		SubjectDigest: ref.Digest,
+		Created:       time.Now(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("generate SBOM: %w", err)
+	}
+
+	provenanceOpts := provenanceOptions(subject, ref.Digest, info, opts, dockerfile, platforms, startedOn)
+	provenance, err := attest.GenerateProvenance(provenanceOpts)
+	if err != nil {
+		return nil, fmt.Errorf("generate provenance: %w", err)
+	}
+
+	c := registry.client()
+	sbomDesc, err := c.Attach(ctx, ref, sbom.MediaType, sbom.MediaType, sbom.Content, nil)
+	if err != nil {
+		return nil, fmt.Errorf("attach SBOM: %w", err)
+	}
+
+	provenanceDesc, err := c.Attach(ctx, ref, attest.ArtifactTypeProvenance, attest.MediaTypeInToto, provenance, nil)
+	if err != nil {
+		return nil, fmt.Errorf("attach provenance: %w", err)
+	}
+
+	return []Attestation{
+		{Kind: "sbom", ArtifactType: sbom.MediaType, Digest: sbomDesc.Digest, Packages: sbom.Packages},
+		{Kind: "provenance", ArtifactType: attest.ArtifactTypeProvenance, Digest: provenanceDesc.Digest},
+	}, nil
+}
+
+// provenanceOptions describes how the image was built. Dockerfiles bring their
+// own builder image, which isn't known, so only that of generated builds is
+// recorded.
+func provenanceOptions(subject, digest string, info *debug.BuildInfo, opts *BuildAndPushOptions, dockerfile *Dockerfile, platforms []string, startedOn time.Time) attest.ProvenanceOptions {
+	provenanceOpts := attest.ProvenanceOptions{
+		Subject:       subject,
+		SubjectDigest: digest,
+		Repository:    opts.Attest.Repository,
+		SHA:           opts.Attest.SHA,
+		AppDirectory:  opts.AppDirectory,
+		Platforms:     platforms,
+		BuildFlags:    attest.BuildSettings(info),
+		StartedOn:     startedOn,
+		FinishedOn:    time.Now(),
+	}
+
+	if dockerfile != nil {
+		provenanceOpts.Dockerfile = dockerfile.Path
+		provenanceOpts.Target = dockerfile.Target
+	} else {
+		provenanceOpts.BuilderImage = opts.Profile.builderImage()
+	}
+
+	return provenanceOpts
+}
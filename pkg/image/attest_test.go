@@ -0,0 +1,96 @@
+package image
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/manzanit0/monocrat/pkg/attest"
+	"github.com/manzanit0/monocrat/pkg/oci"
+	"github.com/manzanit0/monocrat/pkg/oci/ocitest"
+)
+
+func TestAttach(t *testing.T) {
+	ctx := context.Background()
+	registry := ocitest.NewRegistry(t)
+	digest := registry.PutImage("monocrat-ci-check", "1.2.3", []byte("layer"))
+
+	info, err := attest.ParseGoVersionM("/tmp/app: go1.22.2\n\tpath\tgithub.com/manzanit0/monocrat/cmd/ci-check\n\tmod\tgithub.com/manzanit0/monocrat\t(devel)\t\n\tbuild\tCGO_ENABLED=0\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &BuildAndPushOptions{
+		AppDirectory: "cmd/ci-check/main.go",
+		Attest: &AttestOptions{
+			SBOMFormat: attest.FormatCycloneDX,
+			Repository: "https://github.com/manzanit0/monocrat.git",
+			SHA:        "28432ff413ca013a6a7c7cd344876c14611256b0",
+		},
+	}
+
+	published := registry.Address() + "/monocrat-ci-check:1.2.3@" + digest
+	attestations, err := attach(ctx, OCI(registry.Address(), "", Auth{}), published, info, opts, nil, []string{"linux/amd64"}, time.Now())
+	if err != nil {
+		t.Fatalf("attach: %s", err)
+	}
+
+	if len(attestations) != 2 {
+		t.Fatalf("expected 2 attestations, got %d", len(attestations))
+	}
+
+	c := &oci.Client{}
+	subject := oci.Reference{Registry: registry.Address(), Repository: "monocrat-ci-check", Digest: digest}
+	for _, artifactType := range []string{attest.MediaTypeCycloneDX, attest.ArtifactTypeProvenance} {
+		referrers, err := c.Referrers(ctx, subject, artifactType)
+		if err != nil {
+			t.Fatalf("list referrers: %s", err)
+		}
+
+		if len(referrers) != 1 {
+			t.Fatalf("expected a single %s referrer, got %d", artifactType, len(referrers))
+		}
+	}
+}
+
+func TestProvenanceOptions(t *testing.T) {
+	info, err := attest.ParseGoVersionM("/tmp/app: go1.22.2\n\tpath\tgithub.com/manzanit0/monocrat/cmd/ci-check\n\tmod\tgithub.com/manzanit0/monocrat\t(devel)\t\n\tbuild\tCGO_ENABLED=0\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &BuildAndPushOptions{
+		AppDirectory: "cmd/ci-check/main.go",
+		Attest: &AttestOptions{
+			Repository: "https://github.com/manzanit0/monocrat.git",
+			SHA:        "28432ff413ca013a6a7c7cd344876c14611256b0",
+		},
+	}
+
+	tests := []struct {
+		name         string
+		dockerfile   *Dockerfile
+		builderImage string
+		path         string
+	}{
+		{
+			name:         "generated",
+			builderImage: DefaultBuilderImage,
+		},
+		{
+			name:       "Dockerfile",
+			dockerfile: &Dockerfile{Path: "cmd/ci-check/Dockerfile"},
+			path:       "cmd/ci-check/Dockerfile",
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			got := provenanceOptions("ghcr.io/manzanit0/monocrat-ci-check", "sha256:4f2a", info, opts, tests[idx].dockerfile, []string{"linux/amd64"}, time.Now())
+
+			if got.BuilderImage != tests[idx].builderImage || got.Dockerfile != tests[idx].path || got.BuildFlags["CGO_ENABLED"] != "0" {
+				t.Fatalf("provenance options no match: %+v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"dagger.io/dagger"
+)
+
+// DockerfileName is the name of the Dockerfile detected next to an
+// application.
+const DockerfileName = "Dockerfile"
+
+// Dockerfile is an application's own Dockerfile, used instead of the generated
+// build. It is built with the repository as its context, so it can copy
+// anything within the monorepo.
+type Dockerfile struct {
+	// Path is the Dockerfile's path relative to the repository root.
+	Path string `json:"path"`
+
+	// BuildArgs are passed to the build on top of APP_VERSION and
+	// APP_DIRECTORY, which are always set.
+	BuildArgs map[string]string `json:"build_args,omitempty"`
+
+	// Target is the stage to build. Defaults to the last one.
+	Target string `json:"target,omitempty"`
+
+	// Binary is the path of the application's Go binary within the image,
+	// which the SBOM is generated from. Defaults to the entrypoint.
+	Binary string `json:"binary,omitempty"`
+}
+
+// FindDockerfile looks for a Dockerfile in the application's directory, which
+// is relative to the repository. It returns nil when there is none.
+func FindDockerfile(repositoryDirectory, appDirectory string) (*Dockerfile, error) {
+	path := filepath.Join(appPackageDirectory(appDirectory), DockerfileName)
+
+	info, err := os.Stat(filepath.Join(repositoryDirectory, path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("stat %s: %w", path, err)
+	}
+
+	if info.IsDir() {
+		return nil, nil
+	}
+
+	return &Dockerfile{Path: path}, nil
+}
+
+// appPackageDirectory returns the directory of the application's main package,
+// since applications may be referenced by their main.go file.
+func appPackageDirectory(appDirectory string) string {
+	if strings.HasSuffix(appDirectory, ".go") {
+		return filepath.Dir(appDirectory)
+	}
+
+	return filepath.Clean(appDirectory)
+}
+
+// buildArgs returns the build args of the Dockerfile, sorted by name so the
+// build is cached across runs.
+func (d *Dockerfile) buildArgs(appVersion, appDirectory string, private *PrivateModules) []dagger.BuildArg {
+	args := map[string]string{
+		"APP_VERSION":   appVersion,
+		"APP_DIRECTORY": appPackageDirectory(appDirectory),
+	}
+
+	if private != nil && len(private.Patterns) > 0 {
+		args["GOPRIVATE"] = strings.Join(private.Patterns, ",")
+		args["GONOSUMDB"] = args["GOPRIVATE"]
+	}
+
+	if private != nil && len(private.Credentials) > 0 {
+		args[NetrcSecretArg] = private.netrcSecretName()
+	}
+
+	for name, value := range d.BuildArgs {
+		args[name] = value
+	}
+
+	var buildArgs []dagger.BuildArg
+	for _, name := range sortedKeys(args) {
+		buildArgs = append(buildArgs, dagger.BuildArg{Name: name, Value: args[name]})
+	}
+
+	return buildArgs
+}
+
+// buildDockerfile returns the container built from the Dockerfile for the
+// platform. Unlike the generated build, it runs emulated on the target
+// platform since there's no telling what the Dockerfile does.
+func buildDockerfile(client *dagger.Client, opts *BuildAndPushOptions, dockerfile *Dockerfile, platform string) *dagger.Container {
+	var secrets []*dagger.Secret
+	if opts.PrivateModules != nil && len(opts.PrivateModules.Credentials) > 0 {
+		secrets = append(secrets, opts.PrivateModules.netrcSecret(client))
+	}
+
+	return client.Host().Directory(opts.RepositoryDirectory).
+		DockerBuild(dagger.DirectoryDockerBuildOpts{
+			Platform:   dagger.Platform(platform),
+			Dockerfile: filepath.ToSlash(dockerfile.Path),
+			Target:     dockerfile.Target,
+			BuildArgs:  dockerfile.buildArgs(opts.AppVersion, opts.AppDirectory, opts.PrivateModules),
+			Secrets:    secrets,
+		})
+}
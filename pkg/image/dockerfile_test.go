@@ -0,0 +1,115 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"dagger.io/dagger"
+)
+
+func TestFindDockerfile(t *testing.T) {
+	repositoryDirectory := t.TempDir()
+
+	for _, dir := range []string{"cmd/with-dockerfile", "cmd/without-dockerfile", "cmd/dockerfile-dir/Dockerfile"} {
+		if err := os.MkdirAll(filepath.Join(repositoryDirectory, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := os.WriteFile(filepath.Join(repositoryDirectory, "cmd/with-dockerfile/Dockerfile"), []byte("FROM scratch\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		appDirectory string
+		path         string
+	}{
+		{
+			name:         "next to main.go",
+			appDirectory: "cmd/with-dockerfile/main.go",
+			path:         "cmd/with-dockerfile/Dockerfile",
+		},
+		{
+			name:         "in the package directory",
+			appDirectory: "./cmd/with-dockerfile",
+			path:         "cmd/with-dockerfile/Dockerfile",
+		},
+		{
+			name:         "no Dockerfile",
+			appDirectory: "cmd/without-dockerfile/main.go",
+		},
+		{
+			name:         "directory named Dockerfile",
+			appDirectory: "cmd/dockerfile-dir/main.go",
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			dockerfile, err := FindDockerfile(repositoryDirectory, tests[idx].appDirectory)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+
+			if tests[idx].path == "" {
+				if dockerfile != nil {
+					t.Fatalf("expected no Dockerfile, got %s", dockerfile.Path)
+				}
+				return
+			}
+
+			if dockerfile == nil || dockerfile.Path != tests[idx].path {
+				t.Fatalf("Dockerfile no match: %+v", dockerfile)
+			}
+		})
+	}
+}
+
+func TestDockerfileBuildArgs(t *testing.T) {
+	dockerfile := &Dockerfile{
+		Path:      "cmd/ci-check/Dockerfile",
+		BuildArgs: map[string]string{"GO_VERSION": "1.22", "APP_VERSION": "overridden"},
+	}
+
+	args := dockerfile.buildArgs("1.2.3", "cmd/ci-check/main.go", nil)
+	want := []dagger.BuildArg{
+		{Name: "APP_DIRECTORY", Value: "cmd/ci-check"},
+		{Name: "APP_VERSION", Value: "overridden"},
+		{Name: "GO_VERSION", Value: "1.22"},
+	}
+
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("build args no match: %v", args)
+	}
+}
+
+func TestDockerfileBuildArgsWithPrivateModules(t *testing.T) {
+	dockerfile := &Dockerfile{Path: "cmd/ci-check/Dockerfile"}
+	private := &PrivateModules{
+		Patterns:    []string{"github.com/manzanit0/*", "example.com/private"},
+		Credentials: []Credential{{Host: "github.com", Username: "x-access-token", Password: "ghs_1"}},
+	}
+
+	args := dockerfile.buildArgs("1.2.3", "cmd/ci-check/main.go", private)
+	want := []dagger.BuildArg{
+		{Name: "APP_DIRECTORY", Value: "cmd/ci-check"},
+		{Name: "APP_VERSION", Value: "1.2.3"},
+		{Name: "GONOSUMDB", Value: "github.com/manzanit0/*,example.com/private"},
+		{Name: "GOPRIVATE", Value: "github.com/manzanit0/*,example.com/private"},
+		{Name: "NETRC_SECRET", Value: private.netrcSecretName()},
+	}
+
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("build args no match: %v", args)
+	}
+
+	// Another installation's token gets a secret of its own.
+	other := &PrivateModules{Credentials: []Credential{{Host: "github.com", Username: "x-access-token", Password: "ghs_2"}}}
+	if other.netrcSecretName() == private.netrcSecretName() {
+		t.Fatalf("expected secret names to differ: %s", other.netrcSecretName())
+	}
+}
@@ -2,53 +2,496 @@ package image
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
 
 	"dagger.io/dagger"
+
+	"github.com/manzanit0/monocrat/pkg/cosign"
+	"github.com/manzanit0/monocrat/pkg/oci"
+	"github.com/manzanit0/monocrat/pkg/vuln"
 )
 
 type BuildAndPushOptions struct {
-	DockerHubUsername   string
-	DockerHubPassword   string
-	DockerHubRepository string
+	// Registries are all the registries the image will be pushed to.
+	Registries []Registry
+
+	// Repository is the name of the image repository within each registry's
+	// namespace, e.g. "monocrat-ci-check".
+	Repository          string
 	RepositoryDirectory string
 	AppVersion          string
 	AppDirectory        string
+
+	// Platforms are the platforms to build the image for, e.g. "linux/amd64"
+	// and "linux/arm64". The binary is cross-compiled for each of them and all
+	// are published under a single image index. Defaults to the platform of
+	// the engine.
+	Platforms []string
+
+	// Profile describes how to compile and package the application.
+	Profile BuildProfile
+
+	// Dockerfile builds the image from the application's own Dockerfile
+	// instead, ignoring the profile. When nil, a Dockerfile next to the
+	// application is used if there is one.
+	Dockerfile *Dockerfile
+
+	// PrivateModules lets the build fetch private Go modules, so they don't
+	// need vendoring beforehand.
+	PrivateModules *PrivateModules
+
+	// Attest attaches an SBOM and a provenance document to the images. No
+	// attestations are generated when nil.
+	Attest *AttestOptions
+
+	// Scan checks the application for vulnerabilities before pushing. No scan
+	// happens when nil.
+	Scan *ScanOptions
+
+	// SigningKey signs the images with cosign-compatible signatures. Images
+	// aren't signed when nil.
+	SigningKey *ecdsa.PrivateKey
+
+	// Log receives the logs of the engine while the build runs, besides
+	// stderr. It never gets those of other builds.
+	Log io.Writer
+}
+
+// Image is an image published to a registry.
+type Image struct {
+	// Ref is the published reference, including the digest of the image
+	// index.
+	Ref string
+
+	// Platforms holds the digest of the manifest for every platform within the
+	// image index.
+	Platforms []PlatformDigest
+
+	// Attestations are the documents attached to the image index.
+	Attestations []Attestation
+
+	// Signature is the digest of the manifest holding the signatures of the
+	// image index, when signed.
+	Signature string
+
+	// Vulnerabilities are the findings of the scan which didn't stop the
+	// image from being pushed.
+	Vulnerabilities []vuln.Finding
+}
+
+type PlatformDigest struct {
+	Platform string
+	Digest   string
 }
 
-// BuildAndPush builds the specified Go application and pushes the image to DockerHub.
-func BuildAndPush(ctx context.Context, opts *BuildAndPushOptions) error {
-	client, err := dagger.Connect(ctx, dagger.WithLogOutput(os.Stderr))
+// BuildAndPush builds the specified Go application and pushes the image to
+// every registry in the options. Use a Builder to build several applications.
+func BuildAndPush(ctx context.Context, opts *BuildAndPushOptions) ([]Image, error) {
+	b := NewBuilder()
+	defer b.Close()
+
+	return b.BuildAndPush(ctx, opts)
+}
+
+// Builder builds images, each over a connection to the engine of its own so
+// that its logs only ever show that build. Builds still share the engine's
+// layer cache and the Go module and build caches, which the engine keeps
+// across connections. It is safe for concurrent use.
+type Builder struct {
+	mu      sync.Mutex
+	clients map[*dagger.Client]struct{}
+
+	// dial connects to the engine, with its logs going to w.
+	dial func(ctx context.Context, w io.Writer) (*dagger.Client, error)
+}
+
+// NewBuilder returns a builder which connects to the engine for every build.
+func NewBuilder() *Builder {
+	return &Builder{clients: map[*dagger.Client]struct{}{}, dial: dialEngine}
+}
+
+func dialEngine(ctx context.Context, w io.Writer) (*dagger.Client, error) {
+	return dagger.Connect(ctx, dagger.WithLogOutput(w))
+}
+
+// connect returns the client of a build, with its logs going to stderr and w
+// if not nil, until the returned func closes it.
+func (b *Builder) connect(ctx context.Context, w io.Writer) (*dagger.Client, func(), error) {
+	client, err := b.dial(ctx, newBuildLog(os.Stderr, w))
 	if err != nil {
-		return fmt.Errorf("dagger connect: %w", err)
+		return nil, nil, fmt.Errorf("dagger connect: %w", err)
+	}
+
+	b.mu.Lock()
+	b.clients[client] = struct{}{}
+	b.mu.Unlock()
+
+	return client, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.clients[client]; ok {
+			delete(b.clients, client)
+			_ = client.Close()
+		}
+	}, nil
+}
+
+// Close ends the connections of the builds in progress, if any.
+func (b *Builder) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var errs []error
+	for client := range b.clients {
+		errs = append(errs, client.Close())
+		delete(b.clients, client)
+	}
+
+	return errors.Join(errs...)
+}
+
+// BuildAndPush builds the specified Go application and pushes the image to
+// every registry in the options.
+func (b *Builder) BuildAndPush(ctx context.Context, opts *BuildAndPushOptions) ([]Image, error) {
+	if len(opts.Registries) == 0 {
+		return nil, fmt.Errorf("no registries to push to")
+	}
+
+	client, release, err := b.connect(ctx, opts.Log)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	built, err := b.build(ctx, client, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// And push the image to every registry. The image is only built once, the
+	// engine caches it across the publishes.
+	var images []Image
+	for _, registry := range opts.Registries {
+		ref, err := withRegistryAuth(built.client, built.variants[0], registry).
+			Publish(ctx, registry.Ref(opts.Repository, opts.AppVersion), dagger.ContainerPublishOpts{
+				PlatformVariants: built.variants[1:],
+			})
+		if err != nil {
+			return images, fmt.Errorf("build & publish image to %s: %w", registry.Address, err)
+		}
+
+		digests, err := platformDigests(ctx, registry, ref, built.platforms)
+		if err != nil {
+			return images, fmt.Errorf("inspect published image %s: %w", ref, err)
+		}
+
+		img := Image{Ref: ref, Platforms: digests, Vulnerabilities: built.findings}
+		if opts.SigningKey != nil {
+			img.Signature, err = sign(ctx, registry, ref, opts.SigningKey)
+			if err != nil {
+				return images, fmt.Errorf("sign published image %s: %w", ref, err)
+			}
+		}
+
+		if opts.Attest != nil {
+			img.Attestations, err = attach(ctx, registry, ref, built.info, opts, built.dockerfile, built.platforms, built.startedOn)
+			if err != nil {
+				return images, fmt.Errorf("attest published image %s: %w", ref, err)
+			}
+		}
+
+		images = append(images, img)
+	}
+
+	return images, nil
+}
+
+// Export is an image exported to an OCI tarball on the host.
+type Export struct {
+	Path      string
+	Platforms []string
+
+	// Vulnerabilities are the findings of the scan which didn't fail the
+	// build.
+	Vulnerabilities []vuln.Finding
+}
+
+// Build builds the specified Go application like BuildAndPush, but exports
+// the image as an OCI tarball into the directory instead of pushing it. The
+// registries, attestations and signing key in the options are ignored since
+// nothing gets published.
+func (b *Builder) Build(ctx context.Context, opts *BuildAndPushOptions, directory string) (*Export, error) {
+	client, release, err := b.connect(ctx, opts.Log)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	built, err := b.build(ctx, client, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(directory, fmt.Sprintf("%s-%s.tar", opts.Repository, opts.AppVersion))
+	_, err = built.variants[0].Export(ctx, path, dagger.ContainerExportOpts{
+		PlatformVariants: built.variants[1:],
+	})
+	if err != nil {
+		return nil, fmt.Errorf("export image to %s: %w", path, err)
+	}
+
+	return &Export{Path: path, Platforms: built.platforms, Vulnerabilities: built.findings}, nil
+}
+
+// built is an application built for every platform, yet to be published or
+// exported.
+type built struct {
+	client     *dagger.Client
+	platforms  []string
+	dockerfile *Dockerfile
+	variants   []*dagger.Container
+	startedOn  time.Time
+
+	// info is the build info of the binary, only read when attesting or
+	// scanning, and findings what the scan found.
+	info     *debug.BuildInfo
+	findings []vuln.Finding
+}
+
+func (b *Builder) build(ctx context.Context, client *dagger.Client, opts *BuildAndPushOptions) (*built, error) {
+	if err := opts.Profile.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid build profile: %w", err)
+	}
+
+	startedOn := time.Now()
+
+	platforms := opts.Platforms
+	if len(platforms) == 0 {
+		platform, err := client.DefaultPlatform(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get default platform: %w", err)
+		}
+
+		platforms = []string{string(platform)}
+	}
+
+	var err error
+	dockerfile := opts.Dockerfile
+	if dockerfile == nil {
+		dockerfile, err = FindDockerfile(opts.RepositoryDirectory, opts.AppDirectory)
+		if err != nil {
+			return nil, fmt.Errorf("find Dockerfile: %w", err)
+		}
+	}
+
+	// Dockerfiles bring their own toolchain.
+	if dockerfile == nil && opts.Profile.cgo() {
+		engine, err := client.DefaultPlatform(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get default platform: %w", err)
+		}
+
+		if err := opts.Profile.ValidatePlatforms(string(engine), platforms); err != nil {
+			return nil, fmt.Errorf("invalid build profile: %w", err)
+		}
+	}
+
+	var variants []*dagger.Container
+	for _, platform := range platforms {
+		if dockerfile != nil {
+			variants = append(variants, buildDockerfile(client, opts, dockerfile, platform))
+			continue
+		}
+
+		variant, err := build(client, opts, platform)
+		if err != nil {
+			return nil, fmt.Errorf("build for %s: %w", platform, err)
+		}
+
+		variants = append(variants, variant)
+	}
+
+	// The module graph doesn't depend on the platform, so the SBOM and the
+	// scan of any variant's binary cover them all.
+	var info *debug.BuildInfo
+	if opts.Attest != nil || opts.Scan != nil {
+		info, err = buildInfo(ctx, client, opts, dockerfile, variants[0])
+		if err != nil {
+			return nil, fmt.Errorf("read build info: %w", err)
+		}
+	}
+
+	var findings []vuln.Finding
+	if opts.Scan != nil {
+		findings, err = scan(ctx, opts.Scan, info)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &built{
+		client:     client,
+		platforms:  platforms,
+		dockerfile: dockerfile,
+		variants:   variants,
+		startedOn:  startedOn,
+		info:       info,
+		findings:   findings,
+	}, nil
+}
+
+// Where the Go module and build caches are mounted within the builder.
+const (
+	goModCache   = "/cache/go-mod"
+	goBuildCache = "/cache/go-build"
+)
+
+// build returns the runtime container of the application for the platform.
+// The binary is always compiled on the engine's own platform, since
+// cross-compiling is much faster than emulating the target.
+func build(client *dagger.Client, opts *BuildAndPushOptions, platform string) (*dagger.Container, error) {
+	env, err := platformEnv(platform)
+	if err != nil {
+		return nil, err
 	}
-	defer client.Close()
 
 	workspace := client.Host().Directory(opts.RepositoryDirectory)
+	profile := opts.Profile
+
+	cgo := "0"
+	if profile.cgo() {
+		cgo = "1"
+	}
 
-	// Now let's build a multi-stage image
+	// Now let's build a multi-stage image. The module and build caches are
+	// shared by every build, they are keyed by content anyway.
 	builder := client.Container().
-		From("golang:1.22").
+		From(profile.builderImage()).
+		WithMountedCache(goModCache, client.CacheVolume("monocrat-gomodcache")).
+		WithMountedCache(goBuildCache, client.CacheVolume("monocrat-gocache")).
+		WithEnvVariable("GOMODCACHE", goModCache).
+		WithEnvVariable("GOCACHE", goBuildCache).
 		WithDirectory("/workspace", workspace).
 		WithWorkdir("/workspace").
-		WithEnvVariable("CGO_ENABLED", "0").
-		WithEnvVariable("GOWORK", "off").
-		WithEnvVariable("GOPRIVATE", "github.com/docker").
-		WithExec([]string{"go", "build", "-ldflags", fmt.Sprintf("-X main.version=%s", opts.AppVersion), "-o", "app", opts.AppDirectory})
+		WithEnvVariable("CGO_ENABLED", cgo).
+		WithEnvVariable("GOWORK", "off")
+
+	builder = withPrivateModules(client, builder, opts.PrivateModules)
+
+	for _, name := range sortedKeys(profile.Env) {
+		builder = builder.WithEnvVariable(name, profile.Env[name])
+	}
+
+	for _, name := range []string{"GOOS", "GOARCH", "GOARM", "GOAMD64"} {
+		if value, ok := env[name]; ok {
+			builder = builder.WithEnvVariable(name, value)
+		}
+	}
 
-	prodImage := client.Container().
-		From("alpine:3.19").
-		WithFile("/bin/app", builder.File("/workspace/app")).
-		WithEntrypoint([]string{"/bin/app"})
+	builder = builder.WithExec(profile.buildArgs(opts.AppVersion, opts.AppDirectory))
 
-	// And push the image to DockerHub
-	_, err = prodImage.
-		WithRegistryAuth("docker.io", opts.DockerHubUsername, client.SetSecret("password", opts.DockerHubPassword)).
-		Publish(ctx, fmt.Sprintf("%s/%s:%s", opts.DockerHubUsername, opts.DockerHubRepository, opts.AppVersion))
+	prodImage := client.Container(dagger.ContainerOpts{Platform: dagger.Platform(platform)})
+	if runtimeImage := profile.runtimeImage(); runtimeImage != "" {
+		prodImage = prodImage.From(runtimeImage)
+	} else {
+		// Scratch has nothing at all, but the application will most likely
+		// need to verify TLS certificates.
+		prodImage = prodImage.WithFile("/etc/ssl/certs/ca-certificates.crt", builder.File("/etc/ssl/certs/ca-certificates.crt"))
+	}
+
+	prodImage = prodImage.
+		WithFile(appBinary, builder.File("/workspace/app")).
+		WithEntrypoint([]string{appBinary})
+
+	for _, port := range profile.Ports {
+		prodImage = prodImage.WithExposedPort(port)
+	}
+
+	if profile.User != "" {
+		prodImage = prodImage.WithUser(profile.User)
+	}
+
+	if profile.Healthcheck != nil {
+		label, err := profile.Healthcheck.label()
+		if err != nil {
+			return nil, err
+		}
+
+		prodImage = prodImage.WithLabel(HealthcheckLabel, label)
+	}
+
+	return prodImage, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// platformDigests reads the published image back from the registry to find
+// the digest of each platform's manifest.
+func platformDigests(ctx context.Context, registry Registry, published string, platforms []string) ([]PlatformDigest, error) {
+	ref, err := oci.ParseReference(published)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := registry.client().Index(ctx, ref)
 	if err != nil {
-		return fmt.Errorf("build & publish image: %w", err)
+		return nil, err
+	}
+
+	var digests []PlatformDigest
+	for _, manifest := range index.Manifests {
+		// Single-platform builds aren't published as an index, so their only
+		// manifest doesn't carry a platform.
+		platform := platforms[0]
+		if manifest.Platform != nil {
+			platform = manifest.Platform.String()
+		}
+
+		digests = append(digests, PlatformDigest{Platform: platform, Digest: manifest.Digest})
+	}
+
+	return digests, nil
+}
+
+// sign signs the image index and returns the digest of the signatures.
+func sign(ctx context.Context, registry Registry, published string, key *ecdsa.PrivateKey) (string, error) {
+	ref, err := oci.ParseReference(published)
+	if err != nil {
+		return "", err
+	}
+
+	desc, err := cosign.Sign(ctx, registry.client(), ref, key)
+	if err != nil {
+		return "", err
+	}
+
+	return desc.Digest, nil
+}
+
+func withRegistryAuth(client *dagger.Client, container *dagger.Container, registry Registry) *dagger.Container {
+	if registry.IsAnonymous() {
+		return container
 	}
 
-	return nil
+	username, secret := registry.Auth.credentials()
+	name := fmt.Sprintf("registry-%s-%s", registry.Address, registry.Namespace)
+	return container.WithRegistryAuth(registry.Address, username, client.SetSecret(name, secret))
 }
@@ -0,0 +1,248 @@
+package image
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testRegistry returns the address of a local registry:2 stand-in, e.g.
+//
+//	docker run -d -p 5000:5000 registry:2
+//	MONOCRAT_TEST_REGISTRY=localhost:5000 go test ./pkg/image/...
+//
+// Tests which need it are skipped when it isn't set.
+func testRegistry(t *testing.T) string {
+	t.Helper()
+
+	address := os.Getenv("MONOCRAT_TEST_REGISTRY")
+	if address == "" {
+		t.Skip("MONOCRAT_TEST_REGISTRY not set")
+	}
+
+	return address
+}
+
+// testApplication writes a minimal Go module with a runnable application and
+// returns the repository directory and the application's relative directory.
+func testApplication(t *testing.T) (string, string) {
+	t.Helper()
+
+	repositoryDirectory := t.TempDir()
+	appDirectory := filepath.Join("cmd", "hello")
+
+	err := os.MkdirAll(filepath.Join(repositoryDirectory, appDirectory), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(repositoryDirectory, "go.mod"), []byte("module example.com/hello\n\ngo 1.22\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	main := "package main\n\nvar version string\n\nfunc main() { println(version) }\n"
+	err = os.WriteFile(filepath.Join(repositoryDirectory, appDirectory, "main.go"), []byte(main), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return repositoryDirectory, "./" + appDirectory
+}
+
+func TestBuildAndPushToSeveralRegistries(t *testing.T) {
+	address := testRegistry(t)
+	repositoryDirectory, appDirectory := testApplication(t)
+
+	registries := []Registry{
+		OCI(address, "team-a", Auth{}),
+		OCI(address, "team-b", Auth{}),
+	}
+
+	images, err := BuildAndPush(context.Background(), &BuildAndPushOptions{
+		Registries:          registries,
+		Repository:          "monocrat-hello",
+		RepositoryDirectory: repositoryDirectory,
+		AppVersion:          "1.2.3",
+		AppDirectory:        appDirectory,
+	})
+	if err != nil {
+		t.Fatalf("build and push: %s", err)
+	}
+
+	if len(images) != len(registries) {
+		t.Fatalf("expected %d published images, got %d", len(registries), len(images))
+	}
+
+	for _, registry := range registries {
+		url := fmt.Sprintf("http://%s/v2/%s/monocrat-hello/manifests/1.2.3", address, registry.Namespace)
+		req, err := http.NewRequest(http.MethodHead, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", "application/vnd.oci.image.manifest.v1+json")
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("manifest not found in %s: %d", registry.Namespace, res.StatusCode)
+		}
+	}
+}
+
+func TestBuildAndPushMultiPlatform(t *testing.T) {
+	address := testRegistry(t)
+	repositoryDirectory, appDirectory := testApplication(t)
+
+	images, err := BuildAndPush(context.Background(), &BuildAndPushOptions{
+		Registries:          []Registry{OCI(address, "", Auth{})},
+		Repository:          "monocrat-hello-multiarch",
+		RepositoryDirectory: repositoryDirectory,
+		AppVersion:          "1.2.3",
+		AppDirectory:        appDirectory,
+		Platforms:           []string{"linux/amd64", "linux/arm64"},
+	})
+	if err != nil {
+		t.Fatalf("build and push: %s", err)
+	}
+
+	if len(images) != 1 {
+		t.Fatalf("expected 1 published image, got %d", len(images))
+	}
+
+	platforms := map[string]string{}
+	for _, p := range images[0].Platforms {
+		platforms[p.Platform] = p.Digest
+	}
+
+	for _, platform := range []string{"linux/amd64", "linux/arm64"} {
+		if platforms[platform] == "" {
+			t.Fatalf("missing digest for %s: %v", platform, images[0].Platforms)
+		}
+	}
+}
+
+func TestBuildAndPushWithDockerfile(t *testing.T) {
+	address := testRegistry(t)
+	repositoryDirectory, appDirectory := testApplication(t)
+
+	dockerfile := `FROM golang:1.22 AS build
+ARG APP_VERSION
+ARG APP_DIRECTORY
+WORKDIR /workspace
+COPY . .
+RUN CGO_ENABLED=0 go build -ldflags "-X main.version=${APP_VERSION}" -o /app ./${APP_DIRECTORY}
+
+FROM alpine:3.19 AS release
+COPY --from=build /app /bin/app
+ENTRYPOINT ["/bin/app"]
+
+FROM release AS debug
+RUN apk add --no-cache curl
+`
+	path := filepath.Join(repositoryDirectory, appDirectory, DockerfileName)
+	if err := os.WriteFile(path, []byte(dockerfile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := BuildAndPush(context.Background(), &BuildAndPushOptions{
+		Registries:          []Registry{OCI(address, "", Auth{})},
+		Repository:          "monocrat-hello-dockerfile",
+		RepositoryDirectory: repositoryDirectory,
+		AppVersion:          "1.2.3",
+		AppDirectory:        appDirectory,
+		Dockerfile: &Dockerfile{
+			Path:   filepath.Join(appDirectory, DockerfileName),
+			Target: "release",
+		},
+	})
+	if err != nil {
+		t.Fatalf("build and push: %s", err)
+	}
+
+	if len(images) != 1 || len(images[0].Platforms) != 1 {
+		t.Fatalf("expected a single-platform image, got %+v", images)
+	}
+}
+
+func TestBuilderConcurrentBuilds(t *testing.T) {
+	address := testRegistry(t)
+	repositoryDirectory, appDirectory := testApplication(t)
+
+	b := NewBuilder()
+	defer b.Close()
+
+	errs := make(chan error, 3)
+	for i := 0; i < cap(errs); i++ {
+		go func(i int) {
+			_, err := b.BuildAndPush(context.Background(), &BuildAndPushOptions{
+				Registries:          []Registry{OCI(address, "concurrent", Auth{})},
+				Repository:          fmt.Sprintf("monocrat-hello-%d", i),
+				RepositoryDirectory: repositoryDirectory,
+				AppVersion:          "1.2.3",
+				AppDirectory:        appDirectory,
+			})
+			errs <- err
+		}(i)
+	}
+
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("build and push: %s", err)
+		}
+	}
+}
+
+func TestBuildExportsTarball(t *testing.T) {
+	// Nothing is pushed, but the registry doubles as the sign that an engine
+	// is around.
+	testRegistry(t)
+	repositoryDirectory, appDirectory := testApplication(t)
+	exportDirectory := t.TempDir()
+
+	export, err := NewBuilder().Build(context.Background(), &BuildAndPushOptions{
+		Repository:          "monocrat-hello",
+		RepositoryDirectory: repositoryDirectory,
+		AppVersion:          "1.2.3",
+		AppDirectory:        appDirectory,
+		Platforms:           []string{"linux/amd64", "linux/arm64"},
+	}, exportDirectory)
+	if err != nil {
+		t.Fatalf("build: %s", err)
+	}
+
+	if export.Path != filepath.Join(exportDirectory, "monocrat-hello-1.2.3.tar") {
+		t.Fatalf("unexpected export path %s", export.Path)
+	}
+
+	f, err := os.Open(export.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// An OCI layout has an index.json at its root.
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			t.Fatalf("index.json not found in %s", export.Path)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if header.Name == "index.json" {
+			break
+		}
+	}
+}
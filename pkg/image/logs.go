@@ -0,0 +1,26 @@
+package image
+
+import (
+	"io"
+)
+
+// buildLog copies the logs of a build's connection to the engine to out and
+// to the writer of the build, if any.
+type buildLog struct {
+	out io.Writer
+	w   io.Writer
+}
+
+func newBuildLog(out, w io.Writer) *buildLog {
+	return &buildLog{out: out, w: w}
+}
+
+// Write never fails, a broken writer mustn't break the build.
+func (l *buildLog) Write(p []byte) (int, error) {
+	_, _ = l.out.Write(p)
+	if l.w != nil {
+		_, _ = l.w.Write(p)
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,98 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"dagger.io/dagger"
+)
+
+// brokenWriter fails every write.
+type brokenWriter struct{}
+
+func (brokenWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken")
+}
+
+func TestBuildLog(t *testing.T) {
+	var out, w bytes.Buffer
+
+	_, _ = newBuildLog(&out, &w).Write([]byte("build\n"))
+	if out.String() != "build\n" || w.String() != "build\n" {
+		t.Fatalf("logs no match: %q, %q", out.String(), w.String())
+	}
+
+	if n, err := newBuildLog(&out, nil).Write([]byte("no writer\n")); n != 10 || err != nil {
+		t.Fatalf("write without writer no match: %d, %v", n, err)
+	}
+
+	if n, err := newBuildLog(&out, brokenWriter{}).Write([]byte("broken\n")); n != 7 || err != nil {
+		t.Fatalf("write to broken writer no match: %d, %v", n, err)
+	}
+}
+
+// TestBuilderLogs connects two builds at the same time, checking neither gets
+// the logs of the other.
+func TestBuilderLogs(t *testing.T) {
+	var mu sync.Mutex
+	engineLogs := map[*dagger.Client]io.Writer{}
+
+	b := NewBuilder()
+	b.dial = func(ctx context.Context, w io.Writer) (*dagger.Client, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		client := &dagger.Client{}
+		engineLogs[client] = w
+		return client, nil
+	}
+	defer b.Close()
+
+	var first, second bytes.Buffer
+	var wg, connected sync.WaitGroup
+	connected.Add(2)
+	for _, build := range []struct {
+		w    *bytes.Buffer
+		line string
+	}{{&first, "building api\n"}, {&second, "building worker\n"}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			client, release, err := b.connect(context.Background(), build.w)
+			if err != nil {
+				t.Errorf("connect: %s", err)
+				connected.Done()
+				return
+			}
+			defer release()
+
+			// Both builds are in progress.
+			connected.Done()
+			connected.Wait()
+
+			mu.Lock()
+			logs := engineLogs[client]
+			mu.Unlock()
+
+			_, _ = logs.Write([]byte(build.line))
+		}()
+	}
+	wg.Wait()
+
+	if first.String() != "building api\n" {
+		t.Fatalf("first build log no match: %q", first.String())
+	}
+
+	if second.String() != "building worker\n" {
+		t.Fatalf("second build log no match: %q", second.String())
+	}
+
+	if len(b.clients) != 0 {
+		t.Fatalf("expected connections closed, got %d", len(b.clients))
+	}
+}
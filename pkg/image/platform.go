@@ -0,0 +1,37 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+)
+
+// platformEnv returns the environment variables to cross-compile a Go binary
+// for a platform such as "linux/amd64" or "linux/arm/v7".
+func platformEnv(platform string) (map[string]string, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid platform %q: expected os/arch[/variant]", platform)
+	}
+
+	env := map[string]string{
+		"GOOS":   parts[0],
+		"GOARCH": parts[1],
+	}
+
+	if len(parts) == 3 {
+		variant := parts[2]
+		switch parts[1] {
+		case "arm":
+			env["GOARM"] = strings.TrimPrefix(variant, "v")
+		case "amd64":
+			env["GOAMD64"] = variant
+		case "arm64":
+			// Go only targets the v8 baseline for arm64, the variant carries
+			// no build information.
+		default:
+			return nil, fmt.Errorf("invalid platform %q: unsupported variant %s", platform, variant)
+		}
+	}
+
+	return env, nil
+}
@@ -0,0 +1,58 @@
+package image
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlatformEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform string
+		env      map[string]string
+		fail     bool
+	}{
+		{
+			name:     "amd64",
+			platform: "linux/amd64",
+			env:      map[string]string{"GOOS": "linux", "GOARCH": "amd64"},
+		},
+		{
+			name:     "arm with variant",
+			platform: "linux/arm/v7",
+			env:      map[string]string{"GOOS": "linux", "GOARCH": "arm", "GOARM": "7"},
+		},
+		{
+			name:     "arm64 variant is ignored",
+			platform: "linux/arm64/v8",
+			env:      map[string]string{"GOOS": "linux", "GOARCH": "arm64"},
+		},
+		{
+			name:     "missing architecture",
+			platform: "linux",
+			fail:     true,
+		},
+		{
+			name:     "unsupported variant",
+			platform: "linux/386/v2",
+			fail:     true,
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			env, err := platformEnv(tests[idx].platform)
+			if err != nil && tests[idx].fail {
+				return
+			} else if err != nil {
+				t.Fatalf(err.Error())
+			} else if tests[idx].fail {
+				t.Fatalf("expected error, got %v", env)
+			}
+
+			if !reflect.DeepEqual(env, tests[idx].env) {
+				t.Fatalf("env no match: %v", env)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package image
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"dagger.io/dagger"
+)
+
+const (
+	// netrcPath is where the netrc is mounted in the builder. Both the go
+	// command, through NETRC, and git, which reads the home directory of the
+	// builder's root user, pick it up.
+	netrcPath = "/root/.netrc"
+
+	// NetrcSecretArg is the build arg of Dockerfile builds holding the ID of
+	// the netrc build secret, i.e.
+	// RUN --mount=type=secret,id=$NETRC_SECRET,target=/root/.netrc go build.
+	NetrcSecretArg = "NETRC_SECRET"
+)
+
+// PrivateModules gives builds access to private Go modules, without vendoring
+// them beforehand.
+type PrivateModules struct {
+	// Patterns are the module path patterns of the private modules, as in
+	// GOPRIVATE, e.g. "github.com/manzanit0/*". They skip the module proxy
+	// and the checksum database.
+	Patterns []string
+
+	// Credentials authenticate against the hosts serving the modules.
+	Credentials []Credential
+}
+
+// Credential is a login for a host, e.g. an installation token for
+// github.com with the "x-access-token" username.
+type Credential struct {
+	Host     string
+	Username string
+	Password string
+}
+
+// netrc renders the credentials in netrc format.
+func (p *PrivateModules) netrc() string {
+	var b strings.Builder
+	for _, c := range p.Credentials {
+		fmt.Fprintf(&b, "machine %s\nlogin %s\npassword %s\n", c.Host, c.Username, c.Password)
+	}
+
+	return b.String()
+}
+
+// netrcSecretName returns the name of the netrc secret. Secrets are shared by
+// the whole session, so the name is derived from the content for concurrent
+// builds with different credentials not to trample on each other.
+func (p *PrivateModules) netrcSecretName() string {
+	return fmt.Sprintf("netrc-%x", sha256.Sum256([]byte(p.netrc())))
+}
+
+// netrcSecret returns the netrc as a secret, named after its content.
+func (p *PrivateModules) netrcSecret(client *dagger.Client) *dagger.Secret {
+	return client.SetSecret(p.netrcSecretName(), p.netrc())
+}
+
+// withPrivateModules sets the builder up to fetch the private modules.
+func withPrivateModules(client *dagger.Client, builder *dagger.Container, p *PrivateModules) *dagger.Container {
+	if p == nil {
+		return builder
+	}
+
+	if len(p.Patterns) > 0 {
+		patterns := strings.Join(p.Patterns, ",")
+		builder = builder.
+			WithEnvVariable("GOPRIVATE", patterns).
+			WithEnvVariable("GONOSUMDB", patterns)
+	}
+
+	if len(p.Credentials) > 0 {
+		builder = builder.
+			WithMountedSecret(netrcPath, p.netrcSecret(client)).
+			WithEnvVariable("NETRC", netrcPath)
+	}
+
+	return builder
+}
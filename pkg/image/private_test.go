@@ -0,0 +1,19 @@
+package image
+
+import "testing"
+
+func TestPrivateModulesNetrc(t *testing.T) {
+	private := &PrivateModules{
+		Credentials: []Credential{
+			{Host: "github.com", Username: "x-access-token", Password: "ghs_token"},
+			{Host: "gitlab.example.com", Username: "deploy", Password: "secret"},
+		},
+	}
+
+	want := "machine github.com\nlogin x-access-token\npassword ghs_token\n" +
+		"machine gitlab.example.com\nlogin deploy\npassword secret\n"
+
+	if netrc := private.netrc(); netrc != want {
+		t.Fatalf("netrc no match:\n%s", netrc)
+	}
+}
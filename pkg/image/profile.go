@@ -0,0 +1,256 @@
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultBuilderImage = "golang:1.22"
+
+	RuntimeAlpine     = "alpine"
+	RuntimeDistroless = "distroless"
+	RuntimeScratch    = "scratch"
+
+	// HealthcheckLabel is the image label holding the healthcheck of the
+	// profile, since OCI image configs have no healthcheck of their own.
+	HealthcheckLabel = "dev.monocrat.healthcheck"
+)
+
+// runtimeImages are the images each runtime is based on. Distroless images
+// differ depending on whether the binary links against libc.
+var runtimeImages = map[string]string{
+	RuntimeAlpine:     "alpine:3.19",
+	RuntimeDistroless: "gcr.io/distroless/static-debian12",
+}
+
+const distrolessCGOImage = "gcr.io/distroless/base-debian12"
+
+// BuildProfile describes how an application is compiled and packaged. The zero
+// value builds a static binary with golang:1.22 onto alpine:3.19.
+type BuildProfile struct {
+	// BuilderImage is the image the binary is compiled in.
+	BuilderImage string `json:"builder_image,omitempty"`
+
+	// Runtime is the kind of image the binary is shipped in: alpine,
+	// distroless or scratch. Defaults to alpine.
+	Runtime string `json:"runtime,omitempty"`
+
+	// RuntimeImage overrides the image of the runtime, e.g. to pin a tag or
+	// use the nonroot distroless variant.
+	RuntimeImage string `json:"runtime_image,omitempty"`
+
+	// Tags are passed to the compiler as build tags.
+	Tags []string `json:"tags,omitempty"`
+
+	// LDFlags are passed to the linker, on top of the version stamp.
+	LDFlags string `json:"ldflags,omitempty"`
+
+	// Env are extra environment variables for the compiler.
+	Env map[string]string `json:"env,omitempty"`
+
+	// CGO enables cgo. Defaults to false, which produces static binaries.
+	CGO *bool `json:"cgo,omitempty"`
+
+	// Ports are exposed in the image config.
+	Ports []int `json:"ports,omitempty"`
+
+	// User the application runs as. Scratch images have no user database, so
+	// it needs to be a numeric UID there.
+	User string `json:"user,omitempty"`
+
+	Healthcheck *Healthcheck `json:"healthcheck,omitempty"`
+}
+
+// Healthcheck is the command to check whether the application is healthy.
+// Since the engine cannot set Docker's HEALTHCHECK, it is stored as JSON in
+// the HealthcheckLabel label for deployment tooling to pick up.
+type Healthcheck struct {
+	Command  []string `json:"command"`
+	Interval string   `json:"interval,omitempty"`
+	Timeout  string   `json:"timeout,omitempty"`
+	Retries  int      `json:"retries,omitempty"`
+}
+
+// Merge returns the profile with every field set in override replacing its
+// own. Env variables are merged key by key.
+func (p BuildProfile) Merge(override BuildProfile) BuildProfile {
+	merged := p
+
+	if override.BuilderImage != "" {
+		merged.BuilderImage = override.BuilderImage
+	}
+
+	if override.Runtime != "" {
+		merged.Runtime = override.Runtime
+		merged.RuntimeImage = ""
+	}
+
+	if override.RuntimeImage != "" {
+		merged.RuntimeImage = override.RuntimeImage
+	}
+
+	if override.Tags != nil {
+		merged.Tags = override.Tags
+	}
+
+	if override.LDFlags != "" {
+		merged.LDFlags = override.LDFlags
+	}
+
+	if override.Env != nil {
+		merged.Env = map[string]string{}
+		for k, v := range p.Env {
+			merged.Env[k] = v
+		}
+		for k, v := range override.Env {
+			merged.Env[k] = v
+		}
+	}
+
+	if override.CGO != nil {
+		merged.CGO = override.CGO
+	}
+
+	if override.Ports != nil {
+		merged.Ports = override.Ports
+	}
+
+	if override.User != "" {
+		merged.User = override.User
+	}
+
+	if override.Healthcheck != nil {
+		merged.Healthcheck = override.Healthcheck
+	}
+
+	return merged
+}
+
+// Validate checks that the profile can be built.
+func (p BuildProfile) Validate() error {
+	switch p.Runtime {
+	case "", RuntimeAlpine, RuntimeDistroless, RuntimeScratch:
+	default:
+		return fmt.Errorf("unknown runtime %q: expected alpine, distroless or scratch", p.Runtime)
+	}
+
+	if p.Runtime == RuntimeScratch && p.cgo() {
+		return fmt.Errorf("cgo binaries can't run on scratch: they need libc")
+	}
+
+	// cgo binaries only run against the libc they were linked with: glibc in
+	// the default builder and distroless, musl in alpine.
+	if p.cgo() && p.RuntimeImage == "" {
+		muslBuilder := strings.Contains(p.builderImage(), "alpine")
+		switch {
+		case (p.Runtime == "" || p.Runtime == RuntimeAlpine) && !muslBuilder:
+			return fmt.Errorf("cgo binaries built on %s link against glibc and can't run on alpine: use an alpine builder_image or the distroless runtime", p.builderImage())
+		case p.Runtime == RuntimeDistroless && muslBuilder:
+			return fmt.Errorf("cgo binaries built on %s link against musl and can't run on distroless: use a glibc builder_image or the alpine runtime", p.builderImage())
+		}
+	}
+
+	if p.Runtime == RuntimeScratch && p.User != "" {
+		if _, err := strconv.Atoi(strings.Split(p.User, ":")[0]); err != nil {
+			return fmt.Errorf("scratch images have no users: %q must be a numeric UID", p.User)
+		}
+	}
+
+	for _, port := range p.Ports {
+		if port <= 0 || port > 65535 {
+			return fmt.Errorf("invalid port %d", port)
+		}
+	}
+
+	if p.Healthcheck != nil && len(p.Healthcheck.Command) == 0 {
+		return fmt.Errorf("healthcheck without command")
+	}
+
+	return nil
+}
+
+// ValidatePlatforms checks that the profile can be built for the platforms on
+// an engine of its own platform: cgo binaries can't be cross-compiled without
+// a cross C toolchain, which the builder images don't have.
+func (p BuildProfile) ValidatePlatforms(engine string, platforms []string) error {
+	if !p.cgo() {
+		return nil
+	}
+
+	host, err := platformEnv(engine)
+	if err != nil {
+		return err
+	}
+
+	for _, platform := range platforms {
+		env, err := platformEnv(platform)
+		if err != nil {
+			return err
+		}
+
+		if env["GOOS"] != host["GOOS"] || env["GOARCH"] != host["GOARCH"] {
+			return fmt.Errorf("cgo binaries can't be cross-compiled for %s on %s", platform, engine)
+		}
+	}
+
+	return nil
+}
+
+func (p BuildProfile) cgo() bool {
+	return p.CGO != nil && *p.CGO
+}
+
+func (p BuildProfile) builderImage() string {
+	if p.BuilderImage != "" {
+		return p.BuilderImage
+	}
+
+	return DefaultBuilderImage
+}
+
+// runtimeImage returns the base image of the runtime, or an empty string for
+// scratch.
+func (p BuildProfile) runtimeImage() string {
+	if p.RuntimeImage != "" {
+		return p.RuntimeImage
+	}
+
+	switch p.Runtime {
+	case RuntimeScratch:
+		return ""
+	case RuntimeDistroless:
+		if p.cgo() {
+			return distrolessCGOImage
+		}
+		return runtimeImages[RuntimeDistroless]
+	default:
+		return runtimeImages[RuntimeAlpine]
+	}
+}
+
+// buildArgs returns the arguments to `go build` for the application.
+func (p BuildProfile) buildArgs(appVersion, appDirectory string) []string {
+	ldflags := fmt.Sprintf("-X main.version=%s", appVersion)
+	if p.LDFlags != "" {
+		ldflags = fmt.Sprintf("%s %s", ldflags, p.LDFlags)
+	}
+
+	args := []string{"go", "build", "-ldflags", ldflags}
+	if len(p.Tags) > 0 {
+		args = append(args, "-tags", strings.Join(p.Tags, ","))
+	}
+
+	return append(args, "-o", "app", appDirectory)
+}
+
+func (h *Healthcheck) label() (string, error) {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return "", fmt.Errorf("marshal healthcheck: %w", err)
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,217 @@
+package image
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildProfileMerge(t *testing.T) {
+	enabled := true
+
+	base := BuildProfile{
+		Runtime:      RuntimeDistroless,
+		RuntimeImage: "gcr.io/distroless/static-debian12:nonroot",
+		LDFlags:      "-s -w",
+		Env:          map[string]string{"GOFLAGS": "-mod=vendor", "GOEXPERIMENT": "loopvar"},
+		User:         "nonroot",
+	}
+
+	merged := base.Merge(BuildProfile{
+		Runtime: RuntimeAlpine,
+		Env:     map[string]string{"GOEXPERIMENT": "rangefunc"},
+		CGO:     &enabled,
+		Ports:   []int{8080},
+	})
+
+	want := BuildProfile{
+		Runtime: RuntimeAlpine,
+		LDFlags: "-s -w",
+		Env:     map[string]string{"GOFLAGS": "-mod=vendor", "GOEXPERIMENT": "rangefunc"},
+		CGO:     &enabled,
+		Ports:   []int{8080},
+		User:    "nonroot",
+	}
+
+	if !reflect.DeepEqual(merged, want) {
+		t.Fatalf("merged profile no match: %+v", merged)
+	}
+
+	if base.Env["GOEXPERIMENT"] != "loopvar" {
+		t.Fatalf("merge mutated the base profile: %+v", base.Env)
+	}
+}
+
+func TestBuildProfileValidate(t *testing.T) {
+	enabled := true
+
+	tests := []struct {
+		name    string
+		profile BuildProfile
+		fail    bool
+	}{
+		{
+			name:    "zero value",
+			profile: BuildProfile{},
+		},
+		{
+			name:    "scratch with numeric user",
+			profile: BuildProfile{Runtime: RuntimeScratch, User: "65532:65532"},
+		},
+		{
+			name:    "scratch with named user",
+			profile: BuildProfile{Runtime: RuntimeScratch, User: "nonroot"},
+			fail:    true,
+		},
+		{
+			name:    "scratch with cgo",
+			profile: BuildProfile{Runtime: RuntimeScratch, CGO: &enabled},
+			fail:    true,
+		},
+		{
+			name:    "alpine with cgo",
+			profile: BuildProfile{CGO: &enabled},
+			fail:    true,
+		},
+		{
+			name:    "alpine with cgo built on alpine",
+			profile: BuildProfile{CGO: &enabled, BuilderImage: "golang:1.22-alpine"},
+		},
+		{
+			name:    "alpine with cgo on a pinned runtime image",
+			profile: BuildProfile{CGO: &enabled, RuntimeImage: "debian:bookworm-slim"},
+		},
+		{
+			name:    "distroless with cgo",
+			profile: BuildProfile{Runtime: RuntimeDistroless, CGO: &enabled},
+		},
+		{
+			name:    "distroless with cgo built on alpine",
+			profile: BuildProfile{Runtime: RuntimeDistroless, CGO: &enabled, BuilderImage: "golang:1.22-alpine"},
+			fail:    true,
+		},
+		{
+			name:    "unknown runtime",
+			profile: BuildProfile{Runtime: "ubuntu"},
+			fail:    true,
+		},
+		{
+			name:    "invalid port",
+			profile: BuildProfile{Ports: []int{0}},
+			fail:    true,
+		},
+		{
+			name:    "healthcheck without command",
+			profile: BuildProfile{Healthcheck: &Healthcheck{Interval: "30s"}},
+			fail:    true,
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			err := tests[idx].profile.Validate()
+			if err != nil && !tests[idx].fail {
+				t.Fatalf(err.Error())
+			} else if err == nil && tests[idx].fail {
+				t.Fatalf("expected profile to be invalid")
+			}
+		})
+	}
+}
+
+func TestBuildProfileValidatePlatforms(t *testing.T) {
+	enabled := true
+
+	tests := []struct {
+		name      string
+		profile   BuildProfile
+		platforms []string
+		fail      bool
+	}{
+		{
+			name:      "static binary across architectures",
+			profile:   BuildProfile{},
+			platforms: []string{"linux/amd64", "linux/arm64"},
+		},
+		{
+			name:      "cgo on the engine platform",
+			profile:   BuildProfile{CGO: &enabled},
+			platforms: []string{"linux/amd64/v3"},
+		},
+		{
+			name:      "cgo across architectures",
+			profile:   BuildProfile{CGO: &enabled},
+			platforms: []string{"linux/amd64", "linux/arm64"},
+			fail:      true,
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			err := tests[idx].profile.ValidatePlatforms("linux/amd64", tests[idx].platforms)
+			if err != nil && !tests[idx].fail {
+				t.Fatalf(err.Error())
+			} else if err == nil && tests[idx].fail {
+				t.Fatalf("expected platforms to be invalid")
+			}
+		})
+	}
+}
+
+func TestBuildProfileImages(t *testing.T) {
+	enabled := true
+
+	tests := []struct {
+		name    string
+		profile BuildProfile
+		builder string
+		runtime string
+	}{
+		{
+			name:    "defaults",
+			profile: BuildProfile{},
+			builder: "golang:1.22",
+			runtime: "alpine:3.19",
+		},
+		{
+			name:    "static distroless",
+			profile: BuildProfile{Runtime: RuntimeDistroless, BuilderImage: "golang:1.22-bookworm"},
+			builder: "golang:1.22-bookworm",
+			runtime: "gcr.io/distroless/static-debian12",
+		},
+		{
+			name:    "cgo distroless",
+			profile: BuildProfile{Runtime: RuntimeDistroless, CGO: &enabled},
+			builder: "golang:1.22",
+			runtime: "gcr.io/distroless/base-debian12",
+		},
+		{
+			name:    "scratch has no base image",
+			profile: BuildProfile{Runtime: RuntimeScratch},
+			builder: "golang:1.22",
+			runtime: "",
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			if builder := tests[idx].profile.builderImage(); builder != tests[idx].builder {
+				t.Fatalf("builder image no match: %s", builder)
+			}
+
+			if runtime := tests[idx].profile.runtimeImage(); runtime != tests[idx].runtime {
+				t.Fatalf("runtime image no match: %s", runtime)
+			}
+		})
+	}
+}
+
+func TestBuildProfileBuildArgs(t *testing.T) {
+	profile := BuildProfile{Tags: []string{"netgo", "osusergo"}, LDFlags: "-s -w"}
+
+	args := profile.buildArgs("1.2.3", "./cmd/ci-check")
+	want := []string{"go", "build", "-ldflags", "-X main.version=1.2.3 -s -w", "-tags", "netgo,osusergo", "-o", "app", "./cmd/ci-check"}
+
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("build args no match: %v", args)
+	}
+}
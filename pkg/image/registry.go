@@ -0,0 +1,118 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/manzanit0/monocrat/pkg/oci"
+)
+
+const (
+	DockerHubAddress = "docker.io"
+	GHCRAddress      = "ghcr.io"
+
+	// ghcrUsername is the username GHCR expects when authenticating with a
+	// GitHub App installation token.
+	ghcrUsername = "x-access-token"
+)
+
+// Registry is a container registry images can be pushed to.
+type Registry struct {
+	// Address is the host of the registry, e.g. "docker.io", "ghcr.io" or
+	// "localhost:5000".
+	Address string
+
+	// Namespace is the path under which the image repositories live, e.g. the
+	// Docker Hub username or the GitHub organisation. It may be empty for
+	// registries which host repositories at their root.
+	Namespace string
+
+	// Auth holds the credentials to push to the registry. A zero value means
+	// anonymous access, which is only useful for local registries.
+	Auth Auth
+}
+
+// Auth are the credentials used to authenticate against a registry. Either
+// Username and Password or Token should be set.
+type Auth struct {
+	Username string
+	Password string
+
+	// Token is a bearer token. It is handed to the engine as an identity token,
+	// which is exchanged against the registry's token service on push.
+	Token string
+}
+
+// BasicAuth returns the credentials for a registry that accepts a username and
+// password.
+func BasicAuth(username, password string) Auth {
+	return Auth{Username: username, Password: password}
+}
+
+// BearerAuth returns the credentials for a registry that accepts bearer tokens.
+func BearerAuth(token string) Auth {
+	return Auth{Token: token}
+}
+
+// DockerHub returns the Docker Hub registry, pushing under the user's
+// namespace.
+func DockerHub(username, password string) Registry {
+	return Registry{
+		Address:   DockerHubAddress,
+		Namespace: username,
+		Auth:      BasicAuth(username, password),
+	}
+}
+
+// GHCR returns the GitHub Container Registry, authenticated with an
+// installation token of the GitHub App.
+func GHCR(namespace, installationToken string) Registry {
+	return Registry{
+		Address: GHCRAddress,
+		// GHCR rejects references with upper case characters, while GitHub
+		// logins are case-insensitive.
+		Namespace: strings.ToLower(namespace),
+		Auth:      BasicAuth(ghcrUsername, installationToken),
+	}
+}
+
+// OCI returns a generic OCI registry.
+func OCI(address, namespace string, auth Auth) Registry {
+	return Registry{Address: address, Namespace: namespace, Auth: auth}
+}
+
+// Ref returns the full reference of the image for the repository and tag
+// within the registry, e.g. "ghcr.io/manzanit0/monocrat-ci-check:1.2.3".
+func (r Registry) Ref(repository, tag string) string {
+	parts := []string{r.Address}
+	if r.Namespace != "" {
+		parts = append(parts, r.Namespace)
+	}
+	parts = append(parts, repository)
+
+	return fmt.Sprintf("%s:%s", strings.Join(parts, "/"), tag)
+}
+
+// IsAnonymous reports whether the registry has no credentials configured.
+func (r Registry) IsAnonymous() bool {
+	return r.Auth == Auth{}
+}
+
+// credentials returns the username and secret to hand to the engine. Bearer
+// tokens travel with an empty username so they are treated as identity tokens.
+func (a Auth) credentials() (string, string) {
+	if a.Token != "" {
+		return "", a.Token
+	}
+
+	return a.Username, a.Password
+}
+
+// client returns a client to talk to the registry's API directly.
+func (r Registry) client() *oci.Client {
+	return &oci.Client{
+		Username: r.Auth.Username,
+		Password: r.Auth.Password,
+		Token:    r.Auth.Token,
+	}
+}
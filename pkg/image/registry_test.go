@@ -0,0 +1,79 @@
+package image
+
+import (
+	"testing"
+)
+
+func TestRegistryRef(t *testing.T) {
+	tests := []struct {
+		name     string
+		registry Registry
+		ref      string
+	}{
+		{
+			name:     "docker hub",
+			registry: DockerHub("manzanit0", "password"),
+			ref:      "docker.io/manzanit0/monocrat-ci-check:1.2.3",
+		},
+		{
+			name:     "ghcr lowercases the namespace",
+			registry: GHCR("Manzanit0", "ghs_token"),
+			ref:      "ghcr.io/manzanit0/monocrat-ci-check:1.2.3",
+		},
+		{
+			name:     "registry without namespace",
+			registry: OCI("localhost:5000", "", Auth{}),
+			ref:      "localhost:5000/monocrat-ci-check:1.2.3",
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			ref := tests[idx].registry.Ref("monocrat-ci-check", "1.2.3")
+			if ref != tests[idx].ref {
+				t.Fatalf("ref no match: %s", ref)
+			}
+		})
+	}
+}
+
+func TestAuthCredentials(t *testing.T) {
+	tests := []struct {
+		name     string
+		auth     Auth
+		username string
+		secret   string
+	}{
+		{
+			name:     "basic auth",
+			auth:     BasicAuth("manzanit0", "password"),
+			username: "manzanit0",
+			secret:   "password",
+		},
+		{
+			name:     "bearer auth has no username",
+			auth:     BearerAuth("token"),
+			username: "",
+			secret:   "token",
+		},
+		{
+			name:     "ghcr authenticates as the installation",
+			auth:     GHCR("manzanit0", "ghs_token").Auth,
+			username: "x-access-token",
+			secret:   "ghs_token",
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			username, secret := tests[idx].auth.credentials()
+			if username != tests[idx].username {
+				t.Fatalf("username no match: %s", username)
+			}
+
+			if secret != tests[idx].secret {
+				t.Fatalf("secret no match: %s", secret)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/manzanit0/monocrat/pkg/attest"
+	"github.com/manzanit0/monocrat/pkg/vuln"
+)
+
+// ScanOptions enable checking the modules of the application's binary against
+// a vulnerability database before pushing the image.
+type ScanOptions struct {
+	DB *vuln.DB
+
+	// FailOn is the lowest severity that stops the image from being pushed.
+	// Findings below it are only reported. Zero never stops it.
+	FailOn vuln.Severity
+}
+
+// VulnerableError is returned when the application has vulnerabilities at or
+// above the severity to fail on. It holds all the findings, not just those.
+type VulnerableError struct {
+	Findings []vuln.Finding
+	FailOn   vuln.Severity
+}
+
+func (e *VulnerableError) Error() string {
+	failing := 0
+	for _, f := range e.Findings {
+		if f.Severity >= e.FailOn {
+			failing++
+		}
+	}
+
+	return fmt.Sprintf("found %d vulnerabilities of %s severity or above", failing, e.FailOn)
+}
+
+// scan returns the vulnerabilities of the binary, or a VulnerableError if any
+// of them is severe enough to fail on.
+func scan(ctx context.Context, opts *ScanOptions, info *debug.BuildInfo) ([]vuln.Finding, error) {
+	main, deps := attest.Modules(info)
+
+	findings, err := opts.DB.Scan(ctx, append([]attest.Module{main}, deps...))
+	if err != nil {
+		return nil, fmt.Errorf("scan for vulnerabilities: %w", err)
+	}
+
+	if opts.FailOn == 0 {
+		return findings, nil
+	}
+
+	for _, f := range findings {
+		if f.Severity >= opts.FailOn {
+			return findings, &VulnerableError{Findings: findings, FailOn: opts.FailOn}
+		}
+	}
+
+	return findings, nil
+}
@@ -0,0 +1,73 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+
+	"github.com/manzanit0/monocrat/pkg/vuln"
+)
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index/modules.json":   `[{"path":"golang.org/x/net","vulns":[{"id":"GO-2024-2687","fixed":"0.23.0"}]}]`,
+		"ID/GO-2024-2687.json": `{"id":"GO-2024-2687","summary":"HTTP/2 CONTINUATION flood in net/http","affected":[{"package":{"name":"golang.org/x/net","ecosystem":"Go"},"ranges":[{"type":"SEMVER","events":[{"introduced":"0"},{"fixed":"0.23.0"}]}]}],"database_specific":{"severity":"MODERATE"}}`,
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatalf("create database: %s", err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("create database: %s", err)
+		}
+	}
+
+	info := &debug.BuildInfo{
+		GoVersion: "go1.22.2",
+		Path:      "github.com/manzanit0/monocrat/cmd/ci-check",
+		Main:      debug.Module{Path: "github.com/manzanit0/monocrat", Version: "(devel)"},
+		Deps:      []*debug.Module{{Path: "golang.org/x/net", Version: "v0.17.0"}},
+	}
+
+	tests := []struct {
+		name   string
+		failOn vuln.Severity
+		fail   bool
+	}{
+		{
+			name:   "never fail",
+			failOn: 0,
+			fail:   false,
+		},
+		{
+			name:   "below the threshold",
+			failOn: vuln.SeverityHigh,
+			fail:   false,
+		},
+		{
+			name:   "at the threshold",
+			failOn: vuln.SeverityModerate,
+			fail:   true,
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			findings, err := scan(context.Background(), &ScanOptions{DB: &vuln.DB{URL: dir}, FailOn: tests[idx].failOn}, info)
+
+			var vulnerable *VulnerableError
+			if tests[idx].fail != errors.As(err, &vulnerable) {
+				t.Fatalf("expected failure %t, got %v", tests[idx].fail, err)
+			}
+
+			if len(findings) != 1 || findings[0].ID != "GO-2024-2687" {
+				t.Fatalf("findings no match: %+v", findings)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package joblog
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	store := &Store{Directory: t.TempDir()}
+
+	record, err := store.Create(Job{Name: "Lint", Repository: "manzanit0/monocrat", HeadSHA: "abc123"})
+	if err != nil {
+		t.Fatalf("create job: %s", err)
+	}
+
+	_, _ = record.Write([]byte("running golangci-lint\n"))
+
+	job, err := store.Job(record.ID())
+	if err != nil {
+		t.Fatalf("read job in progress: %s", err)
+	}
+
+	if job.CompletedAt != nil || job.Name != "Lint" {
+		t.Fatalf("job in progress no match: %+v", job)
+	}
+
+	err = record.Complete("failure", "Linter failed", []string{"unused variable"})
+	if err != nil {
+		t.Fatalf("complete job: %s", err)
+	}
+
+	// Late writes from the builds are dropped.
+	_, _ = record.Write([]byte("late\n"))
+
+	job, err = store.Job(record.ID())
+	if err != nil {
+		t.Fatalf("read job: %s", err)
+	}
+
+	if job.CompletedAt == nil || job.Conclusion != "failure" || string(job.Result) != `["unused variable"]` {
+		t.Fatalf("completed job no match: %+v", job)
+	}
+
+	logs, err := store.Log(record.ID())
+	if err != nil {
+		t.Fatalf("read log: %s", err)
+	}
+	defer logs.Close()
+
+	b, _ := io.ReadAll(logs)
+	if string(b) != "running golangci-lint\n" {
+		t.Fatalf("log no match: %q", b)
+	}
+
+	if _, err := store.Job("../../etc/passwd"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestStoreGC(t *testing.T) {
+	store := &Store{Directory: t.TempDir()}
+
+	var ids []string
+	for _, name := range []string{"Lint", "Release application"} {
+		record, err := store.Create(Job{Name: name, Repository: "manzanit0/monocrat", HeadSHA: "abc123"})
+		if err != nil {
+			t.Fatalf("create job: %s", err)
+		}
+
+		if err := record.Complete("success", "", nil); err != nil {
+			t.Fatalf("complete job: %s", err)
+		}
+		ids = append(ids, record.ID())
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	for _, ext := range []string{".json", ".log"} {
+		if err := os.Chtimes(filepath.Join(store.Directory, ids[0]+ext), old, old); err != nil {
+			t.Fatalf("age job: %s", err)
+		}
+	}
+
+	removed, err := store.GC(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatalf("gc: %s", err)
+	}
+
+	if removed != 1 {
+		t.Fatalf("removed no match: %d", removed)
+	}
+
+	if _, err := store.Job(ids[0]); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected expired job to be removed, got %v", err)
+	}
+
+	if _, err := store.Log(ids[0]); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected expired log to be removed, got %v", err)
+	}
+
+	if _, err := store.Job(ids[1]); err != nil {
+		t.Fatalf("read recent job: %s", err)
+	}
+}
+
+func TestSigner(t *testing.T) {
+	now := time.Now()
+	signer := &Signer{Key: []byte("secret"), TTL: time.Hour}
+	id := "0123456789abcdef0123456789abcdef"
+
+	link, err := url.Parse(signer.URL("https://monocrat.example.com", id, now))
+	if err != nil {
+		t.Fatalf("parse link: %s", err)
+	}
+
+	tampered := link.Query()
+	tampered.Set("expires", "9999999999")
+
+	tests := []struct {
+		name  string
+		id    string
+		query url.Values
+		now   time.Time
+		err   error
+	}{
+		{
+			name:  "valid link",
+			id:    id,
+			query: link.Query(),
+			now:   now,
+		},
+		{
+			name:  "expired link",
+			id:    id,
+			query: link.Query(),
+			now:   now.Add(2 * time.Hour),
+			err:   ErrExpired,
+		},
+		{
+			name:  "another job",
+			id:    "fedcba9876543210fedcba9876543210",
+			query: link.Query(),
+			now:   now,
+			err:   ErrInvalidSignature,
+		},
+		{
+			name:  "extended expiry",
+			id:    id,
+			query: tampered,
+			now:   now,
+			err:   ErrInvalidSignature,
+		},
+		{
+			name:  "unsigned",
+			id:    id,
+			query: url.Values{},
+			now:   now,
+			err:   ErrInvalidSignature,
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			err := signer.Verify(tests[idx].id, tests[idx].query, tests[idx].now)
+			if !errors.Is(err, tests[idx].err) {
+				t.Fatalf("error no match: %v", err)
+			}
+		})
+	}
+}
+
+func TestViewer(t *testing.T) {
+	store := &Store{Directory: t.TempDir()}
+	signer := &Signer{Key: []byte("secret")}
+	viewer := &Viewer{Store: store, Signer: signer}
+
+	record, err := store.Create(Job{Name: "Release ci-check", Repository: "manzanit0/monocrat", HeadSHA: "abc123"})
+	if err != nil {
+		t.Fatalf("create job: %s", err)
+	}
+
+	_, _ = record.Write([]byte("<pushed>\n"))
+	if err := record.Complete("success", "Released ci-check", nil); err != nil {
+		t.Fatalf("complete job: %s", err)
+	}
+
+	link, _ := url.Parse(signer.URL("", record.ID(), time.Now()))
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		body   string
+	}{
+		{
+			name:   "HTML",
+			target: link.String(),
+			status: http.StatusOK,
+			body:   "&lt;pushed&gt;",
+		},
+		{
+			name:   "JSON",
+			target: link.Path + ".json?" + link.RawQuery,
+			status: http.StatusOK,
+			body:   `"conclusion":"success"`,
+		},
+		{
+			name:   "unsigned",
+			target: link.Path,
+			status: http.StatusForbidden,
+			body:   ErrInvalidSignature.Error(),
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			viewer.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tests[idx].target, nil))
+
+			if w.Code != tests[idx].status {
+				t.Fatalf("status no match: %d", w.Code)
+			}
+
+			if !strings.Contains(w.Body.String(), tests[idx].body) {
+				t.Fatalf("body no match: %s", w.Body.String())
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	viewer.ServeHTTP(w, httptest.NewRequest(http.MethodGet, link.Path+".json?"+link.RawQuery, nil))
+
+	var page Page
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode page: %s", err)
+	}
+
+	if page.Log != "<pushed>\n" || page.Job.Name != "Release ci-check" {
+		t.Fatalf("page no match: %+v", page)
+	}
+}
@@ -0,0 +1,80 @@
+package joblog
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultTTL is how long links are valid for unless told otherwise.
+const DefaultTTL = 30 * 24 * time.Hour
+
+var (
+	// ErrInvalidSignature is returned for links which weren't signed with
+	// the key, or were tampered with.
+	ErrInvalidSignature = errors.New("invalid signature")
+
+	// ErrExpired is returned for links past their expiry.
+	ErrExpired = errors.New("link expired")
+)
+
+// Signer signs links to jobs, so that only those handed out, e.g. as the
+// details URL of a check run, are served.
+type Signer struct {
+	Key []byte
+
+	// TTL is how long links are valid for. Defaults to DefaultTTL.
+	TTL time.Duration
+}
+
+// URL returns the signed link to the page of the job, under the base URL of
+// the server.
+func (s *Signer) URL(baseURL, id string, now time.Time) string {
+	ttl := s.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+
+	expires := now.Add(ttl).Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", s.signature(id, expires))
+
+	return fmt.Sprintf("%s/jobs/%s?%s", baseURL, id, query.Encode())
+}
+
+// Verify checks the signature and expiry in the query of a link to the job.
+func (s *Signer) Verify(id string, query url.Values, now time.Time) error {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	signature, err := hex.DecodeString(query.Get("signature"))
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	want, _ := hex.DecodeString(s.signature(id, expires))
+	if !hmac.Equal(signature, want) {
+		return ErrInvalidSignature
+	}
+
+	if now.Unix() > expires {
+		return ErrExpired
+	}
+
+	return nil
+}
+
+func (s *Signer) signature(id string, expires int64) string {
+	mac := hmac.New(sha256.New, s.Key)
+	fmt.Fprintf(mac, "%s\n%d", id, expires)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
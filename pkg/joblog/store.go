@@ -0,0 +1,239 @@
+// Package joblog keeps the logs and results of CI jobs on disk and serves them
+// behind signed, expiring links, so they can be linked from check runs.
+package joblog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when the store has no such job.
+var ErrNotFound = errors.New("job not found")
+
+var idPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Job describes a job and, once completed, its outcome.
+type Job struct {
+	ID string `json:"id"`
+
+	// Name is the name of the check run of the job, e.g. "Lint".
+	Name string `json:"name"`
+
+	// Repository is the full name of the repository, e.g. "manzanit0/monocrat".
+	Repository string `json:"repository"`
+	HeadSHA    string `json:"head_sha"`
+
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
+	// Conclusion is that of the check run, e.g. "success" or "failure".
+	Conclusion string `json:"conclusion,omitempty"`
+	Summary    string `json:"summary,omitempty"`
+
+	// Result is whatever the job produced, e.g. the lint issues or the
+	// pushed images.
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// Store keeps every job as two files in a directory: <id>.json with the job
+// and <id>.log with its log.
+type Store struct {
+	Directory string
+}
+
+// Create starts keeping a job, assigning it an ID.
+func (s *Store) Create(job Job) (*Record, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("generate job ID: %w", err)
+	}
+
+	job.ID = hex.EncodeToString(b)
+	if job.StartedAt.IsZero() {
+		job.StartedAt = time.Now().UTC()
+	}
+
+	if err := s.save(&job); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(s.path(job.ID, ".log"))
+	if err != nil {
+		return nil, fmt.Errorf("create log: %w", err)
+	}
+
+	return &Record{store: s, job: job, log: f}, nil
+}
+
+// Job returns the job with the ID.
+func (s *Store) Job(id string) (*Job, error) {
+	if !idPattern.MatchString(id) {
+		return nil, ErrNotFound
+	}
+
+	b, err := os.ReadFile(s.path(id, ".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("read job: %w", err)
+	}
+
+	var job Job
+	if err := json.Unmarshal(b, &job); err != nil {
+		return nil, fmt.Errorf("decode job: %w", err)
+	}
+
+	return &job, nil
+}
+
+// Log returns the log of the job with the ID.
+func (s *Store) Log(id string) (io.ReadCloser, error) {
+	if !idPattern.MatchString(id) {
+		return nil, ErrNotFound
+	}
+
+	f, err := os.Open(s.path(id, ".log"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("open log: %w", err)
+	}
+
+	return f, nil
+}
+
+// GC removes the jobs, along with their logs, which were last written to
+// before the cutoff and returns how many it removed.
+func (s *Store) GC(before time.Time) (int, error) {
+	entries, err := os.ReadDir(s.Directory)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("list jobs: %w", err)
+	}
+
+	// A job is as recent as the latest of its files, so those in progress
+	// are kept while they write their log.
+	latest := map[string]time.Time{}
+	for _, entry := range entries {
+		id, _, _ := strings.Cut(entry.Name(), ".")
+		if !idPattern.MatchString(id) || !entry.Type().IsRegular() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		if info.ModTime().After(latest[id]) {
+			latest[id] = info.ModTime()
+		}
+	}
+
+	var errs []error
+	removed := 0
+	for id, modTime := range latest {
+		if !modTime.Before(before) {
+			continue
+		}
+
+		for _, ext := range []string{".json", ".json.tmp", ".log"} {
+			err := os.Remove(s.path(id, ext))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("remove job: %w", err))
+			}
+		}
+		removed++
+	}
+
+	return removed, errors.Join(errs...)
+}
+
+func (s *Store) save(job *Job) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("encode job: %w", err)
+	}
+
+	// Written aside and renamed, so the job is never read half written.
+	tmp := s.path(job.ID, ".json.tmp")
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("write job: %w", err)
+	}
+
+	if err := os.Rename(tmp, s.path(job.ID, ".json")); err != nil {
+		return fmt.Errorf("write job: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) path(id, ext string) string {
+	return filepath.Join(s.Directory, id+ext)
+}
+
+// Record is a job in progress. Its log is written to it until it's completed.
+// It is safe for concurrent use.
+type Record struct {
+	store *Store
+
+	mu  sync.Mutex
+	job Job
+	log *os.File
+}
+
+// ID is the ID of the job.
+func (r *Record) ID() string {
+	return r.job.ID
+}
+
+// Write appends to the log. Writes after completion are dropped.
+func (r *Record) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.log == nil {
+		return len(p), nil
+	}
+
+	return r.log.Write(p)
+}
+
+// Complete closes the log and saves the outcome of the job.
+func (r *Record) Complete(conclusion, summary string, result any) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.log != nil {
+		if err := r.log.Close(); err != nil {
+			return fmt.Errorf("close log: %w", err)
+		}
+		r.log = nil
+	}
+
+	completedAt := time.Now().UTC()
+	r.job.CompletedAt = &completedAt
+	r.job.Conclusion = conclusion
+	r.job.Summary = summary
+
+	if result != nil {
+		b, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("encode result: %w", err)
+		}
+		r.job.Result = b
+	}
+
+	return r.store.save(&r.job)
+}
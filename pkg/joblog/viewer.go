@@ -0,0 +1,126 @@
+package joblog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+var page = template.Must(template.New("job").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Job.Name}} · {{.Job.Repository}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+pre { background: #f6f8fa; padding: 1em; overflow-x: auto; }
+dt { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{.Job.Name}}</h1>
+<dl>
+<dt>Repository</dt><dd>{{.Job.Repository}}</dd>
+<dt>Commit</dt><dd><code>{{.Job.HeadSHA}}</code></dd>
+<dt>Started</dt><dd>{{.Job.StartedAt.Format "2006-01-02 15:04:05 MST"}}</dd>
+{{- if .Job.CompletedAt}}
+<dt>Completed</dt><dd>{{.Job.CompletedAt.Format "2006-01-02 15:04:05 MST"}}</dd>
+<dt>Conclusion</dt><dd>{{.Job.Conclusion}}</dd>
+{{- else}}
+<dt>Status</dt><dd>in progress</dd>
+{{- end}}
+</dl>
+{{- if .Job.Summary}}
+<h2>Summary</h2>
+<pre>{{.Job.Summary}}</pre>
+{{- end}}
+{{- if .Result}}
+<h2>Result</h2>
+<pre>{{.Result}}</pre>
+{{- end}}
+<h2>Log</h2>
+<pre>{{.Log}}</pre>
+<p><a href="{{.JSONURL}}">JSON</a></p>
+</body>
+</html>
+`))
+
+// Viewer serves the jobs of the store at /jobs/<id> as HTML, and at
+// /jobs/<id>.json as JSON, to signed links only.
+type Viewer struct {
+	Store  *Store
+	Signer *Signer
+}
+
+// Page is a job along with its log, as served in JSON.
+type Page struct {
+	Job *Job   `json:"job"`
+	Log string `json:"log"`
+}
+
+func (v *Viewer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, asJSON := strings.CutSuffix(path.Base(r.URL.Path), ".json")
+
+	if err := v.Signer.Verify(id, r.URL.Query(), time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	job, err := v.Store.Job(id)
+	if errors.Is(err, ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Println("[error] reading job:", err)
+		http.Error(w, "failed to read job", http.StatusInternalServerError)
+		return
+	}
+
+	logs, err := v.Store.Log(id)
+	if err != nil {
+		log.Println("[error] reading job log:", err)
+		http.Error(w, "failed to read job log", http.StatusInternalServerError)
+		return
+	}
+	defer logs.Close()
+
+	b, err := io.ReadAll(logs)
+	if err != nil {
+		log.Println("[error] reading job log:", err)
+		http.Error(w, "failed to read job log", http.StatusInternalServerError)
+		return
+	}
+
+	if asJSON {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(Page{Job: job, Log: string(b)}); err != nil {
+			log.Println("[error] writing job:", err)
+		}
+		return
+	}
+
+	var result bytes.Buffer
+	if len(job.Result) > 0 {
+		if err := json.Indent(&result, job.Result, "", "  "); err != nil {
+			result.Write(job.Result)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = page.Execute(w, map[string]any{
+		"Job":     job,
+		"Result":  result.String(),
+		"Log":     string(b),
+		"JSONURL": template.URL(id + ".json?" + r.URL.RawQuery),
+	})
+	if err != nil {
+		log.Println("[error] writing job:", err)
+	}
+}
@@ -1,10 +1,12 @@
 package lint
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"go/build"
+	"io"
 	"os/exec"
 	"path/filepath"
 	"strings"
@@ -39,7 +41,9 @@ type Report struct {
 	} `json:"Linters,omitempty"`
 }
 
-func Lint(ctx context.Context, repositoryDirectory string) (*Result, error) {
+// Lint runs golangci-lint on the directory. Its own logs, as opposed to the
+// report, are copied to w if not nil.
+func Lint(ctx context.Context, repositoryDirectory string, w io.Writer) (*Result, error) {
 	_, err := installMissing("golangci-lint", "github.com/golangci/golangci-lint", "github.com/golangci/golangci-lint/cmd/golangci-lint@v1.58.0")
 	if err != nil {
 		return nil, fmt.Errorf("install golangci-lint: %w", err)
@@ -50,16 +54,25 @@ func Lint(ctx context.Context, repositoryDirectory string) (*Result, error) {
 		"run",
 		"--skip-dirs", "opt/homebrew,go/pkg",
 		"--out-format", "json",
-		"--issues-exit-code", "42")
+		"--issues-exit-code", "42",
+		"--verbose")
 	cmd.Dir = repositoryDirectory
-	b, err := cmd.CombinedOutput()
+
+	// The report goes to stdout and the logs to stderr.
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if w != nil {
+		cmd.Stderr = io.MultiWriter(&stderr, w)
+	}
+	err = cmd.Run()
 
 	if err != nil && !strings.HasPrefix(err.Error(), "exit status 42") {
-		return nil, fmt.Errorf("%s: %s", err.Error(), string(b))
+		return nil, fmt.Errorf("%s: %s%s", err.Error(), stdout.String(), stderr.String())
 	}
 
 	var result Result
-	err = json.Unmarshal(b, &result)
+	err = json.Unmarshal(stdout.Bytes(), &result)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,171 @@
+// Package monorepo finds the Go modules and runnable applications of a
+// repository, and which of them changes call to rebuild.
+package monorepo
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Application is a runnable application within the repository.
+type Application struct {
+	Name string `json:"name"`
+
+	// Directory is relative to the root of the repository.
+	Directory string `json:"directory"`
+}
+
+// ImageRepository returns the repository the images of the application are
+// pushed to, within the namespace of a registry.
+func (a Application) ImageRepository() string {
+	return fmt.Sprintf("monocrat-%s", a.Name)
+}
+
+// ChangedApplications returns the applications affected by the changed files,
+// sorted by name, along with the directories of the modules they belong to.
+// Changed files are absolute paths within the repository.
+func ChangedApplications(repositoryPath string, changedFiles []string) ([]Application, []string, error) {
+	// Let's find All the Go modules and runnable applications in the
+	// cloned repository.
+	modules, applications, err := FindGoModules(repositoryPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("find Go modules and runnable apps: %w", err)
+	}
+
+	// Now that we have (1) changed files, (2) Go modules and (3) runnable
+	// applications, we can just cross-check the data to find out all the
+	// applications that need rebuilding based on if the changed file happened
+	// in a module with runnable applications.
+	// We'd want to rebuild all the apps in a module with a change.
+	appsToRebuild, modulesToVendor := GetAppsToRebuild(changedFiles, modules, applications)
+
+	var apps []Application
+	for app := range appsToRebuild {
+		appName, appRelativeDirectory := GetAppNameAndDirectory(repositoryPath, app)
+		apps = append(apps, Application{Name: appName, Directory: appRelativeDirectory})
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].Name < apps[j].Name })
+
+	moduleDirectories := make([]string, 0, len(modulesToVendor))
+	for moduleDirectory := range modulesToVendor {
+		moduleDirectories = append(moduleDirectories, moduleDirectory)
+	}
+	sort.Strings(moduleDirectories)
+
+	return apps, moduleDirectories, nil
+}
+
+// FindApplication finds the runnable application by name, changed or not.
+func FindApplication(repositoryPath, name string) (Application, error) {
+	_, applications, err := FindGoModules(repositoryPath)
+	if err != nil {
+		return Application{}, fmt.Errorf("find Go modules and runnable apps: %w", err)
+	}
+
+	for _, app := range applications {
+		appName, appRelativeDirectory := GetAppNameAndDirectory(repositoryPath, app)
+		if appName == name {
+			return Application{Name: appName, Directory: appRelativeDirectory}, nil
+		}
+	}
+
+	return Application{}, fmt.Errorf("application %s not found", name)
+}
+
+// ModuleDirectories returns the directories of the Go modules among the files
+// of a repository, relative to its root and sorted, e.g. to check out only
+// those. It returns none when a module sits at the root, as it spans the whole
+// repository.
+func ModuleDirectories(files []string) []string {
+	var directories []string
+	for _, file := range files {
+		if filepath.Base(file) != "go.mod" {
+			continue
+		}
+
+		directory := filepath.Dir(file)
+		if directory == "." {
+			return nil
+		}
+		directories = append(directories, directory)
+	}
+	sort.Strings(directories)
+
+	return directories
+}
+
+// FindGoModules returns the go.mod and main.go files within the repository,
+// as absolute paths when the repository path is.
+func FindGoModules(repositoryPath string) (modules []string, applications []string, err error) {
+	err = filepath.WalkDir(repositoryPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("checking directory entry: %w", err)
+		}
+
+		// Worktrees have a .git file rather than a directory, which skipping
+		// would skip the rest of the directory.
+		if d.IsDir() && (d.Name() == ".git" || d.Name() == ".github") {
+			return filepath.SkipDir
+		}
+
+		if !d.IsDir() && d.Name() == "go.mod" {
+			modules = append(modules, path)
+			return nil
+		}
+
+		if !d.IsDir() && d.Name() == "main.go" {
+			applications = append(applications, path)
+			return nil
+		}
+
+		return nil
+	})
+	return
+}
+
+// GetAppsToRebuild cross-checks the files changed, the available Go modules and
+// applications and computes which modules to vendor and which applications to
+// compile based on the changes.
+//
+// Modules and applications should be of the form "/foo/bar/go.mod" and
+// "/foo/bar/main.go", thus being references to the actual files, not the
+// directories.
+func GetAppsToRebuild(changedFiles []string, modules []string, applications []string) (map[string]interface{}, map[string]interface{}) {
+	appsToRebuild := map[string]interface{}{}
+	modulesToVendor := map[string]interface{}{}
+
+	for _, module := range modules {
+		moduleDir := filepath.Dir(module)
+		for _, app := range applications {
+			if strings.Contains(app, moduleDir) {
+				for _, change := range changedFiles {
+					if strings.Contains(change, moduleDir) {
+						modulesToVendor[moduleDir] = nil
+						appsToRebuild[app] = nil
+					}
+				}
+			}
+		}
+	}
+
+	return appsToRebuild, modulesToVendor
+}
+
+// GetAppNameAndDirectory extracts the application's directory relative to the
+// repository and the application's name. It assumes that the application's name
+// is the directory just above the main.go file.
+//
+// Both repositoryPath and appPath are expected to be absolute paths, appPath
+// being the path to the main.go file.
+func GetAppNameAndDirectory(repositoryPath, appPath string) (string, string) {
+	separator := fmt.Sprintf("%c", filepath.Separator)
+	split := strings.Split(appPath, separator)
+	appName := split[len(split)-2 : len(split)-1][0]
+	appName = strings.ReplaceAll(appName, "_", "-")
+	appRelativeDirectory := strings.Split(appPath, repositoryPath)[1]
+	appRelativeDirectory = strings.TrimPrefix(appRelativeDirectory, separator)
+	return appName, appRelativeDirectory
+}
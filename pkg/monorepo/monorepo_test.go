@@ -0,0 +1,139 @@
+package monorepo
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newRepository lays out the files in a new directory, returning its path.
+func newRepository(t *testing.T, files ...string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("create directory: %s", err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatalf("write file: %s", err)
+		}
+	}
+
+	return dir
+}
+
+func TestChangedApplications(t *testing.T) {
+	repository := newRepository(t,
+		// As in worktrees.
+		".git",
+		"api/go.mod",
+		"api/cmd/api/main.go",
+		"api/cmd/api_worker/main.go",
+		"api/internal/store.go",
+		"web/go.mod",
+		"web/cmd/web/main.go",
+		"lib/go.mod",
+		"lib/lib.go",
+		".github/workflows/ci/main.go",
+	)
+
+	tests := []struct {
+		name    string
+		changed []string
+		apps    []Application
+		modules []string
+	}{
+		{
+			name:    "module with applications",
+			changed: []string{"api/internal/store.go"},
+			apps: []Application{
+				{Name: "api", Directory: "api/cmd/api/main.go"},
+				{Name: "api-worker", Directory: "api/cmd/api_worker/main.go"},
+			},
+			modules: []string{filepath.Join(repository, "api")},
+		},
+		{
+			name:    "module without applications",
+			changed: []string{"lib/lib.go"},
+			modules: []string{},
+		},
+		{
+			name:    "outside of modules",
+			changed: []string{"README.md"},
+			modules: []string{},
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			var changed []string
+			for _, file := range tests[idx].changed {
+				changed = append(changed, filepath.Join(repository, file))
+			}
+
+			apps, modules, err := ChangedApplications(repository, changed)
+			if err != nil {
+				t.Fatalf("changed applications: %s", err)
+			}
+
+			if !reflect.DeepEqual(apps, tests[idx].apps) {
+				t.Fatalf("apps no match: %v", apps)
+			}
+
+			if !reflect.DeepEqual(modules, tests[idx].modules) {
+				t.Fatalf("modules no match: %v", modules)
+			}
+		})
+	}
+}
+
+func TestFindApplication(t *testing.T) {
+	repository := newRepository(t, "api/go.mod", "api/cmd/api_worker/main.go")
+
+	app, err := FindApplication(repository, "api-worker")
+	if err != nil {
+		t.Fatalf("find application: %s", err)
+	}
+
+	if app.Directory != "api/cmd/api_worker/main.go" || app.ImageRepository() != "monocrat-api-worker" {
+		t.Fatalf("application no match: %+v", app)
+	}
+
+	if _, err := FindApplication(repository, "web"); err == nil {
+		t.Fatalf("expected an error for an unknown application")
+	}
+}
+
+func TestModuleDirectories(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       []string
+		directories []string
+	}{
+		{
+			name:        "modules in directories",
+			files:       []string{"go.work", "worker/go.mod", "worker/main.go", "api/go.mod", "api/cmd/api/main.go", "docs/index.md"},
+			directories: []string{"api", "worker"},
+		},
+		{
+			name:  "module at the root",
+			files: []string{"go.mod", "cmd/api/main.go", "tools/go.mod"},
+		},
+		{
+			name:  "no modules",
+			files: []string{"README.md"},
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			directories := ModuleDirectories(tests[idx].files)
+			if !reflect.DeepEqual(directories, tests[idx].directories) {
+				t.Fatalf("directories no match: %v", directories)
+			}
+		})
+	}
+}
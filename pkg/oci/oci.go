@@ -0,0 +1,437 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	MediaTypeImageIndex    = "application/vnd.oci.image.index.v1+json"
+	MediaTypeImageManifest = "application/vnd.oci.image.manifest.v1+json"
+
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// manifestMediaTypes are all the manifest media types the client accepts when
+// fetching manifests.
+var manifestMediaTypes = []string{
+	MediaTypeImageIndex,
+	MediaTypeImageManifest,
+	MediaTypeDockerManifestList,
+	MediaTypeDockerManifest,
+}
+
+// Descriptor describes the content of a blob or manifest.
+// https://github.com/opencontainers/image-spec/blob/main/descriptor.md
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Platform     *Platform         `json:"platform,omitempty"`
+}
+
+// Platform is the platform a manifest within an index runs on.
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (p Platform) String() string {
+	if p.Variant != "" {
+		return fmt.Sprintf("%s/%s/%s", p.OS, p.Architecture, p.Variant)
+	}
+
+	return fmt.Sprintf("%s/%s", p.OS, p.Architecture)
+}
+
+// Index is an OCI image index, or a Docker manifest list.
+// https://github.com/opencontainers/image-spec/blob/main/image-index.md
+type Index struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Manifests     []Descriptor      `json:"manifests"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// Manifest is an OCI image manifest.
+// https://github.com/opencontainers/image-spec/blob/main/manifest.md
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// Reference is a parsed image reference, e.g.
+// "ghcr.io/manzanit0/monocrat-ci-check:1.2.3" or
+// "localhost:5000/monocrat-ci-check@sha256:...".
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses a fully qualified image reference. References without
+// a registry host are not supported since they are ambiguous.
+func ParseReference(ref string) (Reference, error) {
+	host, rest, ok := strings.Cut(ref, "/")
+	if !ok || rest == "" {
+		return Reference{}, fmt.Errorf("invalid reference %q: missing repository", ref)
+	}
+
+	var r Reference
+	r.Registry = host
+
+	if name, digest, ok := strings.Cut(rest, "@"); ok {
+		r.Digest = digest
+		rest = name
+	}
+
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		r.Tag = rest[i+1:]
+		rest = rest[:i]
+	}
+
+	r.Repository = rest
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+
+	return r, nil
+}
+
+// Identifier returns the digest of the reference if present, or the tag
+// otherwise.
+func (r Reference) Identifier() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+
+	return r.Tag
+}
+
+func (r Reference) String() string {
+	s := fmt.Sprintf("%s/%s", r.Registry, r.Repository)
+	if r.Tag != "" {
+		s = fmt.Sprintf("%s:%s", s, r.Tag)
+	}
+
+	if r.Digest != "" {
+		s = fmt.Sprintf("%s@%s", s, r.Digest)
+	}
+
+	return s
+}
+
+// Client speaks the OCI distribution API to a single registry.
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md
+type Client struct {
+	HTTPClient *http.Client
+
+	// Username and Password are used for basic auth, or to request tokens
+	// from the registry's token service. Token is sent as a bearer token
+	// as-is.
+	Username string
+	Password string
+	Token    string
+
+	// PlainHTTP talks to the registry without TLS. It is always the case for
+	// loopback registries.
+	PlainHTTP bool
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// Digest returns the sha256 digest of the content, e.g. "sha256:4f2a...".
+func Digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+
+	return http.DefaultClient
+}
+
+func (c *Client) baseURL(registry string) string {
+	// Docker Hub references use a different host than its API.
+	if registry == "docker.io" {
+		registry = "registry-1.docker.io"
+	}
+
+	host := strings.Split(registry, ":")[0]
+	if c.PlainHTTP || host == "localhost" || host == "127.0.0.1" {
+		return "http://" + registry
+	}
+
+	return "https://" + registry
+}
+
+// Resolve returns the descriptor of the manifest the reference points to.
+func (c *Client) Resolve(ctx context.Context, ref Reference) (Descriptor, error) {
+	url := fmt.Sprintf("%s/v2/%s/manifests/%s", c.baseURL(ref.Registry), ref.Repository, ref.Identifier())
+	res, err := c.do(ctx, ref, http.MethodHead, url, nil, map[string]string{"Accept": strings.Join(manifestMediaTypes, ", ")})
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return Descriptor{}, fmt.Errorf("resolve %s: %w", ref, toErr(res))
+	}
+
+	size, _ := strconv.ParseInt(res.Header.Get("Content-Length"), 10, 64)
+	return Descriptor{
+		MediaType: res.Header.Get("Content-Type"),
+		Digest:    res.Header.Get("Docker-Content-Digest"),
+		Size:      size,
+	}, nil
+}
+
+// Manifest fetches the raw manifest the reference points to, alongside its
+// descriptor.
+func (c *Client) Manifest(ctx context.Context, ref Reference) ([]byte, Descriptor, error) {
+	url := fmt.Sprintf("%s/v2/%s/manifests/%s", c.baseURL(ref.Registry), ref.Repository, ref.Identifier())
+	res, err := c.do(ctx, ref, http.MethodGet, url, nil, map[string]string{"Accept": strings.Join(manifestMediaTypes, ", ")})
+	if err != nil {
+		return nil, Descriptor{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, Descriptor{}, fmt.Errorf("get manifest %s: %w", ref, toErr(res))
+	}
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, Descriptor{}, fmt.Errorf("read manifest: %w", err)
+	}
+
+	desc := Descriptor{
+		MediaType: res.Header.Get("Content-Type"),
+		Digest:    res.Header.Get("Docker-Content-Digest"),
+		Size:      int64(len(b)),
+	}
+	if desc.Digest == "" {
+		desc.Digest = Digest(b)
+	}
+
+	return b, desc, nil
+}
+
+// Index fetches the image index the reference points to. When the reference
+// points to a single manifest instead, an index with just that manifest is
+// returned so that callers don't need to care about the difference.
+func (c *Client) Index(ctx context.Context, ref Reference) (*Index, error) {
+	b, desc, err := c.Manifest(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	switch desc.MediaType {
+	case MediaTypeImageIndex, MediaTypeDockerManifestList:
+		var index Index
+		if err := json.Unmarshal(b, &index); err != nil {
+			return nil, fmt.Errorf("unmarshal index: %w", err)
+		}
+
+		return &index, nil
+
+	case MediaTypeImageManifest, MediaTypeDockerManifest:
+		return &Index{SchemaVersion: 2, MediaType: MediaTypeImageIndex, Manifests: []Descriptor{desc}}, nil
+
+	default:
+		return nil, fmt.Errorf("unexpected media type %q", desc.MediaType)
+	}
+}
+
+// do sends a request to the registry, authenticating against its token service
+// if it challenges the client for a bearer token.
+func (c *Client) do(ctx context.Context, ref Reference, method, url string, body []byte, headers map[string]string) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		var r io.Reader
+		if body != nil {
+			r = bytes.NewReader(body)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, url, r)
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		c.mu.Lock()
+		token := c.tokens[ref.Repository]
+		c.mu.Unlock()
+
+		switch {
+		case c.Token != "":
+			req.Header.Set("Authorization", "Bearer "+c.Token)
+		case token != "":
+			req.Header.Set("Authorization", "Bearer "+token)
+		case c.Username != "":
+			req.SetBasicAuth(c.Username, c.Password)
+		}
+
+		return c.httpClient().Do(req)
+	}
+
+	res, err := send()
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusUnauthorized || c.Token != "" {
+		return res, nil
+	}
+
+	challenge := res.Header.Get("WWW-Authenticate")
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return res, nil
+	}
+	res.Body.Close()
+
+	token, err := c.fetchToken(ctx, challenge)
+	if err != nil {
+		return nil, fmt.Errorf("authenticate against %s: %w", ref.Registry, err)
+	}
+
+	c.mu.Lock()
+	if c.tokens == nil {
+		c.tokens = map[string]string{}
+	}
+	c.tokens[ref.Repository] = token
+	c.mu.Unlock()
+
+	return send()
+}
+
+// fetchToken requests a token from the realm of a bearer challenge.
+// https://distribution.github.io/distribution/spec/auth/token/
+func (c *Client) fetchToken(ctx context.Context, challenge string) (string, error) {
+	params := parseChallenge(challenge)
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("challenge without realm: %s", challenge)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm, nil)
+	if err != nil {
+		return "", fmt.Errorf("create token request: %w", err)
+	}
+
+	q := req.URL.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			q.Set(key, params[key])
+		}
+	}
+	req.URL.RawQuery = q.Encode()
+
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request token: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("request token: %w", toErr(res))
+	}
+
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&tokenResponse); err != nil {
+		return "", fmt.Errorf("unmarshal token: %w", err)
+	}
+
+	if tokenResponse.Token != "" {
+		return tokenResponse.Token, nil
+	}
+
+	return tokenResponse.AccessToken, nil
+}
+
+// parseChallenge parses the parameters of a WWW-Authenticate header such as
+// `Bearer realm="https://ghcr.io/token",service="ghcr.io",scope="repository:foo:pull"`.
+func parseChallenge(challenge string) map[string]string {
+	params := map[string]string{}
+
+	_, rest, _ := strings.Cut(challenge, " ")
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, ", "), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+
+		params[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+
+	return params
+}
+
+// ErrNotFound is returned when the registry doesn't have the requested
+// manifest or blob.
+var ErrNotFound = errors.New("not found")
+
+func toErr(res *http.Response) error {
+	var errResp struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+
+	var messages []string
+	b, _ := io.ReadAll(res.Body)
+	if err := json.Unmarshal(b, &errResp); err == nil {
+		for _, e := range errResp.Errors {
+			messages = append(messages, fmt.Sprintf("%s: %s", e.Code, e.Message))
+		}
+	}
+
+	err := fmt.Errorf("unexpected status %d", res.StatusCode)
+	if res.StatusCode == http.StatusNotFound {
+		err = fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	if len(messages) == 0 {
+		return err
+	}
+
+	return fmt.Errorf("%w: %s", err, strings.Join(messages, "; "))
+}
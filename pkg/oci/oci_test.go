@@ -0,0 +1,120 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		name string
+		ref  string
+		want Reference
+		fail bool
+	}{
+		{
+			name: "tag",
+			ref:  "ghcr.io/manzanit0/monocrat-ci-check:1.2.3",
+			want: Reference{Registry: "ghcr.io", Repository: "manzanit0/monocrat-ci-check", Tag: "1.2.3"},
+		},
+		{
+			name: "registry with port and digest",
+			ref:  "localhost:5000/monocrat-ci-check@sha256:abc",
+			want: Reference{Registry: "localhost:5000", Repository: "monocrat-ci-check", Digest: "sha256:abc"},
+		},
+		{
+			name: "tag and digest",
+			ref:  "docker.io/manzanit0/monocrat:1.2.3@sha256:abc",
+			want: Reference{Registry: "docker.io", Repository: "manzanit0/monocrat", Tag: "1.2.3", Digest: "sha256:abc"},
+		},
+		{
+			name: "defaults to latest",
+			ref:  "localhost:5000/monocrat",
+			want: Reference{Registry: "localhost:5000", Repository: "monocrat", Tag: "latest"},
+		},
+		{
+			name: "missing registry",
+			ref:  "monocrat",
+			fail: true,
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			ref, err := ParseReference(tests[idx].ref)
+			if err != nil && tests[idx].fail {
+				return
+			} else if err != nil {
+				t.Fatalf(err.Error())
+			}
+
+			if ref != tests[idx].want {
+				t.Fatalf("reference no match: %+v", ref)
+			}
+		})
+	}
+}
+
+func TestIndexWithTokenAuth(t *testing.T) {
+	index := Index{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageIndex,
+		Manifests: []Descriptor{
+			{MediaType: MediaTypeImageManifest, Digest: "sha256:amd64", Platform: &Platform{OS: "linux", Architecture: "amd64"}},
+			{MediaType: MediaTypeImageManifest, Digest: "sha256:arm64", Platform: &Platform{OS: "linux", Architecture: "arm64"}},
+		},
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			if user, pass, _ := r.BasicAuth(); user != "manzanit0" || pass != "password" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			if r.URL.Query().Get("scope") != "repository:monocrat:pull" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": "t0k3n"})
+
+		case r.Header.Get("Authorization") != "Bearer t0k3n":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry",scope="repository:monocrat:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+
+		case r.URL.Path == "/v2/monocrat/manifests/1.2.3":
+			w.Header().Set("Content-Type", MediaTypeImageIndex)
+			_ = json.NewEncoder(w).Encode(index)
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &Client{Username: "manzanit0", Password: "password", PlainHTTP: true}
+	ref, err := ParseReference(strings.TrimPrefix(server.URL, "http://") + "/monocrat:1.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.Index(context.Background(), ref)
+	if err != nil {
+		t.Fatalf("index: %s", err)
+	}
+
+	if len(got.Manifests) != 2 {
+		t.Fatalf("expected 2 manifests, got %d", len(got.Manifests))
+	}
+
+	if got.Manifests[1].Platform.String() != "linux/arm64" {
+		t.Fatalf("platform no match: %s", got.Manifests[1].Platform)
+	}
+}
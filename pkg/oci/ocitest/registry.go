@@ -0,0 +1,257 @@
+// Package ocitest provides an in-memory stand-in for an OCI registry, such as
+// registry:2, to test against without Docker.
+package ocitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/manzanit0/monocrat/pkg/oci"
+)
+
+// Registry serves the subset of the OCI distribution API the oci package
+// uses: blobs, monolithic uploads, manifests and, optionally, referrers.
+type Registry struct {
+	Server *httptest.Server
+
+	// ReferrersAPI makes the registry process the subject of manifests and
+	// serve the referrers API. Like registry:2, it doesn't by default.
+	ReferrersAPI bool
+
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string]manifest
+	tags      map[string]string
+	uploads   int
+}
+
+type manifest struct {
+	mediaType string
+	content   []byte
+}
+
+// NewRegistry starts a registry. It is closed when the test finishes.
+func NewRegistry(t interface{ Cleanup(func()) }) *Registry {
+	r := &Registry{
+		blobs:     map[string][]byte{},
+		manifests: map[string]manifest{},
+		tags:      map[string]string{},
+	}
+
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.Server.Close)
+
+	return r
+}
+
+// Address returns the host and port of the registry, e.g. "127.0.0.1:41234".
+func (r *Registry) Address() string {
+	return strings.TrimPrefix(r.Server.URL, "http://")
+}
+
+// Manifest returns the raw manifest stored under a tag or digest, and whether
+// it exists.
+func (r *Registry) Manifest(repository, identifier string) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.manifests[r.resolve(repository, identifier)]
+	return m.content, ok
+}
+
+// PutImage stores a minimal single-layer image under a tag and returns its
+// digest, so tests have something to sign or attach to.
+func (r *Registry) PutImage(repository, tag string, layer []byte) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	r.blobs[oci.Digest(config)] = config
+	r.blobs[oci.Digest(layer)] = layer
+
+	b, _ := json.Marshal(oci.Manifest{
+		SchemaVersion: 2,
+		MediaType:     oci.MediaTypeImageManifest,
+		Config:        oci.Descriptor{MediaType: "application/vnd.oci.image.config.v1+json", Digest: oci.Digest(config), Size: int64(len(config))},
+		Layers:        []oci.Descriptor{{MediaType: "application/vnd.oci.image.layer.v1.tar", Digest: oci.Digest(layer), Size: int64(len(layer))}},
+	})
+
+	digest := oci.Digest(b)
+	r.manifests[repository+"@"+digest] = manifest{mediaType: oci.MediaTypeImageManifest, content: b}
+	r.tags[repository+":"+tag] = digest
+
+	return digest
+}
+
+func (r *Registry) resolve(repository, identifier string) string {
+	if strings.HasPrefix(identifier, "sha256:") {
+		return repository + "@" + identifier
+	}
+
+	return repository + "@" + r.tags[repository+":"+identifier]
+}
+
+func (r *Registry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case path == "" || path == "/":
+		w.WriteHeader(http.StatusOK)
+
+	case strings.Contains(path, "/blobs/uploads/"):
+		repository, id, _ := strings.Cut(path, "/blobs/uploads/")
+		r.serveUpload(w, req, repository, id)
+
+	case strings.Contains(path, "/blobs/"):
+		_, digest, _ := strings.Cut(path, "/blobs/")
+		r.serveBlob(w, req, digest)
+
+	case strings.Contains(path, "/manifests/"):
+		repository, identifier, _ := strings.Cut(path, "/manifests/")
+		r.serveManifest(w, req, repository, identifier)
+
+	case strings.Contains(path, "/referrers/") && r.ReferrersAPI:
+		repository, digest, _ := strings.Cut(path, "/referrers/")
+		r.serveReferrers(w, req, repository, digest)
+
+	default:
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "unknown endpoint")
+	}
+}
+
+func (r *Registry) serveUpload(w http.ResponseWriter, req *http.Request, repository, id string) {
+	switch req.Method {
+	case http.MethodPost:
+		r.uploads++
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%d", repository, r.uploads))
+		w.WriteHeader(http.StatusAccepted)
+
+	case http.MethodPut:
+		b, _ := io.ReadAll(req.Body)
+		digest := req.URL.Query().Get("digest")
+		if id == "" || oci.Digest(b) != digest {
+			writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "digest does not match content")
+			return
+		}
+
+		r.blobs[digest] = b
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *Registry) serveBlob(w http.ResponseWriter, req *http.Request, digest string) {
+	b, ok := r.blobs[digest]
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+		return
+	}
+
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Content-Length", fmt.Sprint(len(b)))
+	if req.Method == http.MethodGet {
+		_, _ = w.Write(b)
+	}
+}
+
+func (r *Registry) serveManifest(w http.ResponseWriter, req *http.Request, repository, identifier string) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		key := r.resolve(repository, identifier)
+		m, ok := r.manifests[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Docker-Content-Digest", oci.Digest(m.content))
+		w.Header().Set("Content-Length", fmt.Sprint(len(m.content)))
+		if req.Method == http.MethodGet {
+			_, _ = w.Write(m.content)
+		}
+
+	case http.MethodPut:
+		b, _ := io.ReadAll(req.Body)
+		digest := oci.Digest(b)
+		if strings.HasPrefix(identifier, "sha256:") && identifier != digest {
+			writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "digest does not match content")
+			return
+		}
+
+		var parsed struct {
+			Subject *oci.Descriptor `json:"subject"`
+		}
+		if err := json.Unmarshal(b, &parsed); err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+			return
+		}
+
+		r.manifests[repository+"@"+digest] = manifest{mediaType: req.Header.Get("Content-Type"), content: b}
+		if !strings.HasPrefix(identifier, "sha256:") {
+			r.tags[repository+":"+identifier] = digest
+		}
+
+		if parsed.Subject != nil && r.ReferrersAPI {
+			w.Header().Set("OCI-Subject", parsed.Subject.Digest)
+		}
+
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *Registry) serveReferrers(w http.ResponseWriter, req *http.Request, repository, digest string) {
+	index := oci.Index{SchemaVersion: 2, MediaType: oci.MediaTypeImageIndex, Manifests: []oci.Descriptor{}}
+	for key, m := range r.manifests {
+		if !strings.HasPrefix(key, repository+"@") {
+			continue
+		}
+
+		var parsed oci.Manifest
+		if err := json.Unmarshal(m.content, &parsed); err != nil || parsed.Subject == nil || parsed.Subject.Digest != digest {
+			continue
+		}
+
+		artifactType := parsed.ArtifactType
+		if artifactType == "" {
+			artifactType = parsed.Config.MediaType
+		}
+
+		if filter := req.URL.Query().Get("artifactType"); filter != "" && filter != artifactType {
+			continue
+		}
+
+		index.Manifests = append(index.Manifests, oci.Descriptor{
+			MediaType:    m.mediaType,
+			Digest:       oci.Digest(m.content),
+			Size:         int64(len(m.content)),
+			ArtifactType: artifactType,
+			Annotations:  parsed.Annotations,
+		})
+	}
+
+	w.Header().Set("Content-Type", oci.MediaTypeImageIndex)
+	_ = json.NewEncoder(w).Encode(index)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
@@ -0,0 +1,264 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// MediaTypeEmptyJSON is the config of artifacts which have none.
+	// https://github.com/opencontainers/image-spec/blob/main/manifest.md#guidance-for-an-empty-descriptor
+	MediaTypeEmptyJSON = "application/vnd.oci.empty.v1+json"
+)
+
+// emptyJSON is the content of the empty descriptor.
+var emptyJSON = []byte("{}")
+
+// Blob fetches the content of a blob from the repository of the reference.
+func (c *Client) Blob(ctx context.Context, ref Reference, digest string) ([]byte, error) {
+	url := fmt.Sprintf("%s/v2/%s/blobs/%s", c.baseURL(ref.Registry), ref.Repository, digest)
+	res, err := c.do(ctx, ref, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get blob %s: %w", digest, toErr(res))
+	}
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read blob: %w", err)
+	}
+
+	if Digest(b) != digest {
+		return nil, fmt.Errorf("get blob %s: digest mismatch", digest)
+	}
+
+	return b, nil
+}
+
+// PushBlob uploads the content to the repository of the reference in a single
+// request, unless the registry already has it.
+func (c *Client) PushBlob(ctx context.Context, ref Reference, mediaType string, content []byte) (Descriptor, error) {
+	desc := Descriptor{MediaType: mediaType, Digest: Digest(content), Size: int64(len(content))}
+
+	blobURL := fmt.Sprintf("%s/v2/%s/blobs/%s", c.baseURL(ref.Registry), ref.Repository, desc.Digest)
+	res, err := c.do(ctx, ref, http.MethodHead, blobURL, nil, nil)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		return desc, nil
+	}
+
+	uploadURL := fmt.Sprintf("%s/v2/%s/blobs/uploads/", c.baseURL(ref.Registry), ref.Repository)
+	res, err = c.do(ctx, ref, http.MethodPost, uploadURL, nil, nil)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusAccepted {
+		return Descriptor{}, fmt.Errorf("start blob upload: %w", toErr(res))
+	}
+
+	location, err := res.Request.URL.Parse(res.Header.Get("Location"))
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("parse upload location: %w", err)
+	}
+
+	q := location.Query()
+	q.Set("digest", desc.Digest)
+	location.RawQuery = q.Encode()
+
+	res, err = c.do(ctx, ref, http.MethodPut, location.String(), content, map[string]string{"Content-Type": "application/octet-stream"})
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated {
+		return Descriptor{}, fmt.Errorf("upload blob %s: %w", desc.Digest, toErr(res))
+	}
+
+	return desc, nil
+}
+
+// PushManifest uploads a manifest, tagging it with the tag of the reference
+// if it has one. It also reports whether the registry processed the subject of
+// the manifest, i.e. whether it supports the referrers API.
+func (c *Client) PushManifest(ctx context.Context, ref Reference, mediaType string, content []byte) (Descriptor, bool, error) {
+	desc := Descriptor{MediaType: mediaType, Digest: Digest(content), Size: int64(len(content))}
+
+	identifier := ref.Tag
+	if identifier == "" {
+		identifier = desc.Digest
+	}
+
+	manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", c.baseURL(ref.Registry), ref.Repository, identifier)
+	res, err := c.do(ctx, ref, http.MethodPut, manifestURL, content, map[string]string{"Content-Type": mediaType})
+	if err != nil {
+		return Descriptor{}, false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated {
+		return Descriptor{}, false, fmt.Errorf("push manifest %s: %w", identifier, toErr(res))
+	}
+
+	return desc, res.Header.Get("OCI-Subject") != "", nil
+}
+
+// Referrers lists the manifests which have the digest of the reference as
+// their subject, optionally filtered by artifact type. Registries without the
+// referrers API are looked up through the referrers tag schema.
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#listing-referrers
+func (c *Client) Referrers(ctx context.Context, ref Reference, artifactType string) ([]Descriptor, error) {
+	if ref.Digest == "" {
+		return nil, fmt.Errorf("list referrers of %s: reference without digest", ref)
+	}
+
+	referrersURL := fmt.Sprintf("%s/v2/%s/referrers/%s", c.baseURL(ref.Registry), ref.Repository, ref.Digest)
+	if artifactType != "" {
+		referrersURL = fmt.Sprintf("%s?artifactType=%s", referrersURL, url.QueryEscape(artifactType))
+	}
+
+	res, err := c.do(ctx, ref, http.MethodGet, referrersURL, nil, map[string]string{"Accept": MediaTypeImageIndex})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var index Index
+	switch res.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(res.Body).Decode(&index); err != nil {
+			return nil, fmt.Errorf("unmarshal referrers: %w", err)
+		}
+
+	case http.StatusNotFound:
+		index, err = c.referrersTagIndex(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("list referrers of %s: %w", ref, toErr(res))
+	}
+
+	var referrers []Descriptor
+	for _, desc := range index.Manifests {
+		if artifactType == "" || desc.ArtifactType == artifactType {
+			referrers = append(referrers, desc)
+		}
+	}
+
+	return referrers, nil
+}
+
+// Attach pushes an artifact holding a single layer with the content as a
+// referrer of the subject. The subject reference must carry a digest.
+func (c *Client) Attach(ctx context.Context, subject Reference, artifactType, mediaType string, content []byte, annotations map[string]string) (Descriptor, error) {
+	subjectDesc, err := c.Resolve(ctx, subject)
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	config, err := c.PushBlob(ctx, subject, MediaTypeEmptyJSON, emptyJSON)
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("push config: %w", err)
+	}
+
+	layer, err := c.PushBlob(ctx, subject, mediaType, content)
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("push layer: %w", err)
+	}
+
+	manifest := Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageManifest,
+		ArtifactType:  artifactType,
+		Config:        config,
+		Layers:        []Descriptor{layer},
+		Subject:       &Descriptor{MediaType: subjectDesc.MediaType, Digest: subjectDesc.Digest, Size: subjectDesc.Size},
+		Annotations:   annotations,
+	}
+
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return Descriptor{}, fmt.Errorf("marshal manifest: %w", err)
+	}
+
+	desc, subjectSupported, err := c.PushManifest(ctx, Reference{Registry: subject.Registry, Repository: subject.Repository}, MediaTypeImageManifest, b)
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	desc.ArtifactType = artifactType
+	desc.Annotations = annotations
+
+	if !subjectSupported {
+		if err := c.addToReferrersTag(ctx, subject, desc); err != nil {
+			return Descriptor{}, fmt.Errorf("update referrers tag: %w", err)
+		}
+	}
+
+	return desc, nil
+}
+
+// referrersTag returns the tag under which the referrers of a digest are
+// listed for registries without the referrers API, e.g. "sha256-4f2a...".
+func referrersTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1)
+}
+
+func (c *Client) referrersTagIndex(ctx context.Context, ref Reference) (Index, error) {
+	tagRef := Reference{Registry: ref.Registry, Repository: ref.Repository, Tag: referrersTag(ref.Digest)}
+	b, _, err := c.Manifest(ctx, tagRef)
+	if errors.Is(err, ErrNotFound) {
+		// A missing tag simply means there are no referrers yet.
+		return Index{SchemaVersion: 2, MediaType: MediaTypeImageIndex}, nil
+	} else if err != nil {
+		return Index{}, err
+	}
+
+	var index Index
+	if err := json.Unmarshal(b, &index); err != nil {
+		return Index{}, fmt.Errorf("unmarshal referrers index: %w", err)
+	}
+
+	return index, nil
+}
+
+func (c *Client) addToReferrersTag(ctx context.Context, subject Reference, desc Descriptor) error {
+	index, err := c.referrersTagIndex(ctx, subject)
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range index.Manifests {
+		if existing.Digest == desc.Digest {
+			return nil
+		}
+	}
+
+	index.Manifests = append(index.Manifests, desc)
+	b, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("marshal referrers index: %w", err)
+	}
+
+	tagRef := Reference{Registry: subject.Registry, Repository: subject.Repository, Tag: referrersTag(subject.Digest)}
+	_, _, err = c.PushManifest(ctx, tagRef, MediaTypeImageIndex, b)
+	return err
+}
@@ -0,0 +1,90 @@
+package oci_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/manzanit0/monocrat/pkg/oci"
+	"github.com/manzanit0/monocrat/pkg/oci/ocitest"
+)
+
+func TestAttach(t *testing.T) {
+	tests := []struct {
+		name         string
+		referrersAPI bool
+	}{
+		{
+			name:         "registry with referrers API",
+			referrersAPI: true,
+		},
+		{
+			name:         "registry with referrers tag schema",
+			referrersAPI: false,
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			ctx := context.Background()
+			registry := ocitest.NewRegistry(t)
+			registry.ReferrersAPI = tests[idx].referrersAPI
+
+			digest := registry.PutImage("monocrat", "1.2.3", []byte("layer"))
+			subject := oci.Reference{Registry: registry.Address(), Repository: "monocrat", Digest: digest}
+
+			c := &oci.Client{}
+			sbom, err := c.Attach(ctx, subject, "application/spdx+json", "application/spdx+json", []byte(`{"spdxVersion":"SPDX-2.3"}`), nil)
+			if err != nil {
+				t.Fatalf("attach SBOM: %s", err)
+			}
+
+			_, err = c.Attach(ctx, subject, "application/vnd.in-toto+json", "application/vnd.in-toto+json", []byte(`{}`), nil)
+			if err != nil {
+				t.Fatalf("attach provenance: %s", err)
+			}
+
+			referrers, err := c.Referrers(ctx, subject, "application/spdx+json")
+			if err != nil {
+				t.Fatalf("list referrers: %s", err)
+			}
+
+			if len(referrers) != 1 || referrers[0].Digest != sbom.Digest {
+				t.Fatalf("referrers no match: %+v", referrers)
+			}
+
+			all, err := c.Referrers(ctx, subject, "")
+			if err != nil {
+				t.Fatalf("list referrers: %s", err)
+			}
+
+			if len(all) != 2 {
+				t.Fatalf("expected 2 referrers, got %d", len(all))
+			}
+
+			ref := oci.Reference{Registry: registry.Address(), Repository: "monocrat", Digest: sbom.Digest}
+			b, _, err := c.Manifest(ctx, ref)
+			if err != nil {
+				t.Fatalf("get SBOM manifest: %s", err)
+			}
+
+			if len(b) == 0 {
+				t.Fatal("empty SBOM manifest")
+			}
+		})
+	}
+}
+
+func TestReferrersWithoutAny(t *testing.T) {
+	registry := ocitest.NewRegistry(t)
+	digest := registry.PutImage("monocrat", "1.2.3", []byte("layer"))
+
+	c := &oci.Client{}
+	referrers, err := c.Referrers(context.Background(), oci.Reference{Registry: registry.Address(), Repository: "monocrat", Digest: digest}, "")
+	if err != nil {
+		t.Fatalf("list referrers: %s", err)
+	}
+
+	if len(referrers) != 0 {
+		t.Fatalf("expected no referrers, got %+v", referrers)
+	}
+}
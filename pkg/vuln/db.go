@@ -0,0 +1,170 @@
+// Package vuln matches the modules of Go binaries against a vulnerability
+// database in the format of vuln.go.dev, the one govulncheck reads.
+// https://go.dev/security/vuln/database#api
+package vuln
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultURL is the official Go vulnerability database.
+const DefaultURL = "https://vuln.go.dev"
+
+// ErrNotFound is returned when the database has no such document.
+var ErrNotFound = errors.New("not found")
+
+// DB is a vulnerability database, either served over HTTP, such as
+// vuln.go.dev or a mirror of it, or copied to a local directory for offline
+// use.
+type DB struct {
+	// URL is the base of the database: an http(s) URL, a file URL or a path.
+	URL string
+
+	HTTPClient *http.Client
+}
+
+// Entry is a vulnerability report, in OSV format.
+// https://ossf.github.io/osv-schema/
+type Entry struct {
+	ID        string     `json:"id"`
+	Summary   string     `json:"summary"`
+	Details   string     `json:"details"`
+	Aliases   []string   `json:"aliases"`
+	Withdrawn string     `json:"withdrawn,omitempty"`
+	Affected  []Affected `json:"affected"`
+
+	DatabaseSpecific struct {
+		URL string `json:"url"`
+
+		// Severity is only set by databases which grade vulnerabilities,
+		// like GitHub's. vuln.go.dev doesn't.
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// Affected lists the affected versions of a module.
+type Affected struct {
+	Module struct {
+		Path      string `json:"name"`
+		Ecosystem string `json:"ecosystem"`
+	} `json:"package"`
+	Ranges []Range `json:"ranges"`
+}
+
+// Range is a list of versions introducing and fixing the vulnerability.
+// Versions are semver without the "v" prefix, and "0" means all versions.
+type Range struct {
+	Type   string       `json:"type"`
+	Events []RangeEvent `json:"events"`
+}
+
+type RangeEvent struct {
+	Introduced string `json:"introduced,omitempty"`
+	Fixed      string `json:"fixed,omitempty"`
+}
+
+// moduleIndex is an entry of index/modules.json, which lists the
+// vulnerabilities of every module.
+type moduleIndex struct {
+	Path  string `json:"path"`
+	Vulns []struct {
+		ID string `json:"id"`
+
+		// Fixed is the latest version fixing the vulnerability, if any.
+		Fixed string `json:"fixed,omitempty"`
+	} `json:"vulns"`
+}
+
+// modules fetches the index of modules with known vulnerabilities.
+func (db *DB) modules(ctx context.Context) ([]moduleIndex, error) {
+	var index []moduleIndex
+	if err := db.get(ctx, "index/modules.json", &index); err != nil {
+		return nil, fmt.Errorf("get modules index: %w", err)
+	}
+
+	return index, nil
+}
+
+// Entry fetches the report of a vulnerability by ID, e.g. "GO-2023-1571".
+func (db *DB) Entry(ctx context.Context, id string) (*Entry, error) {
+	var entry Entry
+	if err := db.get(ctx, fmt.Sprintf("ID/%s.json", id), &entry); err != nil {
+		return nil, fmt.Errorf("get %s: %w", id, err)
+	}
+
+	return &entry, nil
+}
+
+func (db *DB) get(ctx context.Context, path string, v any) error {
+	b, err := db.read(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("unmarshal %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func (db *DB) read(ctx context.Context, path string) ([]byte, error) {
+	base := db.URL
+	if base == "" {
+		base = DefaultURL
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("parse database URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+	case "file":
+		base = u.Path
+		fallthrough
+	default:
+		b, err := os.ReadFile(filepath.Join(base, filepath.FromSlash(path)))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+
+		return b, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(base, "/")+"/"+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	client := db.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	return io.ReadAll(res.Body)
+}
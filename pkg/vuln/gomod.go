@@ -0,0 +1,33 @@
+package vuln
+
+import (
+	"fmt"
+
+	"golang.org/x/mod/modfile"
+)
+
+// GoModLines maps every module required or replaced in a go.mod file to the
+// line of its directive, so findings can be pointed at. The standard library,
+// "stdlib", maps to the go directive.
+func GoModLines(content []byte) (map[string]int, error) {
+	f, err := modfile.Parse("go.mod", content, nil)
+	if err != nil {
+		return nil, fmt.Errorf("parse go.mod: %w", err)
+	}
+
+	lines := map[string]int{}
+	if f.Go != nil {
+		lines["stdlib"] = f.Go.Syntax.Start.Line
+	}
+
+	for _, r := range f.Require {
+		lines[r.Mod.Path] = r.Syntax.Start.Line
+	}
+
+	// Binaries report the replacements, which is what the findings are about.
+	for _, r := range f.Replace {
+		lines[r.New.Path] = r.Syntax.Start.Line
+	}
+
+	return lines, nil
+}
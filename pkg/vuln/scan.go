@@ -0,0 +1,246 @@
+package vuln
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+
+	"github.com/manzanit0/monocrat/pkg/attest"
+)
+
+// Severity grades how bad a vulnerability is.
+type Severity int
+
+const (
+	SeverityLow Severity = iota + 1
+	SeverityModerate
+	SeverityHigh
+	SeverityCritical
+)
+
+// ParseSeverity parses a severity such as "high", regardless of case.
+// "medium" is taken as moderate.
+func ParseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(s) {
+	case "low":
+		return SeverityLow, nil
+	case "moderate", "medium":
+		return SeverityModerate, nil
+	case "high":
+		return SeverityHigh, nil
+	case "critical":
+		return SeverityCritical, nil
+	default:
+		return 0, fmt.Errorf("unknown severity %q: expected low, moderate, high or critical", s)
+	}
+}
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityLow:
+		return "low"
+	case SeverityModerate:
+		return "moderate"
+	case SeverityHigh:
+		return "high"
+	case SeverityCritical:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
+
+// Severity returns the severity of the vulnerability. The Go vulnerability
+// database doesn't grade them, so ungraded entries are taken as high: they
+// are all worth fixing.
+func (e *Entry) Severity() Severity {
+	s, err := ParseSeverity(e.DatabaseSpecific.Severity)
+	if err != nil {
+		return SeverityHigh
+	}
+
+	return s
+}
+
+// Finding is a vulnerability affecting a module linked into a binary.
+type Finding struct {
+	ID       string
+	Aliases  []string
+	Summary  string
+	URL      string
+	Severity Severity
+
+	// Module and Version are the vulnerable module, and Fixed the earliest
+	// version fixing it, if any.
+	Module  string
+	Version string
+	Fixed   string
+}
+
+// Scan returns the vulnerabilities affecting the modules, sorted by module and
+// ID. The standard library is the "stdlib" module, versioned like "go1.22.2".
+func (db *DB) Scan(ctx context.Context, modules []attest.Module) ([]Finding, error) {
+	index, err := db.modules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	vulnerable := map[string]moduleIndex{}
+	for _, m := range index {
+		vulnerable[m.Path] = m
+	}
+
+	var findings []Finding
+	entries := map[string]*Entry{}
+	for _, m := range modules {
+		version := canonicalVersion(m)
+		if version == "" {
+			// Development builds and such can't be matched.
+			continue
+		}
+
+		for _, v := range vulnerable[m.Path].Vulns {
+			// The index spares fetching the vulnerabilities fixed long ago.
+			if v.Fixed != "" && semver.Compare(version, "v"+v.Fixed) >= 0 {
+				continue
+			}
+
+			entry, ok := entries[v.ID]
+			if !ok {
+				entry, err = db.Entry(ctx, v.ID)
+				if err != nil {
+					return nil, err
+				}
+				entries[v.ID] = entry
+			}
+
+			if entry.Withdrawn != "" {
+				continue
+			}
+
+			for _, affected := range entry.Affected {
+				if affected.Module.Path != m.Path {
+					continue
+				}
+
+				isAffected, fixed := affects(affected.Ranges, version)
+				if !isAffected {
+					continue
+				}
+
+				findings = append(findings, Finding{
+					ID:       entry.ID,
+					Aliases:  entry.Aliases,
+					Summary:  entry.Summary,
+					URL:      entry.DatabaseSpecific.URL,
+					Severity: entry.Severity(),
+					Module:   m.Path,
+					Version:  m.Version,
+					Fixed:    fixed,
+				})
+				break
+			}
+		}
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Module != findings[j].Module {
+			return findings[i].Module < findings[j].Module
+		}
+
+		return findings[i].ID < findings[j].ID
+	})
+
+	return findings, nil
+}
+
+// canonicalVersion returns the version of the module as canonical semver, or
+// empty if it isn't one.
+func canonicalVersion(m attest.Module) string {
+	version := m.Version
+	if m.Path == "stdlib" {
+		version = goVersionToSemver(version)
+	}
+
+	if !semver.IsValid(version) {
+		return ""
+	}
+
+	return semver.Canonical(version)
+}
+
+// goVersionToSemver converts Go versions, e.g. "go1.21rc2", into semver like
+// the database does, e.g. "v1.21.0-rc.2".
+func goVersionToSemver(v string) string {
+	v, ok := strings.CutPrefix(v, "go")
+	if !ok {
+		return ""
+	}
+
+	// Experiments are appended, e.g. "go1.22.2 X:rangefunc".
+	v, _, _ = strings.Cut(v, " ")
+
+	var pre string
+	for _, tag := range []string{"rc", "beta"} {
+		if i := strings.Index(v, tag); i >= 0 {
+			v, pre = v[:i], "-"+tag+"."+v[i+len(tag):]
+			break
+		}
+	}
+
+	if strings.Count(v, ".") == 1 {
+		v += ".0"
+	}
+
+	return "v" + v + pre
+}
+
+// affects reports whether the version falls within any of the ranges, and the
+// version fixing it.
+func affects(ranges []Range, version string) (bool, string) {
+	for _, r := range ranges {
+		if r.Type != "SEMVER" {
+			continue
+		}
+
+		events := append([]RangeEvent(nil), r.Events...)
+		sort.SliceStable(events, func(i, j int) bool {
+			return semver.Compare(eventVersion(events[i]), eventVersion(events[j])) < 0
+		})
+
+		affected := false
+		for _, e := range events {
+			switch {
+			case e.Introduced != "" && semver.Compare(version, eventVersion(e)) >= 0:
+				affected = true
+			case e.Fixed != "" && semver.Compare(version, eventVersion(e)) >= 0:
+				affected = false
+			case e.Fixed != "" && affected:
+				// The first fix after the version, we're done.
+				return true, e.Fixed
+			}
+		}
+
+		if affected {
+			return true, ""
+		}
+	}
+
+	return false, ""
+}
+
+func eventVersion(e RangeEvent) string {
+	v := e.Introduced
+	if v == "" {
+		v = e.Fixed
+	}
+
+	if v == "0" {
+		return "v0.0.0-0"
+	}
+
+	return "v" + v
+}
@@ -0,0 +1,169 @@
+package vuln
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/manzanit0/monocrat/pkg/attest"
+)
+
+func TestScan(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata/vulndb")))
+	t.Cleanup(server.Close)
+
+	modules := []attest.Module{
+		{Path: "github.com/manzanit0/monocrat", Version: "(devel)"},
+		{Path: "stdlib", Version: "go1.22.0"},
+		{Path: "golang.org/x/net", Version: "v0.17.0"},
+		{Path: "github.com/go-chi/chi/v5", Version: "v5.0.8"},
+		{Path: "github.com/withdrawn/module", Version: "v1.0.0"},
+		{Path: "github.com/go-git/go-git/v5", Version: "v5.12.0"},
+	}
+
+	expected := []Finding{
+		{ID: "GHSA-0000-chi0-0000", Module: "github.com/go-chi/chi/v5", Version: "v5.0.8", Fixed: "5.0.12", Severity: SeverityLow, Summary: "Open redirect in chi middleware"},
+		{ID: "GO-2024-2687", Module: "golang.org/x/net", Version: "v0.17.0", Fixed: "0.23.0", Severity: SeverityHigh, Summary: "HTTP/2 CONTINUATION flood in net/http", Aliases: []string{"CVE-2023-45288", "GHSA-4v7x-pqxf-cx7m"}, URL: "https://pkg.go.dev/vuln/GO-2024-2687"},
+		{ID: "GO-2024-2598", Module: "stdlib", Version: "go1.22.0", Fixed: "1.22.1", Severity: SeverityHigh, Summary: "Verify panics on certificates with an unknown public key algorithm in crypto/x509", Aliases: []string{"CVE-2024-24783"}, URL: "https://pkg.go.dev/vuln/GO-2024-2598"},
+	}
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{
+			name: "local directory",
+			url:  "testdata/vulndb",
+		},
+		{
+			name: "mirror over HTTP",
+			url:  server.URL,
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			db := &DB{URL: tests[idx].url}
+			findings, err := db.Scan(context.Background(), modules)
+			if err != nil {
+				t.Fatalf("scan: %s", err)
+			}
+
+			if !reflect.DeepEqual(findings, expected) {
+				t.Fatalf("findings no match:\n%+v\n%+v", findings, expected)
+			}
+		})
+	}
+}
+
+func TestAffects(t *testing.T) {
+	ranges := []Range{
+		{
+			Type: "SEMVER",
+			Events: []RangeEvent{
+				{Introduced: "0"},
+				{Fixed: "1.21.8"},
+				{Introduced: "1.22.0-0"},
+				{Fixed: "1.22.1"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		version  string
+		affected bool
+		fixed    string
+	}{
+		{
+			name:     "before the first fix",
+			version:  "v1.20.0",
+			affected: true,
+			fixed:    "1.21.8",
+		},
+		{
+			name:     "first fix",
+			version:  "v1.21.8",
+			affected: false,
+		},
+		{
+			name:     "reintroduced",
+			version:  "v1.22.0",
+			affected: true,
+			fixed:    "1.22.1",
+		},
+		{
+			name:     "reintroduced in a release candidate",
+			version:  "v1.22.0-rc.2",
+			affected: true,
+			fixed:    "1.22.1",
+		},
+		{
+			name:     "second fix",
+			version:  "v1.22.2",
+			affected: false,
+		},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			affected, fixed := affects(ranges, tests[idx].version)
+			if affected != tests[idx].affected || fixed != tests[idx].fixed {
+				t.Fatalf("expected %t %q, got %t %q", tests[idx].affected, tests[idx].fixed, affected, fixed)
+			}
+		})
+	}
+}
+
+func TestGoVersionToSemver(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected string
+	}{
+		{version: "go1.22.2", expected: "v1.22.2"},
+		{version: "go1.21", expected: "v1.21.0"},
+		{version: "go1.21rc2", expected: "v1.21.0-rc.2"},
+		{version: "go1.22.2 X:rangefunc", expected: "v1.22.2"},
+		{version: "devel", expected: ""},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].version, func(t *testing.T) {
+			if actual := goVersionToSemver(tests[idx].version); actual != tests[idx].expected {
+				t.Fatalf("expected %q, got %q", tests[idx].expected, actual)
+			}
+		})
+	}
+}
+
+func TestGoModLines(t *testing.T) {
+	gomod := []byte(`module github.com/manzanit0/monocrat
+
+go 1.22.2
+
+require (
+	github.com/go-chi/chi/v5 v5.0.8
+	golang.org/x/net v0.17.0 // indirect
+)
+
+replace github.com/old/module => github.com/new/module v1.2.3
+`)
+
+	lines, err := GoModLines(gomod)
+	if err != nil {
+		t.Fatalf("parse: %s", err)
+	}
+
+	expected := map[string]int{
+		"stdlib":                   3,
+		"github.com/go-chi/chi/v5": 6,
+		"golang.org/x/net":         7,
+		"github.com/new/module":    10,
+	}
+
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("lines no match: %v", lines)
+	}
+}
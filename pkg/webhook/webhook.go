@@ -0,0 +1,151 @@
+// Package webhook delivers webhook payloads the way GitHub does, to replay
+// recorded events against a running service.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Sign returns the signature of the payload with the secret, as GitHub sends
+// it in the X-Hub-Signature-256 header.
+func Sign(payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewRequest returns a delivery of the payload for the event, e.g.
+// "check_suite", signed with the secret unless empty.
+func NewRequest(ctx context.Context, url, event string, payload []byte, secret string) (*http.Request, error) {
+	delivery, err := deliveryID()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GitHub-Hookshot/monocrat")
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-GitHub-Delivery", delivery)
+	if secret != "" {
+		req.Header.Set("X-Hub-Signature-256", Sign(payload, secret))
+	}
+
+	return req, nil
+}
+
+// Deliver posts the payload for the event to the URL, failing unless the
+// response is a success.
+func Deliver(ctx context.Context, client *http.Client, url, event string, payload []byte, secret string) error {
+	req, err := NewRequest(ctx, url, event, payload, secret)
+	if err != nil {
+		return err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("deliver %s: %w", event, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("deliver %s: %s", event, strings.TrimSpace(res.Status+" "+string(body)))
+	}
+
+	return nil
+}
+
+// Verify is a middleware rejecting deliveries not signed with the secret, as
+// GitHub signs them in the X-Hub-Signature-256 header. It does nothing when the
+// secret is empty.
+func Verify(secret string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if secret == "" {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			payload, err := io.ReadAll(r.Body)
+			if err != nil {
+				log.Println("[error] reading delivery:", err.Error())
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(payload))
+
+			signature := r.Header.Get("X-Hub-Signature-256")
+			if !hmac.Equal([]byte(signature), []byte(Sign(payload, secret))) {
+				log.Println("[error] invalid signature of delivery:", r.Header.Get("X-GitHub-Delivery"))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Capture is a middleware keeping every delivery in the directory, named after
+// its event and delivery ID so that it can be replayed. It does nothing when
+// the directory is empty. Chained after Verify, only verified deliveries are
+// kept.
+func Capture(dir string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if dir == "" {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			payload, err := io.ReadAll(r.Body)
+			if err != nil {
+				log.Println("[error] reading delivery:", err.Error())
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(payload))
+
+			name := fmt.Sprintf("%s.%s.json", r.Header.Get("X-GitHub-Event"), r.Header.Get("X-GitHub-Delivery"))
+			if err := os.WriteFile(filepath.Join(dir, filepath.Base(name)), payload, 0o644); err != nil {
+				log.Println("[error] capturing delivery:", err.Error())
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// EventFromFilename returns the event of a fixture from its name, e.g.
+// "check_suite" for "events/check_suite.requested.json".
+func EventFromFilename(name string) string {
+	event, _, _ := strings.Cut(filepath.Base(name), ".")
+	return event
+}
+
+// deliveryID returns a random GUID, as GitHub identifies deliveries with.
+func deliveryID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("generate delivery ID: %w", err)
+	}
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
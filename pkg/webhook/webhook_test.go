@@ -0,0 +1,186 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Manzanit0/go-github/v52/github"
+	"github.com/manzanit0/monocrat/events"
+	ghapp "github.com/manzanit0/monocrat/pkg/github"
+)
+
+func TestEventFromFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		event    string
+	}{
+		{name: "fixture", filename: "events/check_suite.requested.json", event: "check_suite"},
+		{name: "no action", filename: "installation.json", event: "installation"},
+		{name: "captured", filename: "/tmp/deployment_protection_rule", event: "deployment_protection_rule"},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			event := EventFromFilename(tests[idx].filename)
+			if event != tests[idx].event {
+				t.Fatalf("event no match: %s", event)
+			}
+		})
+	}
+}
+
+// TestFixtures delivers every fixture, checking it's signed and parses as the
+// event it's named after.
+func TestFixtures(t *testing.T) {
+	names, err := fs.Glob(events.Fixtures, "*.json")
+	if err != nil || len(names) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			payload, err := fs.ReadFile(events.Fixtures, name)
+			if err != nil {
+				t.Fatalf("read fixture: %s", err)
+			}
+
+			event := EventFromFilename(name)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-GitHub-Delivery") == "" {
+					t.Errorf("missing delivery ID")
+				}
+
+				body, err := github.ValidatePayload(r, []byte("s3cr3t"))
+				if err != nil {
+					t.Errorf("validate payload: %s", err)
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+
+				if err := parse(github.WebHookType(r), body); err != nil {
+					t.Errorf("parse webhook: %s", err)
+					w.WriteHeader(http.StatusBadRequest)
+				}
+			}))
+			defer server.Close()
+
+			err = Deliver(context.Background(), server.Client(), server.URL, event, payload, "s3cr3t")
+			if err != nil {
+				t.Fatalf("deliver: %s", err)
+			}
+		})
+	}
+}
+
+func TestDeliverFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("boom\n"))
+	}))
+	defer server.Close()
+
+	err := Deliver(context.Background(), server.Client(), server.URL, "check_suite", []byte("{}"), "")
+	if err == nil || err.Error() != "deliver check_suite: 500 Internal Server Error boom" {
+		t.Fatalf("error no match: %v", err)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	dir := t.TempDir()
+
+	var received []byte
+	handler := Capture(dir)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+	}))
+
+	payload := []byte(`{"action":"requested"}`)
+	req, err := NewRequest(context.Background(), "http://localhost/", "check_suite", payload, "")
+	if err != nil {
+		t.Fatalf("new request: %s", err)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if string(received) != string(payload) {
+		t.Fatalf("received no match: %s", received)
+	}
+
+	name := filepath.Join(dir, "check_suite."+req.Header.Get("X-GitHub-Delivery")+".json")
+	captured, err := os.ReadFile(name)
+	if err != nil || string(captured) != string(payload) {
+		t.Fatalf("captured no match: %s, %v", captured, err)
+	}
+
+	if EventFromFilename(name) != "check_suite" {
+		t.Fatalf("event no match: %s", EventFromFilename(name))
+	}
+}
+
+// parse parses the payload as the services do: go-github doesn't know of
+// deployment_protection_rule events.
+func parse(event string, payload []byte) error {
+	if event == "deployment_protection_rule" {
+		var e ghapp.DeploymentProtectionRuleEvent
+		return json.Unmarshal(payload, &e)
+	}
+
+	_, err := github.ParseWebHook(event, payload)
+	return err
+}
+
+func TestVerify(t *testing.T) {
+	payload := []byte(`{"action":"requested"}`)
+
+	tests := []struct {
+		name     string
+		secret   string
+		signWith string
+		status   int
+	}{
+		{name: "signed", secret: "s3cr3t", signWith: "s3cr3t", status: http.StatusOK},
+		{name: "unsigned", secret: "s3cr3t", status: http.StatusUnauthorized},
+		{name: "signed with another secret", secret: "s3cr3t", signWith: "other", status: http.StatusUnauthorized},
+		{name: "no secret", status: http.StatusOK},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			var received []byte
+			handler := Verify(tests[idx].secret)(Capture(dir)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, _ = io.ReadAll(r.Body)
+			})))
+
+			req, err := NewRequest(context.Background(), "http://localhost/", "check_suite", payload, tests[idx].signWith)
+			if err != nil {
+				t.Fatalf("new request: %s", err)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tests[idx].status {
+				t.Fatalf("status no match: %d", w.Code)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("read capture directory: %s", err)
+			}
+
+			verified := tests[idx].status == http.StatusOK
+			if (string(received) == string(payload)) != verified || (len(entries) == 1) != verified {
+				t.Fatalf("received or captured no match: %s, %v", received, entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+// Package workspace manages the directories jobs work in: it creates them
+// under a single root, removes them when jobs are done or were interrupted,
+// and refuses new ones while the root is over its disk quota.
+package workspace
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// markerName is the file marking the directories of the root which are
+// workspaces, so that nothing else in it ever gets removed.
+const markerName = ".monocrat-workspace"
+
+// ErrQuotaExceeded is returned when creating a workspace while those in use
+// take more disk than the quota allows.
+var ErrQuotaExceeded = errors.New("workspace disk quota exceeded")
+
+// Manager owns every workspace under Root. It is safe for concurrent use.
+type Manager struct {
+	Root string
+
+	// Quota is how many bytes the workspaces may take altogether before new
+	// ones are refused. There is no limit when zero.
+	Quota int64
+
+	// Reserve is how many bytes every workspace is expected to take, which
+	// count against the quota until it takes more, so that jobs starting at
+	// the same time don't overshoot the quota together.
+	Reserve int64
+
+	mu     sync.Mutex
+	active map[string]struct{}
+	stats  Stats
+}
+
+// Stats are the metrics of a manager.
+type Stats struct {
+	// Active is how many workspaces are in use.
+	Active int `json:"active"`
+
+	// Bytes is how much disk the workspaces take.
+	Bytes int64 `json:"bytes"`
+	Quota int64 `json:"quota"`
+
+	Created   int64 `json:"created"`
+	Removed   int64 `json:"removed"`
+	Rejected  int64 `json:"rejected"`
+	Collected int64 `json:"collected"`
+}
+
+// Workspace is a directory for a job. Close it once the job is done.
+type Workspace struct {
+	Path string
+
+	manager *Manager
+	once    sync.Once
+	err     error
+}
+
+// Create creates a workspace, named after the job for those browsing the
+// root.
+func (m *Manager) Create(name string) (*Workspace, error) {
+	// Workspaces are checked against the quota and reserved at once.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Quota > 0 {
+		usage, err := m.committed()
+		if err != nil {
+			return nil, err
+		}
+
+		if usage >= m.Quota || usage+m.Reserve > m.Quota {
+			m.stats.Rejected++
+			return nil, fmt.Errorf("%w: %d of %d bytes in use or reserved", ErrQuotaExceeded, usage, m.Quota)
+		}
+	}
+
+	if err := os.MkdirAll(m.Root, 0o755); err != nil {
+		return nil, fmt.Errorf("create workspace root: %w", err)
+	}
+
+	path, err := os.MkdirTemp(m.Root, sanitize(name)+"-")
+	if err != nil {
+		return nil, fmt.Errorf("create workspace: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(path, markerName), nil, 0o644); err != nil {
+		os.RemoveAll(path)
+		return nil, fmt.Errorf("create workspace: %w", err)
+	}
+
+	if m.active == nil {
+		m.active = map[string]struct{}{}
+	}
+	m.active[path] = struct{}{}
+	m.stats.Created++
+
+	return &Workspace{Path: path, manager: m}, nil
+}
+
+// Dir creates a directory within the workspace.
+func (w *Workspace) Dir(name string) (string, error) {
+	path := filepath.Join(w.Path, name)
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return "", fmt.Errorf("create workspace directory: %w", err)
+	}
+
+	return path, nil
+}
+
+// Close removes the workspace. Closing it again is a no-op.
+func (w *Workspace) Close() error {
+	w.once.Do(func() {
+		if err := os.RemoveAll(w.Path); err != nil {
+			w.err = fmt.Errorf("remove workspace: %w", err)
+			return
+		}
+
+		m := w.manager
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.active, w.Path)
+		m.stats.Removed++
+	})
+
+	return w.err
+}
+
+// GC removes the workspaces not in use, i.e. those left behind by a previous
+// run which didn't get to clean up after itself. Anything else in the root is
+// left alone. Call it on startup.
+func (m *Manager) GC() error {
+	entries, err := os.ReadDir(m.Root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("list workspaces: %w", err)
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(m.Root, entry.Name())
+		if _, err := os.Stat(filepath.Join(path, markerName)); err != nil {
+			continue
+		}
+
+		m.mu.Lock()
+		_, active := m.active[path]
+		m.mu.Unlock()
+		if active {
+			continue
+		}
+
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, fmt.Errorf("remove stale workspace: %w", err))
+			continue
+		}
+
+		log.Println("[info] removed stale workspace", path)
+		m.mu.Lock()
+		m.stats.Collected++
+		m.mu.Unlock()
+	}
+
+	return errors.Join(errs...)
+}
+
+// Usage returns how many bytes the workspaces take.
+func (m *Manager) Usage() (int64, error) {
+	sizes, err := m.sizes()
+	if err != nil {
+		return 0, err
+	}
+
+	var usage int64
+	for _, size := range sizes {
+		usage += size
+	}
+
+	return usage, nil
+}
+
+// committed returns how many bytes the workspaces take, counting those in use
+// as taking at least what's reserved for each. The caller holds m.mu.
+func (m *Manager) committed() (int64, error) {
+	sizes, err := m.sizes()
+	if err != nil {
+		return 0, err
+	}
+
+	var usage int64
+	for _, size := range sizes {
+		usage += size
+	}
+
+	for path := range m.active {
+		if size := sizes[path]; size < m.Reserve {
+			usage += m.Reserve - size
+		}
+	}
+
+	return usage, nil
+}
+
+// sizes returns how many bytes every entry of the root takes, by path.
+func (m *Manager) sizes() (map[string]int64, error) {
+	sizes := map[string]int64{}
+	err := filepath.WalkDir(m.Root, func(path string, d fs.DirEntry, err error) error {
+		// Workspaces may go away while walking.
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err == nil {
+				rel, _ := filepath.Rel(m.Root, path)
+				entry, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+				sizes[filepath.Join(m.Root, entry)] += info.Size()
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("measure workspaces: %w", err)
+	}
+
+	return sizes, nil
+}
+
+// Stats returns the metrics of the manager.
+func (m *Manager) Stats() Stats {
+	usage, err := m.Usage()
+	if err != nil {
+		log.Println("[error]", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	stats.Active = len(m.active)
+	stats.Bytes = usage
+	stats.Quota = m.Quota
+
+	return stats
+}
+
+// Publish exposes the metrics of the manager under the name in expvar, i.e.
+// at /debug/vars.
+func (m *Manager) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any { return m.Stats() }))
+}
+
+// ParseSize parses a size in bytes, optionally with a K, M, G or T suffix in
+// powers of 1024, e.g. "512M" or "10G".
+func ParseSize(size string) (int64, error) {
+	s := strings.TrimSpace(strings.ToUpper(size))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	multiplier := int64(1)
+	for i, suffix := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(s, suffix) {
+			s = strings.TrimSuffix(s, suffix)
+			multiplier = 1 << (10 * (i + 1))
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+
+	return n * multiplier, nil
+}
+
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,156 @@
+package workspace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestManager(t *testing.T) {
+	m := &Manager{Root: filepath.Join(t.TempDir(), "workspaces"), Quota: 1024}
+
+	ws, err := m.Create("lint octo/repo")
+	if err != nil {
+		t.Fatalf("create workspace: %s", err)
+	}
+
+	if !strings.HasPrefix(filepath.Base(ws.Path), "lint_octo_repo-") {
+		t.Fatalf("path no match: %s", ws.Path)
+	}
+
+	dir, err := ws.Dir("export")
+	if err != nil {
+		t.Fatalf("create directory: %s", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "image.tar"), make([]byte, 2048), 0o644); err != nil {
+		t.Fatalf("write file: %s", err)
+	}
+
+	if _, err := m.Create("build"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected quota to be exceeded, got %v", err)
+	}
+
+	stats := m.Stats()
+	if stats.Active != 1 || stats.Bytes != 2048 || stats.Quota != 1024 || stats.Created != 1 || stats.Rejected != 1 {
+		t.Fatalf("stats no match: %+v", stats)
+	}
+
+	if err := ws.Close(); err != nil {
+		t.Fatalf("close workspace: %s", err)
+	}
+
+	if err := ws.Close(); err != nil {
+		t.Fatalf("close workspace again: %s", err)
+	}
+
+	if _, err := os.Stat(ws.Path); !os.IsNotExist(err) {
+		t.Fatalf("workspace not removed: %v", err)
+	}
+
+	stats = m.Stats()
+	if stats.Active != 0 || stats.Bytes != 0 || stats.Removed != 1 {
+		t.Fatalf("stats no match: %+v", stats)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	m := &Manager{Root: t.TempDir(), Quota: 1024, Reserve: 600}
+
+	ws, err := m.Create("lint")
+	if err != nil {
+		t.Fatalf("create workspace: %s", err)
+	}
+
+	// The first workspace is empty yet, but takes its reservation.
+	if _, err := m.Create("build"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected quota to be exceeded, got %v", err)
+	}
+
+	if err := ws.Close(); err != nil {
+		t.Fatalf("close workspace: %s", err)
+	}
+
+	if _, err := m.Create("build"); err != nil {
+		t.Fatalf("create workspace: %s", err)
+	}
+}
+
+func TestGC(t *testing.T) {
+	root := t.TempDir()
+
+	// Left behind by a previous run.
+	stale := &Manager{Root: root}
+	if _, err := stale.Create("build"); err != nil {
+		t.Fatalf("create workspace: %s", err)
+	}
+
+	// Not workspaces, e.g. when the root is shared with something else.
+	if err := os.Mkdir(filepath.Join(root, "cache"), 0o755); err != nil {
+		t.Fatalf("create directory: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "notes.txt"), nil, 0o644); err != nil {
+		t.Fatalf("write file: %s", err)
+	}
+
+	m := &Manager{Root: root}
+	ws, err := m.Create("lint")
+	if err != nil {
+		t.Fatalf("create workspace: %s", err)
+	}
+
+	if err := m.GC(); err != nil {
+		t.Fatalf("gc: %s", err)
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatalf("list workspaces: %s", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	want := []string{"cache", filepath.Base(ws.Path), "notes.txt"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("entries no match: %v", names)
+	}
+
+	if stats := m.Stats(); stats.Collected != 1 {
+		t.Fatalf("stats no match: %+v", stats)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		name string
+		size string
+		want int64
+		err  bool
+	}{
+		{name: "bytes", size: "1024", want: 1024},
+		{name: "megabytes", size: "512M", want: 512 << 20},
+		{name: "gibibytes", size: "10GiB", want: 10 << 30},
+		{name: "lowercase", size: "2g", want: 2 << 30},
+		{name: "invalid", size: "lots", err: true},
+		{name: "negative", size: "-1", err: true},
+	}
+
+	for idx := range tests {
+		t.Run(tests[idx].name, func(t *testing.T) {
+			got, err := ParseSize(tests[idx].size)
+			if (err != nil) != tests[idx].err {
+				t.Fatalf("error no match: %v", err)
+			}
+
+			if got != tests[idx].want {
+				t.Fatalf("size no match: %d", got)
+			}
+		})
+	}
+}